@@ -0,0 +1,532 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/index"
+	"time-series-engine/internal/line_protocol"
+	"time-series-engine/internal/query"
+	"time-series-engine/server"
+	"unicode/utf8"
+)
+
+// options are flags accepted both before and after the command
+type options struct {
+	configPath string
+	format     string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.configPath, "config", o.configPath, "path of the configuration file")
+	fs.StringVar(&o.format, "format", o.format, "output format: table, csv or json, export also accepts line")
+}
+
+// commandContext is what commands run with, once flags are parsed and the engine is open
+type commandContext struct {
+	engine *engine.Engine
+	conf   *config.Config
+	stdin  io.Reader
+	stdout io.Writer
+	// format is empty when not given, commands choose their own default then
+	format string
+}
+
+type command struct {
+	args        string
+	description string
+	// setup registers flags of the command and returns the function running it with the rest of arguments
+	setup func(fs *flag.FlagSet) func(c *commandContext, args []string) error
+}
+
+var commands = map[string]*command{
+	"write": {
+		args:        "[line...]",
+		description: "write points in line protocol given as arguments, or read from stdin",
+		setup:       writeCommand,
+	},
+	"query": {
+		args:        "<statement>",
+		description: "run a statement of the query language",
+		setup:       queryCommand,
+	},
+	"aggregate": {
+		args:        "<function> <measurement> [matcher...]",
+		description: "aggregate matching series, optionally grouped by tags and in time buckets",
+		setup:       aggregateCommand,
+	},
+	"delete": {
+		args:        "<measurement> [matcher...]",
+		description: "delete points of matching series in the time range, or all of them with -all",
+		setup:       deleteCommand,
+	},
+	"import": {
+		args:        "<file | ->",
+		description: "write points from a line protocol file, or from stdin",
+		setup:       importCommand,
+	},
+	"export": {
+		args:        "<measurement> [matcher...]",
+		description: "stream points of matching series, as line protocol unless another format is given",
+		setup:       exportCommand,
+	},
+	"inspect": {
+		description: "show statistics of stored windows, parquets and row groups",
+		setup:       inspectCommand,
+	},
+	"compact": {
+		description: "rewrite parquets with deleted points or partial row groups",
+		setup:       compactCommand,
+	},
+	"serve": {
+		description: "serve the HTTP API until interrupted",
+		setup:       serveCommand,
+	},
+}
+
+// Run runs the command given by args, which don't include the program name, and returns
+// the exit status. Without a command the interactive menu is started.
+func Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	opts := &options{configPath: config.DefaultPath}
+	global := flag.NewFlagSet("tse", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.Usage = func() { usage(stderr, global) }
+	opts.register(global)
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	args = global.Args()
+
+	run := func(c *commandContext, args []string) error {
+		NewMenu(c.engine).Run()
+		return nil
+	}
+	if len(args) > 0 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			fmt.Fprintf(stderr, "[ERROR]: unknown command %q\n\n", args[0])
+			usage(stderr, global)
+			return 2
+		}
+
+		fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		fs.Usage = func() {
+			fmt.Fprintf(stderr, "Usage: tse [flags] %s [flags] %s\n\n%s\n\nFlags:\n", args[0], cmd.args, cmd.description)
+			fs.PrintDefaults()
+		}
+		opts.register(fs)
+		run = cmd.setup(fs)
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		args = fs.Args()
+	}
+
+	if opts.format != "" && !slices.Contains(formats, opts.format) {
+		fmt.Fprintf(stderr, "[ERROR]: unsupported output format %q, expected one of %s\n", opts.format, strings.Join(formats, ", "))
+		return 2
+	}
+
+	conf := config.LoadConfigurationFrom(opts.configPath)
+	e, err := engine.Open(conf)
+	if err != nil {
+		fmt.Fprintf(stderr, "[ERROR]: %v\n", err)
+		return 1
+	}
+	if report := e.RecoveryReport(); !report.Clean() {
+		fmt.Fprintln(stderr, report)
+	}
+
+	c := &commandContext{engine: e, conf: conf, stdin: stdin, stdout: stdout, format: opts.format}
+	err = errors.Join(run(c, args), e.Close())
+	if err != nil {
+		printError(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: tse [flags] [command]\n\nWithout a command the interactive menu is started.\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	global.PrintDefaults()
+}
+
+// printError points at position of syntax errors under the statement
+func printError(w io.Writer, err error) {
+	var syntaxErr *query.Error
+	if errors.As(err, &syntaxErr) {
+		var statementErr *statementError
+		if errors.As(err, &statementErr) {
+			column := utf8.RuneCountInString(statementErr.statement[:syntaxErr.Pos])
+			fmt.Fprintf(w, "%s\n%s^\n", statementErr.statement, strings.Repeat(" ", column))
+		}
+	}
+	fmt.Fprintf(w, "[ERROR]: %v\n", err)
+}
+
+// statementError keeps the statement a syntax error was found in
+type statementError struct {
+	statement string
+	err       error
+}
+
+func (e *statementError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statementError) Unwrap() error {
+	return e.err
+}
+
+func writeCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	precision := precisionFlag(fs)
+	return func(c *commandContext, args []string) error {
+		r := c.stdin
+		if len(args) > 0 {
+			r = strings.NewReader(strings.Join(args, "\n"))
+		}
+		written, err := c.engine.WriteLineProtocol(r, *precision)
+		fmt.Fprintf(c.stdout, "Written %d points\n", written)
+		return err
+	}
+}
+
+func importCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	precision := precisionFlag(fs)
+	return func(c *commandContext, args []string) error {
+		if len(args) != 1 {
+			return errors.New("expected a file to import, or - for stdin")
+		}
+
+		r := c.stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		written, err := c.engine.WriteLineProtocol(r, *precision)
+		fmt.Fprintf(c.stdout, "Imported %d points\n", written)
+		return err
+	}
+}
+
+func queryCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	return func(c *commandContext, args []string) error {
+		if len(args) == 0 {
+			return errors.New("expected a statement")
+		}
+		statement := strings.Join(args, " ")
+		result, err := c.engine.Execute(statement)
+		if err != nil {
+			return &statementError{statement: statement, err: err}
+		}
+		return printResult(c, result)
+	}
+}
+
+func aggregateCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	timeRange := timeRangeFlags(fs)
+	groupBy := fs.String("by", "", "comma separated tags to group series by")
+	every := fs.Duration("every", 0, "duration of time buckets, such as 1m, the whole range when zero")
+	fill := fs.String("fill", "", "fill mode of empty buckets: none, null, previous or linear")
+	return func(c *commandContext, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected aggregation function and measurement")
+		}
+		matchers, err := parseMatchers(args[2:])
+		if err != nil {
+			return err
+		}
+		if *fill != "" && *every == 0 {
+			return errors.New("-fill requires -every")
+		}
+
+		q := &query.Query{
+			Function:       functionName(args[0]),
+			Measurement:    args[1],
+			Matchers:       matchers,
+			TimeConditions: timeRange.conditions(),
+			Interval:       *every,
+			Fill:           *fill,
+		}
+		if *groupBy != "" {
+			q.GroupBy = strings.Split(*groupBy, ",")
+		}
+
+		result, err := c.engine.ExecuteQuery(q)
+		if err != nil {
+			return err
+		}
+		return printResult(c, result)
+	}
+}
+
+func deleteCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	timeRange := timeRangeFlags(fs)
+	all := fs.Bool("all", false, "delete points over the whole time range")
+	return func(c *commandContext, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected measurement")
+		}
+		// deleting everything has to be asked for explicitly
+		hasRange := timeRange.hasStart || timeRange.hasEnd
+		if !hasRange && !*all {
+			return errors.New("expected -start or -end, or -all to delete all points")
+		}
+		if hasRange && *all {
+			return errors.New("-all can't be combined with -start or -end")
+		}
+		matchers, err := parseMatchers(args[1:])
+		if err != nil {
+			return err
+		}
+
+		series := c.engine.Series(args[0], matchers...)
+		for _, ts := range series {
+			err = c.engine.DeleteRange(ts, timeRange.start, timeRange.end)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(c.stdout, "Deleted points of %d series\n", len(series))
+		return nil
+	}
+}
+
+func exportCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	timeRange := timeRangeFlags(fs)
+	precision := fs.String("precision", "ns", "precision of exported line protocol timestamps: s, ms, us or ns")
+	return func(c *commandContext, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected measurement")
+		}
+		matchers, err := parseMatchers(args[1:])
+		if err != nil {
+			return err
+		}
+		target, err := internal.ParsePrecision(*precision)
+		if err != nil {
+			return err
+		}
+
+		var t table
+		if c.format != "" && c.format != FormatLine {
+			t, err = newTable(c.format, c.stdout, "series", "timestamp", "value")
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, ts := range c.engine.Series(args[0], matchers...) {
+			err = exportSeries(c, t, ts, timeRange, target)
+			if err != nil {
+				return err
+			}
+		}
+		if t != nil {
+			return t.Close()
+		}
+		return nil
+	}
+}
+
+// exportSeries streams points of the time series, as line protocol when t is nil
+func exportSeries(c *commandContext, t table, ts *internal.TimeSeries, r *timeRangeFlag, target internal.Precision) error {
+	it, err := c.engine.Iterator(ts, r.start, r.end)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	label := seriesLabel(ts.MeasurementName, ts.Tags)
+	for it.Next() {
+		p := it.At()
+		if t != nil {
+			err = t.Row(label, p.Timestamp, p.Value)
+		} else {
+			line := line_protocol.FormatLine(ts, internal.NewPointAt(p.Value, target.Convert(p.Timestamp, c.engine.Precision())))
+			_, err = fmt.Fprintln(c.stdout, line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func inspectCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	return func(c *commandContext, args []string) error {
+		stats, err := c.engine.Inspect()
+		if err != nil {
+			return err
+		}
+
+		t, err := newTable(outputFormat(c), c.stdout, "statistic", "value")
+		if err != nil {
+			return err
+		}
+		rows := []struct {
+			name  string
+			value any
+		}{
+			{"series", stats.Series},
+			{"windows", stats.Windows},
+			{"parquets", stats.Parquets},
+			{"uncompacted_parquets", stats.Uncompacted},
+			{"row_groups", stats.RowGroups},
+			{"points", stats.Points},
+			{"deleted_points", stats.DeletedPoints},
+			{"compressed_row_groups", stats.CompressedRowGroups},
+			{"bytes", stats.Bytes},
+		}
+		for _, row := range rows {
+			err = t.Row(row.name, row.value)
+			if err != nil {
+				return err
+			}
+		}
+		return t.Close()
+	}
+}
+
+func compactCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	return func(c *commandContext, args []string) error {
+		compacted, err := c.engine.Compact()
+		fmt.Fprintf(c.stdout, "Compacted %d parquets\n", compacted)
+		return err
+	}
+}
+
+func serveCommand(fs *flag.FlagSet) func(c *commandContext, args []string) error {
+	return func(c *commandContext, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		fmt.Fprintf(c.stdout, "Listening on %s\n", c.conf.ServerConfig.Address)
+		return server.New(c.engine).ListenAndServe(ctx, c.conf.ServerConfig.Address)
+	}
+}
+
+// printResult writes a row per point, bucket or aggregation of each series of the result
+func printResult(c *commandContext, result *engine.Result) error {
+	t, err := newTable(outputFormat(c), c.stdout, "series", "timestamp", "value")
+	if err != nil {
+		return err
+	}
+	for _, series := range result.Series {
+		label := seriesLabel(series.Measurement, series.Tags)
+		for _, row := range series.Rows {
+			var value any
+			if row.Found {
+				value = row.Value
+			}
+			err = t.Row(label, row.Timestamp, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return t.Close()
+}
+
+func outputFormat(c *commandContext) string {
+	if c.format == "" {
+		return FormatTable
+	}
+	return c.format
+}
+
+func precisionFlag(fs *flag.FlagSet) *internal.Precision {
+	precision := internal.Nanoseconds
+	fs.Func("precision", "precision of line protocol timestamps: s, ms, us or ns (default ns)", func(s string) error {
+		var err error
+		precision, err = internal.ParsePrecision(s)
+		return err
+	})
+	return &precision
+}
+
+// timeRangeFlag is the inclusive range of -start and -end, in timestamps of the engine precision
+type timeRangeFlag struct {
+	start, end uint64
+	hasStart   bool
+	hasEnd     bool
+}
+
+func timeRangeFlags(fs *flag.FlagSet) *timeRangeFlag {
+	r := &timeRangeFlag{end: math.MaxUint64}
+	fs.Func("start", "first timestamp of the range, in the engine precision (default the earliest)", func(s string) error {
+		var err error
+		r.start, err = strconv.ParseUint(s, 10, 64)
+		r.hasStart = true
+		return err
+	})
+	fs.Func("end", "last timestamp of the range, in the engine precision (default the latest)", func(s string) error {
+		var err error
+		r.end, err = strconv.ParseUint(s, 10, 64)
+		r.hasEnd = true
+		return err
+	})
+	return r
+}
+
+// conditions returns the range as time conditions of a query, which bounds buckets only when -end is given
+func (r *timeRangeFlag) conditions() []*query.TimeCondition {
+	conditions := make([]*query.TimeCondition, 0, 2)
+	if r.hasStart {
+		conditions = append(conditions, &query.TimeCondition{Operator: ">=", Time: &query.Time{Timestamp: r.start}})
+	}
+	if r.hasEnd {
+		conditions = append(conditions, &query.TimeCondition{Operator: "<=", Time: &query.Time{Timestamp: r.end}})
+	}
+	return conditions
+}
+
+func parseMatchers(args []string) ([]*index.Matcher, error) {
+	matchers := make([]*index.Matcher, 0, len(args))
+	for _, arg := range args {
+		matcher, err := index.ParseMatcher(arg)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// functionName matches names of aggregation functions case insensitively, such as max or p99
+func functionName(name string) string {
+	for _, function := range engine.GetAllAggregationFunctions() {
+		if strings.EqualFold(name, function) {
+			return function
+		}
+	}
+	if p, ok := strings.CutPrefix(name, "p"); ok {
+		return "P" + p
+	}
+	return name
+}
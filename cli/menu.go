@@ -0,0 +1,396 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/index"
+	"time-series-engine/internal/query"
+	"unicode/utf8"
+)
+
+// Menu is an interactive stdin front end of the engine
+type Menu struct {
+	engine *engine.Engine
+	reader *bufio.Reader
+}
+
+func NewMenu(e *engine.Engine) *Menu {
+	return &Menu{
+		engine: e,
+		reader: bufio.NewReader(os.Stdin),
+	}
+}
+
+func (m *Menu) Run() {
+	for {
+		err := m.engine.EnforceRetention()
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+		}
+
+		fmt.Println()
+		fmt.Println(" 1 - Write Point")
+		fmt.Println(" 2 - Delete Range")
+		fmt.Println(" 3 - List")
+		fmt.Println(" 4 - Aggregate")
+		fmt.Println(" 5 - List Measurements")
+		fmt.Println(" 6 - List Tag Keys")
+		fmt.Println(" 7 - List Tag Values")
+		fmt.Println(" 8 - List Series")
+		fmt.Println(" 9 - Run Query")
+		fmt.Println("\n 0 - Exit")
+
+		choice := m.readUint("\nEnter your choice: ")
+		switch choice {
+		case 0:
+			fmt.Println("Exiting the program.")
+			return
+		case 1:
+			m.putPoint()
+		case 2:
+			m.deleteRange()
+		case 3:
+			m.listRange()
+		case 4:
+			m.aggregateRange()
+		case 5:
+			printList(m.engine.Measurements(), "No measurements found")
+		case 6:
+			measurementName := m.readString("Enter measurement name:")
+			printList(m.engine.TagKeys(measurementName), "No tags found")
+		case 7:
+			measurementName := m.readString("Enter measurement name:")
+			key := m.readString("Enter tag name:")
+			printList(m.engine.TagValues(measurementName, key), "No values found")
+		case 8:
+			m.listSeries()
+		case 9:
+			m.runQuery()
+		default:
+			fmt.Printf("\nInvalid choice, please try again!\n\n")
+		}
+	}
+}
+
+func (m *Menu) putPoint() {
+	measurementName := m.readString("Enter time series measurement name")
+	tags := m.readTags()
+	value := m.readFloat("Enter point value: ")
+	timestamp, ok := m.readOptionalUint(
+		fmt.Sprintf("Enter point timestamp in %s (empty for current time):", m.engine.Precision()))
+	if !ok {
+		timestamp = m.engine.Precision().Now()
+	}
+	point := internal.NewPointAt(value, timestamp)
+
+	err := m.engine.Put(internal.NewTimeSeries(measurementName, tags), point)
+
+	if err != nil {
+		fmt.Printf("\n[ERROR]: %v\n\n", err)
+	}
+}
+
+func (m *Menu) deleteRange() {
+	measurementName := m.readString("Enter time series measurement name: ")
+	tags := m.readTags()
+	minTimestamp, maxTimestamp := m.readMinMaxTimestamp()
+
+	err := m.engine.DeleteRange(
+		internal.NewTimeSeries(measurementName, tags),
+		minTimestamp, maxTimestamp,
+	)
+	if err != nil {
+		fmt.Printf("\n[ERROR]: %v\n\n", err)
+	}
+}
+
+func (m *Menu) listRange() {
+	measurementName := m.readString("Enter time series measurement name: ")
+	tags := m.readTags()
+	minTimestamp, maxTimestamp := m.readMinMaxTimestamp()
+
+	it, err := m.engine.Iterator(
+		internal.NewTimeSeries(measurementName, tags),
+		minTimestamp, maxTimestamp,
+	)
+	if err != nil {
+		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return
+	}
+	defer it.Close()
+
+	fmt.Println()
+	found := false
+	for it.Next() {
+		fmt.Println(it.At())
+		found = true
+	}
+	if err = it.Err(); err != nil {
+		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return
+	}
+	if !found {
+		fmt.Println("No points found")
+		return
+	}
+	fmt.Println()
+}
+
+func (m *Menu) aggregateRange() {
+	measurementName := m.readString("Enter time series measurement name: ")
+	tags := m.readTags()
+	minTimestamp, maxTimestamp := m.readMinMaxTimestamp()
+
+	// Getting aggregation function:
+	aggregationFunction := m.readAggregationFunc()
+
+	result, err := m.engine.Aggregate(
+		internal.NewTimeSeries(measurementName, tags),
+		minTimestamp, maxTimestamp,
+		aggregationFunction,
+	)
+	if err != nil {
+		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return
+	}
+
+	if !result.Found {
+		fmt.Println()
+		fmt.Printf("No points found\n")
+		return
+	}
+	switch result.Function {
+	case engine.MIN:
+		fmt.Printf("\nMinimum value is %.2f\n\n", result.Value)
+	case engine.MAX:
+		fmt.Printf("\nMaximum value is %.2f\n\n", result.Value)
+	default:
+		fmt.Printf("\n%s value is %.2f\n\n", result.Function, result.Value)
+	}
+}
+
+func (m *Menu) listSeries() {
+	measurementName := m.readString("Enter measurement name:")
+	matchers := m.readMatchers()
+
+	series := m.engine.Series(measurementName, matchers...)
+	fmt.Println()
+	if len(series) == 0 {
+		fmt.Println("No series found")
+		return
+	}
+	for _, ts := range series {
+		id, _ := m.engine.SeriesID(ts)
+		fmt.Printf("%6d  %s\n", id, ts.Hash)
+	}
+	fmt.Println()
+}
+
+func (m *Menu) runQuery() {
+	statement := m.readString("Enter query:")
+
+	result, err := m.engine.Execute(statement)
+	var syntaxErr *query.Error
+	if errors.As(err, &syntaxErr) {
+		// points at the error under the statement
+		column := utf8.RuneCountInString(statement[:syntaxErr.Pos])
+		fmt.Printf("\n%s\n%s^\n[ERROR]: %v\n\n", statement, strings.Repeat(" ", column), err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return
+	}
+
+	fmt.Println()
+	if len(result.Series) == 0 {
+		fmt.Println("No points found")
+		return
+	}
+	for _, series := range result.Series {
+		// tags are kept in their order, group by tags are in the requested one
+		fmt.Println(seriesLabel(series.Measurement, series.Tags))
+		for _, row := range series.Rows {
+			if row.Found {
+				fmt.Printf("%20d  %v\n", row.Timestamp, row.Value)
+			} else {
+				fmt.Printf("%20d  -\n", row.Timestamp)
+			}
+		}
+		fmt.Println()
+	}
+}
+
+func printList(items []string, empty string) {
+	fmt.Println()
+	if len(items) == 0 {
+		fmt.Println(empty)
+		return
+	}
+	for _, item := range items {
+		fmt.Println(item)
+	}
+	fmt.Println()
+}
+
+// readMatchers reads space separated tag filters, such as host=a, host!=a or host=~regex
+func (m *Menu) readMatchers() []*index.Matcher {
+	for {
+		fmt.Printf("Enter tag filters separated by spaces (empty for all series): ")
+		input, err := m.reader.ReadString('\n')
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+
+		matchers := make([]*index.Matcher, 0)
+		for _, field := range strings.Fields(input) {
+			matcher, err := index.ParseMatcher(field)
+			if err != nil {
+				fmt.Printf("\n[ERROR]: %v\n\n", err)
+				matchers = nil
+				break
+			}
+			matchers = append(matchers, matcher)
+		}
+		if matchers != nil {
+			return matchers
+		}
+	}
+}
+
+func (m *Menu) readString(message string) string {
+	for {
+		fmt.Printf("%s ", message)
+		input, err := m.reader.ReadString('\n')
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			fmt.Printf("\nEnter something!\n\n")
+			continue
+		}
+		return input
+	}
+}
+
+func (m *Menu) readUint(message string) uint64 {
+	for {
+		fmt.Printf("%s ", message)
+		input, err := m.reader.ReadString('\n')
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			fmt.Printf("\nEnter something!\n\n")
+			continue
+		}
+		parsedNumber, err := strconv.ParseUint(input, 10, 64)
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+		return parsedNumber
+	}
+}
+
+// readOptionalUint returns false if user entered nothing
+func (m *Menu) readOptionalUint(message string) (uint64, bool) {
+	for {
+		fmt.Printf("%s ", message)
+		input, err := m.reader.ReadString('\n')
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return 0, false
+		}
+		parsedNumber, err := strconv.ParseUint(input, 10, 64)
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+		return parsedNumber, true
+	}
+}
+
+func (m *Menu) readFloat(message string) float64 {
+	for {
+		fmt.Printf("%s ", message)
+		input, err := m.reader.ReadString('\n')
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			fmt.Printf("\nEnter something!\n\n")
+			continue
+		}
+		parsedFloat, err := strconv.ParseFloat(input, 64)
+		if err != nil {
+			fmt.Printf("\n[ERROR]: %v\n\n", err)
+			continue
+		}
+		return parsedFloat
+	}
+}
+
+func (m *Menu) readTags() internal.Tags {
+	var numberOfTags uint64
+	for {
+		numberOfTags = m.readUint("Enter number of tags in time series:")
+		if numberOfTags != 0 {
+			break
+		}
+		fmt.Printf("\nEnter a postive integer!\n\n")
+	}
+	tags := make(internal.Tags, 0)
+	for i := 0; i < int(numberOfTags); i++ {
+		name := m.readString("Enter tag name:")
+		value := m.readString("Enter tag value:")
+		tags = append(tags, internal.NewTag(name, value))
+	}
+	tags.Sort()
+	return tags
+}
+
+func (m *Menu) readMinMaxTimestamp() (uint64, uint64) {
+	minTimestamp := m.readUint("Enter minimum timestamp:")
+	for {
+		maxTimestamp := m.readUint("Enter maximum timestamp:")
+		if maxTimestamp >= minTimestamp {
+			return minTimestamp, maxTimestamp
+		}
+		fmt.Printf("\nMaximum timestamp can't be smaller than minimum!\n\n")
+	}
+}
+
+func (m *Menu) readAggregationFunc() string {
+	aggFunctions := engine.GetAllAggregationFunctions()
+	maxIndex := uint64(len(aggFunctions))
+	fmt.Printf("Select aggregation function:\n\n")
+	for i, function := range aggFunctions {
+		fmt.Printf(" %d - %s\n", i+1, function)
+	}
+	fmt.Println()
+	for {
+		userInput := m.readUint(">>")
+		if 1 <= userInput && userInput <= maxIndex {
+			return aggFunctions[userInput-1]
+		}
+		fmt.Printf("\nYou must select a number from range [%d, %d]!\n\n", 1, maxIndex)
+	}
+}
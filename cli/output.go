@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time-series-engine/internal"
+)
+
+// Output formats of commands
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+	// FormatLine is line protocol, accepted only by export, which can be imported again
+	FormatLine = "line"
+)
+
+var formats = []string{FormatTable, FormatCSV, FormatJSON, FormatLine}
+
+// table writes rows of values under named columns. Values are strings, integers, floats,
+// or nil for missing ones, which are shown as "-" in tables, empty in CSV and null in JSON.
+type table interface {
+	Row(values ...any) error
+	// Close writes what is still buffered, rows can't be added after it
+	Close() error
+}
+
+func newTable(format string, w io.Writer, columns ...string) (table, error) {
+	switch format {
+	case FormatTable:
+		t := &textTable{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+		header := make([]any, len(columns))
+		for i, c := range columns {
+			header[i] = strings.ToUpper(c)
+		}
+		return t, t.Row(header...)
+	case FormatCSV:
+		t := &csvTable{w: csv.NewWriter(w)}
+		return t, t.w.Write(columns)
+	case FormatJSON:
+		return &jsonTable{w: w, columns: columns}, nil
+	}
+	return nil, fmt.Errorf("unsupported output format %q, expected one of %s", format, strings.Join(formats[:3], ", "))
+}
+
+type textTable struct {
+	w *tabwriter.Writer
+}
+
+func (t *textTable) Row(values ...any) error {
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i] = formatValue(v, "-")
+	}
+	_, err := fmt.Fprintln(t.w, strings.Join(fields, "\t"))
+	return err
+}
+
+func (t *textTable) Close() error {
+	return t.w.Flush()
+}
+
+type csvTable struct {
+	w *csv.Writer
+}
+
+func (t *csvTable) Row(values ...any) error {
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i] = formatValue(v, "")
+	}
+	return t.w.Write(fields)
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// jsonTable streams an array of objects, one per row, with keys in order of the columns
+type jsonTable struct {
+	w       io.Writer
+	columns []string
+	rows    int
+}
+
+func (t *jsonTable) Row(values ...any) error {
+	var b bytes.Buffer
+	if t.rows == 0 {
+		b.WriteString("[\n  {")
+	} else {
+		b.WriteString(",\n  {")
+	}
+	for i, v := range values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		key, _ := json.Marshal(t.columns[i])
+		b.Write(key)
+		b.WriteString(": ")
+
+		// NaN and infinities have no JSON representation
+		if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			v = nil
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(value)
+	}
+	b.WriteString("}")
+	t.rows++
+
+	_, err := t.w.Write(b.Bytes())
+	return err
+}
+
+func (t *jsonTable) Close() error {
+	end := "\n]\n"
+	if t.rows == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(t.w, end)
+	return err
+}
+
+func formatValue(v any, missing string) string {
+	switch v := v.(type) {
+	case nil:
+		return missing
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// seriesLabel names a series by its measurement and tags, in their order
+func seriesLabel(measurement string, tags internal.Tags) string {
+	label := measurement
+	for _, tag := range tags {
+		label += fmt.Sprintf(",%s=%s", tag.Name, tag.Value)
+	}
+	return label
+}
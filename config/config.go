@@ -3,17 +3,22 @@ package config
 import (
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"io"
 	"os"
 	"strings"
 )
 
+const DefaultPath = "./config/sys_config.yaml"
+
 type EngineConfig struct {
 	RetentionPeriod int64  `yaml:"retention_period"`
 	PeriodType      string `yaml:"period_type"`
+	Precision       string `yaml:"precision"` // unit of timestamps: s, ms, us or ns
 }
 
 type MemTableConfig struct {
-	MaxSize uint64 `yaml:"max_size"`
+	MaxSize      uint64 `yaml:"max_size"`
+	MaxImmutable uint64 `yaml:"max_immutable"` // full memtables waiting to be flushed before writers block
 }
 
 type PageConfig struct {
@@ -22,23 +27,83 @@ type PageConfig struct {
 	BufferPoolCapacity uint64 `yaml:"buffer_pool_capacity"`
 }
 
+// Value encodings of parquets, named as codecs of value pages
+const (
+	ValueEncodingScaled   = "scaled" // rounded to 5 decimals
+	ValueEncodingLossless = "lossless"
+)
+
+// Timestamp encodings of parquets, named as codecs of timestamp pages
+const (
+	TimestampEncodingVarint       = "varint"
+	TimestampEncodingDeltaOfDelta = "delta_of_delta"
+)
+
+// Delete encodings of parquets, named as codecs of delete pages
+const (
+	DeleteEncodingBitmap    = "bitmap"
+	DeleteEncodingRunLength = "rle"
+)
+
+// Compressions of column pages of cold windows
+const (
+	CompressionNone  = "none"
+	CompressionFlate = "flate"
+)
+
+// Sync modes of the write ahead log
+const (
+	SyncModeAlways   = "always"
+	SyncModeInterval = "interval"
+	SyncModeNever    = "never"
+)
+
+// Recovery modes of the write ahead log
+const (
+	RecoveryModeTruncate = "truncate"
+	RecoveryModeSkip     = "skip"
+)
+
 type ParquetConfig struct {
-	PageSize     uint64 `yaml:"page_size"`
-	RowGroupSize uint64 `yaml:"row_group_size"`
+	PageSize          uint64 `yaml:"page_size"`
+	RowGroupSize      uint64 `yaml:"row_group_size"`
+	ValueEncoding     string `yaml:"value_encoding"`     // scaled or lossless
+	TimestampEncoding string `yaml:"timestamp_encoding"` // varint or delta_of_delta
+	DeleteEncoding    string `yaml:"delete_encoding"`    // bitmap or rle
+	// Compression of timestamp and value pages of windows which ended, applied by compaction
+	Compression string `yaml:"compression"` // none or flate
+	// MeasurementValueEncodings overrides value encoding of series of the measurements
+	MeasurementValueEncodings map[string]string `yaml:"measurement_value_encodings,omitempty"`
+}
+
+// MeasurementValueEncoding returns value encoding of series of the measurement
+func (c *ParquetConfig) MeasurementValueEncoding(measurement string) string {
+	if encoding, ok := c.MeasurementValueEncodings[measurement]; ok {
+		return encoding
+	}
+	return c.ValueEncoding
 }
 
 type WALConfig struct {
 	LogsDirPath        string `yaml:"logs_dir_path"`
 	UnstagedOffset     uint64 `yaml:"unstaged_offset"`
+	UnstagedSegment    string `yaml:"unstaged_segment"` // segment of unstaged offset, first segment if empty
 	SegmentSizeInPages uint64 `yaml:"segment_size_in_pages"`
+	SyncMode           string `yaml:"sync_mode"`     // always, interval or never
+	SyncInterval       uint64 `yaml:"sync_interval"` // in milliseconds, used by interval sync mode
+	RecoveryMode       string `yaml:"recovery_mode"` // truncate or skip corrupted entries on recovery
 }
 
 type TimeWindowConfig struct {
-	Duration       uint64 `yaml:"duration"`
+	Duration       uint64 `yaml:"duration"` // in seconds, regardless of timestamp precision
 	Start          uint64 `yaml:"start"`
 	WindowsDirPath string `yaml:"windows_dir_path"`
 }
 
+type ServerConfig struct {
+	Address string `yaml:"address"`
+}
+
 type Config struct {
 	EngineConfig     `yaml:"engine"`
 	MemTableConfig   `yaml:"memtable"`
@@ -46,14 +111,25 @@ type Config struct {
 	ParquetConfig    `yaml:"parquet"`
 	TimeWindowConfig `yaml:"time_window"`
 	WALConfig        `yaml:"wal"`
+	ServerConfig     `yaml:"server"`
+
+	// path is the file the configuration is persisted to, empty for in-memory configurations
+	path string
 }
 
 func LoadConfiguration() *Config {
-	fmt.Println("Loading configuration...")
+	return LoadConfigurationFrom(DefaultPath)
+}
 
-	configFile, err := os.Open("./config/sys_config.yaml")
+// LoadConfigurationFrom reads configuration from the given yaml file, fixes
+// invalid values and writes the result back to the same file. Progress and
+// fixed values are reported to stderr, leaving stdout to the output of commands.
+func LoadConfigurationFrom(path string) *Config {
+	fmt.Fprintln(os.Stderr, "Loading configuration...")
+
+	configFile, err := os.Open(path)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 	}
 	defer configFile.Close()
 
@@ -61,126 +137,194 @@ func LoadConfiguration() *Config {
 	decoder := yaml.NewDecoder(configFile)
 	err = decoder.Decode(&sysConfig)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 	}
 
 	// set default values if user messed up something
-	sysConfig.setDefaults()
+	sysConfig.setDefaults(os.Stderr)
 
-	sysConfig.Save("./config/sys_config.yaml")
+	sysConfig.path = path
+	sysConfig.Save(path)
 
-	fmt.Println("Configuration is loaded.")
+	fmt.Fprintln(os.Stderr, "Configuration is loaded.")
 
 	return &sysConfig
 }
 
+// Default returns configuration with all values set to defaults, which is not
+// bound to any file, so runtime state changes are kept only in memory
+func Default() *Config {
+	var c Config
+	c.setDefaults(io.Discard)
+	return &c
+}
+
+// Path returns the file configuration is persisted to
+func (c *Config) Path() string {
+	return c.path
+}
+
 func (c *Config) Save(filepath string) {
 	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 	}
 	defer file.Close()
 
 	encoder := yaml.NewEncoder(file)
 	err = encoder.Encode(c)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
 
-// setDefaults will fill empty and incorrect values with default ones
-func (c *Config) setDefaults() {
+// setDefaults will fill empty and incorrect values with default ones, reporting every change to w
+func (c *Config) setDefaults(w io.Writer) {
 	// MemTable
 	mc := &c.MemTableConfig
 	if mc.MaxSize < 2 || mc.MaxSize > 10000 {
 		mc.MaxSize = 1000
-		fmt.Printf("Invalid Memtable max_size value. Set to default: %d\n", mc.MaxSize)
+		fmt.Fprintf(w, "Invalid Memtable max_size value. Set to default: %d\n", mc.MaxSize)
+	}
+	if mc.MaxImmutable < 1 || mc.MaxImmutable > 16 {
+		mc.MaxImmutable = 2
+		fmt.Fprintf(w, "Invalid Memtable max_immutable value. Set to default: %d\n", mc.MaxImmutable)
 	}
 
 	// Engine
 	ec := &c.EngineConfig
 	if ec.RetentionPeriod < 1 || ec.RetentionPeriod > 60 {
 		ec.RetentionPeriod = 2
-		fmt.Printf("Invalid Engine retention_period value. Set to default: %d\n", ec.RetentionPeriod)
+		fmt.Fprintf(w, "Invalid Engine retention_period value. Set to default: %d\n", ec.RetentionPeriod)
 	}
 	if ec.PeriodType != "minute" && ec.PeriodType != "hour" && ec.PeriodType != "day" {
 		ec.PeriodType = "minute"
-		fmt.Printf("Invalid Engine period_type value. Set to default: %s\n", ec.PeriodType)
+		fmt.Fprintf(w, "Invalid Engine period_type value. Set to default: %s\n", ec.PeriodType)
+	}
+	if ec.Precision != "s" && ec.Precision != "ms" && ec.Precision != "us" && ec.Precision != "µs" && ec.Precision != "ns" {
+		ec.Precision = "s"
+		fmt.Fprintf(w, "Invalid Engine precision value. Set to default: %s\n", ec.Precision)
 	}
 
 	// Page
 	pc := &c.PageConfig
 	if pc.PageSize < 256 || pc.PageSize > 16000 {
 		pc.PageSize = 1000
-		fmt.Printf("Invalid Page page_size value. Set to default: %d\n", pc.PageSize)
+		fmt.Fprintf(w, "Invalid Page page_size value. Set to default: %d\n", pc.PageSize)
 	}
 	if pc.FilenameLength < 1 || pc.FilenameLength > 10 {
 		pc.FilenameLength = 4
-		fmt.Printf("Invalid Page filename_length value. Set to default: %d\n", pc.FilenameLength)
+		fmt.Fprintf(w, "Invalid Page filename_length value. Set to default: %d\n", pc.FilenameLength)
 	}
 	if pc.BufferPoolCapacity < 1 || pc.BufferPoolCapacity > 10_000 {
 		pc.BufferPoolCapacity = 100
-		fmt.Printf("Invalid Page buffer_pool_capacity value. Set to default: %d\n", pc.BufferPoolCapacity)
+		fmt.Fprintf(w, "Invalid Page buffer_pool_capacity value. Set to default: %d\n", pc.BufferPoolCapacity)
 	}
 
 	// Parquet
 	pq := &c.ParquetConfig
 	if pq.PageSize < 256 || pq.PageSize > 16000 {
 		pq.PageSize = 1000
-		fmt.Printf("Invalid Parquet page_size value. Set to default: %d\n", pq.PageSize)
+		fmt.Fprintf(w, "Invalid Parquet page_size value. Set to default: %d\n", pq.PageSize)
 	}
 	if pq.RowGroupSize < 1 || pq.RowGroupSize > 100 {
 		pq.RowGroupSize = 3
-		fmt.Printf("Invalid Parquet row_group_size value. Set to default: %d\n", pq.RowGroupSize)
+		fmt.Fprintf(w, "Invalid Parquet row_group_size value. Set to default: %d\n", pq.RowGroupSize)
+	}
+	if pq.ValueEncoding != ValueEncodingScaled && pq.ValueEncoding != ValueEncodingLossless {
+		pq.ValueEncoding = ValueEncodingScaled
+		fmt.Fprintf(w, "Invalid Parquet value_encoding value. Set to default: %s\n", pq.ValueEncoding)
+	}
+	if pq.TimestampEncoding != TimestampEncodingVarint && pq.TimestampEncoding != TimestampEncodingDeltaOfDelta {
+		pq.TimestampEncoding = TimestampEncodingDeltaOfDelta
+		fmt.Fprintf(w, "Invalid Parquet timestamp_encoding value. Set to default: %s\n", pq.TimestampEncoding)
+	}
+	if pq.DeleteEncoding != DeleteEncodingBitmap && pq.DeleteEncoding != DeleteEncodingRunLength {
+		pq.DeleteEncoding = DeleteEncodingRunLength
+		fmt.Fprintf(w, "Invalid Parquet delete_encoding value. Set to default: %s\n", pq.DeleteEncoding)
+	}
+	if pq.Compression != CompressionNone && pq.Compression != CompressionFlate {
+		pq.Compression = CompressionNone
+		fmt.Fprintf(w, "Invalid Parquet compression value. Set to default: %s\n", pq.Compression)
+	}
+	for measurement, encoding := range pq.MeasurementValueEncodings {
+		if encoding != ValueEncodingScaled && encoding != ValueEncodingLossless {
+			delete(pq.MeasurementValueEncodings, measurement)
+			fmt.Fprintf(w, "Invalid Parquet value encoding of measurement %s. Removed: %s\n", measurement, encoding)
+		}
 	}
 
 	// Time Window
 	tw := &c.TimeWindowConfig
 	if tw.Duration < 1 || tw.Duration > 86400 {
 		tw.Duration = 90
-		fmt.Printf("Invalid TimeWindow duration value. Set to default: %d\n", tw.Duration)
+		fmt.Fprintf(w, "Invalid TimeWindow duration value. Set to default: %d\n", tw.Duration)
 	}
 	if strings.TrimSpace(tw.WindowsDirPath) == "" {
 		tw.WindowsDirPath = "./db/data"
-		fmt.Printf("Empty TimeWindow windows_dir_path. Set to default: %s\n", tw.WindowsDirPath)
+		fmt.Fprintf(w, "Empty TimeWindow windows_dir_path. Set to default: %s\n", tw.WindowsDirPath)
 	}
 
 	// WAL
-	w := &c.WALConfig
-	if strings.TrimSpace(w.LogsDirPath) == "" {
-		w.LogsDirPath = "./db/logs"
-		fmt.Printf("Empty WAL logs_dir_path. Set to default: %s\n", w.LogsDirPath)
+	wc := &c.WALConfig
+	if strings.TrimSpace(wc.LogsDirPath) == "" {
+		wc.LogsDirPath = "./db/logs"
+		fmt.Fprintf(w, "Empty WAL logs_dir_path. Set to default: %s\n", wc.LogsDirPath)
+	}
+	if wc.SegmentSizeInPages < 1 || wc.SegmentSizeInPages > 512 {
+		wc.SegmentSizeInPages = 2
+		fmt.Fprintf(w, "Invalid WAL segment_size_in_pages value. Set to default: %d\n", wc.SegmentSizeInPages)
 	}
-	if w.SegmentSizeInPages < 1 || w.SegmentSizeInPages > 512 {
-		w.SegmentSizeInPages = 2
-		fmt.Printf("Invalid WAL segment_size_in_pages value. Set to default: %d\n", w.SegmentSizeInPages)
+	if wc.SyncMode != SyncModeAlways && wc.SyncMode != SyncModeInterval && wc.SyncMode != SyncModeNever {
+		wc.SyncMode = SyncModeAlways
+		fmt.Fprintf(w, "Invalid WAL sync_mode value. Set to default: %s\n", wc.SyncMode)
+	}
+	if wc.SyncInterval < 1 || wc.SyncInterval > 60_000 {
+		wc.SyncInterval = 100
+		fmt.Fprintf(w, "Invalid WAL sync_interval value. Set to default: %d\n", wc.SyncInterval)
+	}
+	if wc.RecoveryMode != RecoveryModeTruncate && wc.RecoveryMode != RecoveryModeSkip {
+		wc.RecoveryMode = RecoveryModeTruncate
+		fmt.Fprintf(w, "Invalid WAL recovery_mode value. Set to default: %s\n", wc.RecoveryMode)
+	}
+
+	// Server
+	sc := &c.ServerConfig
+	if strings.TrimSpace(sc.Address) == "" {
+		sc.Address = "localhost:8086"
+		fmt.Fprintf(w, "Empty Server address. Set to default: %s\n", sc.Address)
 	}
 }
 
 func (c *Config) SetUnstagedOffset(offset uint64) error {
 	c.WALConfig.UnstagedOffset = offset
+	return c.persist()
+}
 
-	updatedFile, err := yaml.Marshal(c)
-	if err != nil {
-		return fmt.Errorf("failed to encode updated YAML: %w", err)
-	}
-
-	if err := os.WriteFile("./config/sys_config.yaml", updatedFile, 0644); err != nil {
-		return fmt.Errorf("failed to write updated config file: %w", err)
-	}
-
-	return nil
+// SetUnstagedPosition records position in the log of the first entry which is not flushed to disk yet
+func (c *Config) SetUnstagedPosition(segment string, offset uint64) error {
+	c.WALConfig.UnstagedSegment = segment
+	c.WALConfig.UnstagedOffset = offset
+	return c.persist()
 }
 
 func (c *Config) SetTimeWindowStart(start uint64) error {
 	c.TimeWindowConfig.Start = start
+	return c.persist()
+}
+
+// persist writes configuration back to its file, if it has one
+func (c *Config) persist() error {
+	if c.path == "" {
+		return nil
+	}
 
 	updatedFile, err := yaml.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("failed to encode updated YAML: %w", err)
 	}
 
-	if err := os.WriteFile("./config/sys_config.yaml", updatedFile, 0644); err != nil {
+	if err := os.WriteFile(c.path, updatedFile, 0644); err != nil {
 		return fmt.Errorf("failed to write updated config file: %w", err)
 	}
 
@@ -0,0 +1,255 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk"
+	"time-series-engine/internal/index"
+)
+
+// Fill modes of empty buckets:
+const (
+	FillNone     = "none"     // empty buckets are left out
+	FillNull     = "null"     // empty buckets have no value
+	FillPrevious = "previous" // value of the closest earlier bucket with points
+	FillLinear   = "linear"   // interpolated between the closest buckets with points on both sides
+)
+
+// maxBuckets limits number of buckets returned when empty ones are filled
+const maxBuckets = 100_000
+
+// Bucket is aggregation of points with timestamps in [Start, Start+interval)
+type Bucket struct {
+	Start uint64
+	Value float64
+	// Found is false for buckets without a value, either because they are empty,
+	// or because fill mode had nothing to fill them with
+	Found bool
+}
+
+func GetAllFillModes() []string {
+	return []string{FillNone, FillNull, FillPrevious, FillLinear}
+}
+
+// GroupBuckets are buckets of all selected series sharing values of the group by tags
+type GroupBuckets struct {
+	// Tags are the group by tags in the requested order, series without a tag have an empty value
+	Tags    internal.Tags
+	Buckets []*Bucket
+}
+
+// bucketPart is aggregation of points of one bucket, which may be merged with parts of other series
+type bucketPart struct {
+	start      uint64
+	aggregator disk.Aggregator
+}
+
+// AggregateBuckets splits [minTimestamp, maxTimestamp] into buckets of interval timestamp units,
+// aligned to multiples of interval, and applies the aggregation function to points of the
+// time series in each of them. Empty buckets are handled according to the fill mode.
+func (e *Engine) AggregateBuckets(
+	ts *internal.TimeSeries,
+	minTimestamp, maxTimestamp uint64,
+	interval uint64,
+	function string,
+	fill string,
+) ([]*Bucket, error) {
+	first, last, err := checkBuckets(minTimestamp, maxTimestamp, interval, function, fill)
+	if err != nil {
+		return nil, err
+	}
+	err = e.checkRetentionPeriod()
+	if err != nil {
+		return nil, err
+	}
+
+	e.diskMu.RLock()
+	parts, err := e.bucketParts(ts, minTimestamp, maxTimestamp, interval, function)
+	e.diskMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return newBuckets(parts, first, last, interval, fill), nil
+}
+
+// AggregateGroupBuckets is AggregateBuckets of series of the measurement selected by the tag matchers,
+// split into groups by values of the groupBy tags as in AggregateGroupBy. Groups without points
+// are left out, the rest are sorted by their tag values.
+func (e *Engine) AggregateGroupBuckets(
+	measurement string, matchers []*index.Matcher, groupBy []string,
+	minTimestamp, maxTimestamp uint64,
+	interval uint64,
+	function string,
+	fill string,
+) ([]*GroupBuckets, error) {
+	first, last, err := checkBuckets(minTimestamp, maxTimestamp, interval, function, fill)
+	if err != nil {
+		return nil, err
+	}
+	err = e.checkRetentionPeriod()
+	if err != nil {
+		return nil, err
+	}
+
+	e.diskMu.RLock()
+	defer e.diskMu.RUnlock()
+
+	parts := make(map[string][]*bucketPart)
+	groups := make(map[string]internal.Tags)
+	for _, ts := range e.Series(measurement, matchers...) {
+		seriesParts, err := e.bucketParts(ts, minTimestamp, maxTimestamp, interval, function)
+		if err != nil {
+			return nil, err
+		}
+		if len(seriesParts) == 0 {
+			continue
+		}
+
+		tags := groupTags(ts, groupBy)
+		key := groupKey(tags)
+		parts[key] = mergeBucketParts(parts[key], seriesParts)
+		groups[key] = tags
+	}
+
+	keys := make([]string, 0, len(parts))
+	for key := range parts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*GroupBuckets, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &GroupBuckets{Tags: groups[key], Buckets: newBuckets(parts[key], first, last, interval, fill)})
+	}
+	return result, nil
+}
+
+// checkBuckets validates arguments of bucket aggregations, returning starts of the first and the last bucket
+func checkBuckets(minTimestamp, maxTimestamp, interval uint64, function, fill string) (uint64, uint64, error) {
+	if interval == 0 {
+		return 0, 0, fmt.Errorf("bucket interval must be positive")
+	}
+	if minTimestamp > maxTimestamp {
+		return 0, 0, fmt.Errorf("minimum timestamp %d is after maximum %d", minTimestamp, maxTimestamp)
+	}
+	_, err := disk.NewAggregator(function)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !slices.Contains(GetAllFillModes(), fill) {
+		return 0, 0, fmt.Errorf("unknown fill mode: %s", fill)
+	}
+
+	first := minTimestamp - minTimestamp%interval
+	last := maxTimestamp - maxTimestamp%interval
+	if fill != FillNone && (last-first)/interval >= maxBuckets {
+		return 0, 0, fmt.Errorf("range [%d, %d] has more than %d buckets of %d", minTimestamp, maxTimestamp, maxBuckets, interval)
+	}
+	return first, last, nil
+}
+
+// bucketParts aggregates points of the time series in each non empty bucket, must be called with diskMu held
+func (e *Engine) bucketParts(ts *internal.TimeSeries, minTimestamp, maxTimestamp, interval uint64, function string) ([]*bucketPart, error) {
+	it, err := e.iterator(ts, minTimestamp, maxTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	// points are sorted, so each bucket is a run of consecutive points
+	parts := make([]*bucketPart, 0)
+	for it.Next() {
+		p := it.At()
+		start := p.Timestamp - p.Timestamp%interval
+		if len(parts) == 0 || parts[len(parts)-1].start != start {
+			aggregator, _ := disk.NewAggregator(function)
+			parts = append(parts, &bucketPart{start: start, aggregator: aggregator})
+		}
+		parts[len(parts)-1].aggregator.Add(p)
+	}
+	if err = it.Err(); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// mergeBucketParts merges two lists of parts sorted by start, merging parts of the same bucket
+func mergeBucketParts(a, b []*bucketPart) []*bucketPart {
+	merged := make([]*bucketPart, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].start < b[0].start:
+			merged, a = append(merged, a[0]), a[1:]
+		case a[0].start > b[0].start:
+			merged, b = append(merged, b[0]), b[1:]
+		default:
+			a[0].aggregator.Merge(b[0].aggregator)
+			merged, a, b = append(merged, a[0]), a[1:], b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// newBuckets returns results of the parts, with empty buckets from first to last handled by the fill mode
+func newBuckets(parts []*bucketPart, first, last, interval uint64, fill string) []*Bucket {
+	buckets := make([]*Bucket, 0, len(parts))
+	for _, part := range parts {
+		value, found := part.aggregator.Result()
+		buckets = append(buckets, &Bucket{Start: part.start, Value: value, Found: found})
+	}
+
+	if fill == FillNone {
+		return buckets
+	}
+	return fillBuckets(buckets, first, last, interval, fill)
+}
+
+// fillBuckets returns all buckets from first to last, filling the missing ones
+func fillBuckets(buckets []*Bucket, first, last, interval uint64, fill string) []*Bucket {
+	count := (last-first)/interval + 1
+	filled := make([]*Bucket, 0, count)
+
+	next := 0
+	for start := first; ; start += interval {
+		if next < len(buckets) && buckets[next].Start == start {
+			filled = append(filled, buckets[next])
+			next++
+		} else {
+			filled = append(filled, &Bucket{Start: start})
+		}
+		if start == last {
+			break
+		}
+	}
+
+	switch fill {
+	case FillPrevious:
+		for i := 1; i < len(filled); i++ {
+			if !filled[i].Found && filled[i-1].Found {
+				filled[i].Value = filled[i-1].Value
+				filled[i].Found = true
+			}
+		}
+	case FillLinear:
+		previous := -1
+		for i, bucket := range filled {
+			if !bucket.Found {
+				continue
+			}
+			if previous >= 0 {
+				from, to := filled[previous].Value, bucket.Value
+				for j := previous + 1; j < i; j++ {
+					filled[j].Value = from + (to-from)*float64(j-previous)/float64(i-previous)
+					filled[j].Found = true
+				}
+			}
+			previous = i
+		}
+	}
+
+	return filled
+}
@@ -1,59 +1,129 @@
 package engine
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
-	"time"
+	"sync"
 	"time-series-engine/config"
 	"time-series-engine/internal"
 	"time-series-engine/internal/disk"
+	"time-series-engine/internal/disk/chunk"
 	"time-series-engine/internal/disk/entry"
 	"time-series-engine/internal/disk/page"
 	"time-series-engine/internal/disk/parquet"
 	"time-series-engine/internal/disk/row_group"
 	"time-series-engine/internal/disk/time_window"
 	"time-series-engine/internal/disk/write_ahead_log"
+	"time-series-engine/internal/index"
+	"time-series-engine/internal/line_protocol"
 	"time-series-engine/internal/memory"
 )
 
-// Aggregation functions:
+// Aggregation functions, besides percentiles:
 const (
-	MIN  = "Min"
-	MAX  = "Max"
-	MEAN = "Mean"
-	AVG  = "Average"
+	MIN    = "Min"
+	MAX    = "Max"
+	MEAN   = "Mean"
+	AVG    = "Average"
+	SUM    = "Sum"
+	COUNT  = "Count"
+	FIRST  = "First"
+	LAST   = "Last"
+	SPREAD = "Spread" // difference between maximum and minimum
+	STDDEV = "Stddev" // sample standard deviation
+	MEDIAN = "Median"
 )
 
+// lineProtocolBatchSize is number of parsed points kept in memory during import
+const lineProtocolBatchSize = 1000
+
 func GetAllAggregationFunctions() []string {
-	return []string{MIN, MAX, MEAN, AVG}
+	return []string{MIN, MAX, MEAN, AVG, SUM, COUNT, FIRST, LAST, SPREAD, STDDEV, MEDIAN, Percentile(95), Percentile(99)}
 }
 
-var reader = bufio.NewReader(os.Stdin)
+// Percentile returns aggregation function of the p-th percentile, p is in [0, 100]
+func Percentile(p float64) string {
+	return "P" + strconv.FormatFloat(p, 'f', -1, 64)
+}
 
+// Engine is safe for concurrent use. Writers (PutBatch and DeleteRange) are serialized, so
+// points enter the memtable in the same order as they are appended to the write ahead log.
+// Readers run in parallel with each other and with writers. A full memtable is frozen and
+// queued for a background worker, which flushes queued memtables to disk in order, while
+// writes continue into a fresh one. Queries see points of frozen memtables until they are
+// flushed. Once max_immutable memtables are queued, writers block until one is flushed.
+//
+// Locks are always taken in the order writeMu, storageMu, diskMu, mu.
 type Engine struct {
 	configuration   *config.Config
 	pageManager     *page.Manager
-	parquetManager  *parquet.Manager
-	memoryTable     *memory.MemTable
+	parquetManager  *parquet.Manager // used only by the flush worker after Open
 	wal             *write_ahead_log.WriteAheadLog
-	timeWindow      *time_window.TimeWindow
-	recovering      bool
-	retentionPeriod int64
+	timeWindow      *time_window.TimeWindow // used only by the flush worker after Open
+	seriesIndex     *index.Index
+	recoveryReport  *write_ahead_log.RecoveryReport
+	precision       internal.Precision
+	retentionPeriod int64 // in units of precision
+
+	// writeMu serializes writers
+	writeMu sync.Mutex
+	// storageMu serializes flushes, deletes, retention and compaction, which change files on disk
+	storageMu sync.Mutex
+	// diskMu is held exclusively while files in the windows directory change, and shared by readers,
+	// so a flushed point is seen either in the frozen memtable or on disk, never in both or neither.
+	// Flushes write copies of parquets without it and hold it only to swap them in place.
+	diskMu sync.RWMutex
+
+	// mu guards the fields below. flushed is signalled whenever the flush worker finishes a memtable.
+	mu            sync.RWMutex
+	flushed       *sync.Cond
+	memoryTable   *memory.MemTable
+	immutables    []*frozenMemTable // waiting to be flushed, oldest first
+	flushErr      error             // last failed flush, writes are refused after it
+	recovering    bool
+	flushRequests chan *frozenMemTable
+	flushDone     chan struct{}
+	closeOnce     sync.Once
+	closeErr      error
+}
+
+// AggregationResult is the outcome of aggregating one time series over a time range
+type AggregationResult struct {
+	Function string
+	Value    float64
+	// Found is false when there were no points in the range, Value is meaningless then
+	Found bool
 }
 
+// NewEngine opens engine configured by the default configuration file
 func NewEngine() (*Engine, error) {
+	return Open(config.LoadConfiguration())
+}
+
+// Open creates data and log directories if needed, loads the current time window
+// and recovers the memtable from the write ahead log
+func Open(conf *config.Config) (*Engine, error) {
 	var err error
-	conf := config.LoadConfiguration()
+	for _, dir := range []string{conf.TimeWindowConfig.WindowsDirPath, conf.WALConfig.LogsDirPath} {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	precision, err := internal.ParsePrecision(conf.EngineConfig.Precision)
+	if err != nil {
+		return nil, err
+	}
+
 	pm := page.NewManager(conf.PageConfig)
 	wal := write_ahead_log.NewWriteAheadLog(&conf.WALConfig, pm)
 	memTable := memory.NewMemTable(conf.MemTableConfig.MaxSize)
-	parquetManager := parquet.NewManager(&conf.ParquetConfig, pm, "")
+	parquetManager := parquet.NewManager(&conf.ParquetConfig, pm, "", precision)
 
 	e := Engine{
 		configuration:  conf,
@@ -62,6 +132,35 @@ func NewEngine() (*Engine, error) {
 		wal:            wal,
 		parquetManager: parquetManager,
 		recovering:     true,
+		precision:      precision,
+		flushRequests:  make(chan *frozenMemTable, conf.MemTableConfig.MaxImmutable),
+		flushDone:      make(chan struct{}),
+	}
+	e.flushed = sync.NewCond(&e.mu)
+
+	err = e.recoverStaging(e.compactionDir())
+	if err != nil {
+		return nil, err
+	}
+	err = e.recoverStaging(e.flushDir())
+	if err != nil {
+		return nil, err
+	}
+	parquetManager.StagingPath = e.flushDir()
+
+	err = e.checkStoredPrecision()
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.migrateSeriesHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.loadIndex()
+	if err != nil {
+		return nil, err
 	}
 
 	err = e.loadTimeWindow()
@@ -76,6 +175,7 @@ func NewEngine() (*Engine, error) {
 	case "day":
 		e.retentionPeriod = 60 * 60 * 24 * e.configuration.RetentionPeriod
 	}
+	e.retentionPeriod *= int64(precision.PerSecond())
 	err = e.checkRetentionPeriod()
 	if err != nil {
 		return nil, err
@@ -91,323 +191,463 @@ func NewEngine() (*Engine, error) {
 		return nil, err
 	}
 
+	go e.flushWorker()
+
 	err = e.loadMemtable()
 	if err != nil {
+		_ = e.Close()
 		return nil, err
 	}
 
-	e.recovering = false
 	return &e, nil
 }
 
-func (e *Engine) checkRetentionPeriod() error {
-	path := e.configuration.TimeWindowConfig.WindowsDirPath
-	files, err := os.ReadDir(path)
-	retention := time.Now().Unix() - e.retentionPeriod
+// Close waits for the frozen memtable to be flushed and releases resources held by the engine.
+// Points still in the active memtable are not lost, they are recovered from the write ahead log on next Open.
+func (e *Engine) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.flushRequests)
+		<-e.flushDone
+
+		e.mu.RLock()
+		err := e.flushErr
+		e.mu.RUnlock()
+
+		if e.parquetManager.ActiveParquet != nil {
+			err = errors.Join(err, e.parquetManager.Close())
+		}
+		err = errors.Join(err, e.seriesIndex.Save())
+		e.closeErr = errors.Join(err, e.wal.Close())
+	})
+	return e.closeErr
+}
+
+// PendingFlushes returns number of frozen memtables waiting to be flushed
+func (e *Engine) PendingFlushes() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.immutables)
+}
+
+// Precision returns the unit of timestamps accepted and returned by the engine
+func (e *Engine) Precision() internal.Precision {
+	return e.precision
+}
+
+// RecoveryReport describes replay of the write ahead log done by Open,
+// including entries discarded because they were corrupted
+func (e *Engine) RecoveryReport() *write_ahead_log.RecoveryReport {
+	return e.recoveryReport
+}
+
+// migrateSeriesHashes rewrites hashes of parquets written before separators in hashes were
+// escaped, so their series are found under current hashes. Series with '|' or '=' in names or
+// values were ambiguous in the old format, they keep the series the old format was read as.
+func (e *Engine) migrateSeriesHashes() error {
+	return e.walkParquets(func(_ string, parquetPath string) error {
+		metaPath := filepath.Join(parquetPath, "metadata.db")
+		data, err := e.pageManager.ReadStructure(metaPath, 0)
+		if err != nil {
+			return err
+		}
+		meta, err := parquet.DeserializeParquetMetadata(data)
+		if err != nil || meta.EscapedHash {
+			return err
+		}
+
+		ts, err := internal.ParseLegacyTimeSeriesHash(meta.TimeSeriesHash)
+		if err != nil {
+			return err
+		}
+		meta.TimeSeriesHash = ts.Hash
+		meta.EscapedHash = true
+		return e.pageManager.WriteStructure(meta.Serialize(), metaPath, 0)
+	}, nil)
+}
+
+// checkStoredPrecision refuses to open data written with a different timestamp precision,
+// since window bounds and timestamps on disk would be misinterpreted. Every parquet is checked,
+// so data of a different precision added to the directory later is found too.
+func (e *Engine) checkStoredPrecision() error {
+	windowsDir := e.configuration.WindowsDirPath
+	windows, err := os.ReadDir(windowsDir)
 	if err != nil {
 		return err
 	}
-	for _, f := range files {
-		if f.IsDir() {
-			minTimestamp, maxTimestamp, err := disk.MinMaxTimestamp(f.Name())
+
+	for _, window := range windows {
+		if !window.IsDir() {
+			continue
+		}
+		parquets, err := os.ReadDir(filepath.Join(windowsDir, window.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, p := range parquets {
+			metaPath := filepath.Join(windowsDir, window.Name(), p.Name(), "metadata.db")
+			data, err := e.pageManager.ReadStructure(metaPath, 0)
+			if err != nil {
+				// parquet which was never closed has no metadata yet
+				continue
+			}
+			meta, err := parquet.DeserializeParquetMetadata(data)
 			if err != nil {
 				return err
 			}
-			if maxTimestamp <= uint64(retention) {
-				err = e.pageManager.RemoveFile(filepath.Join(path, f.Name()))
-				if err != nil {
-					return err
-				}
-				e.memoryTable.DeleteExpired(minTimestamp, maxTimestamp)
+			if meta.Precision != e.precision {
+				return fmt.Errorf("data in %s is stored with timestamp precision %q, configured precision is %q",
+					windowsDir, meta.Precision, e.precision)
 			}
 		}
 	}
 	return nil
 }
 
-// loadTimeWindow loads already existing time window, or creates new one instead
-func (e *Engine) loadTimeWindow() error {
-	now := uint64(time.Now().Unix())
-	tw, err := time_window.LoadExistingTimeWindow(now, e.configuration.TimeWindowConfig.WindowsDirPath, &e.configuration.TimeWindowConfig, e.parquetManager)
+// EnforceRetention removes time windows that are older than the retention period
+func (e *Engine) EnforceRetention() error {
+	return e.checkRetentionPeriod()
+}
 
-	if err != nil {
-		return err
+func (e *Engine) checkRetentionPeriod() error {
+	path := e.configuration.TimeWindowConfig.WindowsDirPath
+	retention := int64(e.precision.Now()) - e.retentionPeriod
+	if retention <= 0 {
+		return nil
 	}
-	e.timeWindow = tw
-	e.parquetManager.Update(tw.Path)
 
-	err = e.configuration.SetTimeWindowStart(now)
-	if err != nil {
+	expired, err := e.expiredWindows(path, uint64(retention))
+	if err != nil || len(expired) == 0 {
 		return err
 	}
 
-	return nil
-}
-
-func (e *Engine) loadMemtable() error {
-	offset, segmentIndex, pageIndex := e.prepareLoadMemtable()
-
-	e.memoryTable.StartWALOffset = offset
-	e.memoryTable.StartWALSegment = e.wal.FirstSegment()
+	e.storageMu.Lock()
+	defer e.storageMu.Unlock()
+	e.diskMu.Lock()
+	defer e.diskMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-	for segmentIndex < e.wal.SegmentsNumber() {
-		file, err := os.Stat(e.wal.SegmentFilename(segmentIndex))
+	for _, name := range expired {
+		minTimestamp, maxTimestamp, err := disk.MinMaxTimestamp(name)
 		if err != nil {
 			return err
 		}
-
-		err = e.reconstructWalSegment(uint64(file.Size()), offset, segmentIndex, pageIndex)
+		err = e.pageManager.RemoveFile(filepath.Join(path, name))
 		if err != nil {
 			return err
 		}
+		e.memoryTable.DeleteExpired(minTimestamp, maxTimestamp)
+		for _, frozen := range e.immutables {
+			frozen.table.DeleteExpired(minTimestamp, maxTimestamp)
+		}
+	}
+	return nil
+}
 
-		offset = write_ahead_log.INDEX
-		segmentIndex += 1
-		pageIndex = 0
+// expiredWindows returns names of window directories whose end is not after retention
+func (e *Engine) expiredWindows(path string, retention uint64) ([]string, error) {
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]string, 0)
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		_, maxTimestamp, err := disk.MinMaxTimestamp(f.Name())
+		if err != nil {
+			return nil, err
+		}
+		if maxTimestamp <= retention {
+			expired = append(expired, f.Name())
+		}
+	}
+	return expired, nil
+}
+
+// loadTimeWindow loads already existing time window, or creates new one instead
+func (e *Engine) loadTimeWindow() error {
+	now := e.precision.Now()
+	tw, err := e.loadWindow(now)
+
+	if err != nil {
+		return err
+	}
+	e.timeWindow = tw
+	e.parquetManager.Update(tw.Path)
+
+	err = e.configuration.SetTimeWindowStart(now)
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (e *Engine) prepareLoadMemtable() (uint64, uint64, uint64) {
+// loadWindow returns time window containing the timestamp, creating it if necessary
+func (e *Engine) loadWindow(timestamp uint64) (*time_window.TimeWindow, error) {
+	return time_window.LoadExistingTimeWindow(timestamp, e.configuration.WindowsDirPath,
+		&e.configuration.TimeWindowConfig, e.precision, e.parquetManager)
+}
+
+// loadMemtable replays the write ahead log from the first entry which was not flushed yet
+func (e *Engine) loadMemtable() error {
 	offset := e.wal.UnstagedOffset()
 	if offset == 0 {
 		offset += write_ahead_log.INDEX
 	}
+	segment := e.wal.UnstagedSegment()
+	if segment == "" {
+		segment = e.wal.FirstSegment()
+	}
 
-	pageIndex := (offset - write_ahead_log.INDEX) / e.pageManager.Config.PageSize
-	return offset, 0, pageIndex
-}
+	e.memoryTable.StartWALOffset = offset
+	e.memoryTable.StartWALSegment = segment
 
-func (e *Engine) reconstructWalSegment(
-	fileSize uint64, offset uint64, segmentIndex uint64, pageIndex uint64) error {
+	report, err := e.wal.Replay(segment, offset, func(walEntry *entry.WALEntry, position write_ahead_log.Position) error {
+		timeSeries := internal.NewTimeSeries(walEntry.MeasurementName, walEntry.Tags)
 
-	currentOffset := write_ahead_log.INDEX + pageIndex*e.pageManager.Config.PageSize
-	for offset < fileSize {
-		pageBytes, err := e.pageManager.ReadPage(
-			e.wal.SegmentFilename(segmentIndex),
-			write_ahead_log.INDEX+int64(pageIndex*e.pageManager.Config.PageSize))
-		if err != nil {
-			return err
-		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
 
-		walPage, err := page.DeserializeWALPage(pageBytes)
-		if err != nil {
-			return err
+		if walEntry.Delete {
+			e.memoryTable.DeleteRange(timeSeries, walEntry.MinTimestamp, walEntry.MaxTimestamp)
+			return nil
 		}
-		for _, en := range walPage.GetEntries() {
-			walEntry := en.(*entry.WALEntry)
-			if currentOffset < offset {
-				currentOffset += walEntry.Size()
-				continue
-			}
-
-			timeSeries := internal.NewTimeSeries(walEntry.MeasurementName, walEntry.Tags)
-			if walEntry.Delete {
-				e.memoryTable.DeleteRange(timeSeries, walEntry.MinTimestamp, walEntry.MaxTimestamp)
-			} else {
-				newPoint := &internal.Point{
-					Value:     walEntry.Value,
-					Timestamp: walEntry.MaxTimestamp,
-				}
-				_, err = e.putInMemtable(timeSeries, newPoint, e.wal.ActiveSegment(), e.wal.UnstagedOffset())
-				if err != nil {
-					return err
-				}
-			}
 
-			entrySize := walEntry.Size()
-			offset += entrySize
-			currentOffset += entrySize
+		newPoint := &internal.Point{
+			Value:     walEntry.Value,
+			Timestamp: walEntry.MaxTimestamp,
 		}
+		return e.putInMemtable(timeSeries, newPoint, position)
+	})
+	if err != nil {
+		return err
+	}
+	e.recoveryReport = report
 
-		pageIndex += 1
-		offset = write_ahead_log.INDEX + pageIndex*e.pageManager.Config.PageSize
-		currentOffset = offset
+	// segments can't be deleted while they are replayed, so flushed ones are deleted afterwards
+	e.mu.Lock()
+	err = e.waitForFlush()
+	e.recovering = false
+	deleteSegment := e.memoryTable.StartWALSegment
+	e.mu.Unlock()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	_, err = e.wal.DeleteWalSegments(deleteSegment)
+	return err
 }
 
-func (e *Engine) BelongsInAny(timestamp uint64) (bool, error) {
-	path := e.configuration.TimeWindowConfig.WindowsDirPath
-	files, err := os.ReadDir(path)
-	if err != nil {
-		return false, err
-	}
-	for _, f := range files {
-		if f.IsDir() {
-			minTimestamp, maxTimestamp, err := disk.MinMaxTimestamp(f.Name())
-			if err != nil {
-				return false, err
-			}
-			if minTimestamp < timestamp && maxTimestamp > timestamp {
-				return true, nil
-			}
-		}
-	}
-	return false, nil
+// isExpired reports whether the timestamp is already out of the retention period
+func (e *Engine) isExpired(timestamp uint64) bool {
+	retention := int64(e.precision.Now()) - e.retentionPeriod
+	return retention > 0 && timestamp <= uint64(retention)
 }
 
-func (e *Engine) putInMemtable(ts *internal.TimeSeries, p *internal.Point, walSegment string, walOffset uint64) (string, error) {
-	var deleteSegment string
-	if !e.recovering {
-		err := e.UpdateTimeWindow(p.Timestamp)
-		if err != nil {
-			return "", err
-		}
-	} else {
-		does, err := e.BelongsInAny(p.Timestamp)
-		if err != nil {
-			return "", err
-		}
-		if !does {
-			return "", nil
-		}
+// putInMemtable inserts point into the active memtable and hands it to the flush
+// worker once it is full. Position is the end of the point entry in the log.
+// Must be called with mu held.
+func (e *Engine) putInMemtable(ts *internal.TimeSeries, p *internal.Point, position write_ahead_log.Position) error {
+	if e.isExpired(p.Timestamp) {
+		// only possible while recovering, since Put rejects expired points
+		return nil
 	}
-	flushedPoints := e.memoryTable.WritePointWithFlush(ts, p)
-	if flushedPoints != nil {
-		deleteSegment = e.memoryTable.StartWALSegment
-		e.memoryTable.StartWALSegment = walSegment
-		e.memoryTable.StartWALOffset = walOffset
-
-		err := e.configuration.SetUnstagedOffset(walOffset)
-		if err != nil {
-			return "", err
-		}
 
-		groups, err := e.prepareFlush(flushedPoints)
-		if err != nil {
-			return "", err
-		}
+	// replay adds series too, so ones only in the log are indexed again after a crash
+	e.seriesIndex.Add(ts)
+	e.memoryTable.WritePoint(ts, p)
+	if !e.memoryTable.IsFull() {
+		return nil
+	}
 
-		err = e.flush(groups)
-		if err != nil {
-			return "", err
-		}
+	err := e.waitForRoom()
+	if err != nil {
+		return err
 	}
-	return deleteSegment, nil
+
+	frozen := &frozenMemTable{table: e.memoryTable, end: position}
+	e.immutables = append(e.immutables, frozen)
+	e.memoryTable = memory.NewMemTable(e.configuration.MemTableConfig.MaxSize)
+	e.memoryTable.StartWALSegment = position.Segment
+	e.memoryTable.StartWALOffset = position.Offset
+
+	// never blocks, the channel has room for max_immutable requests
+	e.flushRequests <- frozen
+	return nil
 }
 
+// UpdateTimeWindow moves the active time window forward when timestamp is newer than its end.
+// Older timestamps leave it as is, such points are routed to their windows on flush.
+// Called by the flush worker.
 func (e *Engine) UpdateTimeWindow(timestamp uint64) error {
-	tw := e.timeWindow
-	if tw.EndTimestamp < timestamp {
-		tw.StartTimestamp = timestamp
-		tw.EndTimestamp = tw.StartTimestamp + tw.Config.Duration
-		if tw.ParquetManager.ActiveParquet != nil {
-			err := tw.ParquetManager.Close()
-			if err != nil {
-				return err
-			}
-		}
+	if e.timeWindow.EndTimestamp >= timestamp {
+		return nil
+	}
 
-		err := tw.CreateNewWindowDirectory()
+	if e.parquetManager.ActiveParquet != nil {
+		err := e.parquetManager.Close()
 		if err != nil {
 			return err
 		}
+	}
 
-		tw.ParquetManager.Update(tw.Path)
-		err = e.configuration.SetTimeWindowStart(tw.StartTimestamp)
-		if err != nil {
-			return err
-		}
+	tw, err := e.loadWindow(timestamp)
+	if err != nil {
+		return err
 	}
-	return nil
+	e.timeWindow = tw
+
+	return e.configuration.SetTimeWindowStart(tw.StartTimestamp)
 }
 
+// prepareFlush groups flushed points by path of the time window they belong to
 func (e *Engine) prepareFlush(flushedPoints map[string][]*internal.Point) (map[string]map[string][]*internal.Point, error) {
 	windowGroups := make(map[string]map[string][]*internal.Point)
+	windows := []*time_window.TimeWindow{e.timeWindow}
 
 	for tsName, points := range flushedPoints {
-		currentTw := e.timeWindow
 		for _, point := range points {
-			if !e.timeWindow.Belongs(point.Timestamp) {
-				if !currentTw.Belongs(point.Timestamp) {
-					tw, err := time_window.LoadExistingTimeWindow(point.Timestamp, e.configuration.WindowsDirPath, &e.configuration.TimeWindowConfig, e.parquetManager)
-					if err != nil {
-						return nil, err
-					}
-					currentTw = tw
-				}
-
-				windowID := currentTw.Path
-				if _, ok := windowGroups[windowID]; !ok {
-					windowGroups[windowID] = make(map[string][]*internal.Point)
+			var tw *time_window.TimeWindow
+			for _, w := range windows {
+				if w.Belongs(point.Timestamp) {
+					tw = w
+					break
 				}
-				windowGroups[windowID][tsName] = append(windowGroups[windowID][tsName], point)
-			} else {
-				if _, ok := windowGroups[e.timeWindow.Path]; !ok {
-					windowGroups[e.timeWindow.Path] = make(map[string][]*internal.Point)
+			}
+			if tw == nil {
+				var err error
+				tw, err = e.loadWindow(point.Timestamp)
+				if err != nil {
+					return nil, err
 				}
-				windowGroups[e.timeWindow.Path][tsName] = append(windowGroups[e.timeWindow.Path][tsName], point)
+				windows = append(windows, tw)
+			}
+
+			if _, ok := windowGroups[tw.Path]; !ok {
+				windowGroups[tw.Path] = make(map[string][]*internal.Point)
 			}
+			windowGroups[tw.Path][tsName] = append(windowGroups[tw.Path][tsName], point)
 		}
 	}
+
+	// loading windows moves parquet manager away from the active one
+	e.parquetManager.Update(e.timeWindow.Path)
 	return windowGroups, nil
 }
 
 func (e *Engine) flush(windowGroups map[string]map[string][]*internal.Point) error {
-	currentTw := e.timeWindow
-	var err error
-	for winID, group := range windowGroups {
-		if winID != currentTw.Path {
-			var examplePoint *internal.Point
-			found := false
-			for _, points := range group {
-				if len(points) > 0 {
-					examplePoint = points[0]
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
-			currentTw, err = time_window.LoadExistingTimeWindow(examplePoint.Timestamp, e.configuration.WindowsDirPath, &e.configuration.TimeWindowConfig, e.parquetManager)
-			if err != nil {
-				return err
-			}
-			err = currentTw.FlushAll(group)
-			if err != nil {
-				return err
-			}
-		} else {
-			err = currentTw.FlushAll(group)
-			if err != nil {
-				return err
-			}
+	defer e.parquetManager.Update(e.timeWindow.Path)
+
+	for winPath, group := range windowGroups {
+		e.parquetManager.Update(winPath)
+		err := e.parquetManager.FlushAll(group)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// Put writes a single point of the time series. Point timestamp is chosen by the caller
+// and may be in the past, as long as it is within the retention period.
 func (e *Engine) Put(ts *internal.TimeSeries, p *internal.Point) error {
-	walSeg := e.wal.ActiveSegment()
-	offset, err := e.wal.Put(ts, p)
-	if err != nil {
-		return err
+	return e.PutBatch([]*internal.Sample{internal.NewSample(ts, p)})
+}
+
+// PutBatch writes all samples to the write ahead log in one append and then
+// inserts them into the memtable. Nothing is written if any point is expired.
+func (e *Engine) PutBatch(samples []*internal.Sample) error {
+	for _, sample := range samples {
+		if e.isExpired(sample.Point.Timestamp) {
+			return fmt.Errorf("point timestamp %d is older than the retention period", sample.Point.Timestamp)
+		}
 	}
 
-	deleteSegment, err := e.putInMemtable(ts, p, walSeg, offset)
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	e.mu.RLock()
+	err := e.flushErr
+	e.mu.RUnlock()
 	if err != nil {
 		return err
 	}
 
-	_, err = e.wal.DeleteWalSegments(deleteSegment)
+	positions, err := e.wal.PutBatch(samples)
 	if err != nil {
 		return err
 	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, sample := range samples {
+		err = e.putInMemtable(sample.TimeSeries, sample.Point, positions[i])
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (e *Engine) delete(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) error {
-	err := e.wal.Delete(ts, minTimestamp, maxTimestamp)
+// WriteLineProtocol imports points written in InfluxDB line protocol, whose timestamps
+// are in the given precision. Returns number of points written before any error.
+func (e *Engine) WriteLineProtocol(r io.Reader, precision internal.Precision) (uint64, error) {
+	parser := line_protocol.NewParser(r, precision, e.precision)
+
+	var written uint64
+	for {
+		batch, err := parser.NextBatch(lineProtocolBatchSize)
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+
+		err = e.PutBatch(batch)
+		if err != nil {
+			return written, err
+		}
+		written += uint64(len(batch))
+	}
+}
+
+// DeleteRange deletes all points of the time series with timestamps in [minTimestamp, maxTimestamp].
+// Like writes, deletes are refused after a failed flush.
+func (e *Engine) DeleteRange(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) error {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	e.mu.RLock()
+	err := e.flushErr
+	e.mu.RUnlock()
 	if err != nil {
 		return err
 	}
 
+	err = e.wal.Delete(ts, minTimestamp, maxTimestamp)
+	if err != nil {
+		return err
+	}
+
+	e.storageMu.Lock()
+	defer e.storageMu.Unlock()
+	e.diskMu.Lock()
+	defer e.diskMu.Unlock()
+
+	e.mu.Lock()
 	e.memoryTable.DeleteRange(ts, minTimestamp, maxTimestamp)
+	for _, frozen := range e.immutables {
+		frozen.table.DeleteRange(ts, minTimestamp, maxTimestamp)
+	}
+	e.mu.Unlock()
 
 	err = e.deleteInParquet(ts, minTimestamp, maxTimestamp)
 	if err != nil {
@@ -482,6 +722,9 @@ func (e *Engine) deleteInRowGroup(parquetPath string, minTimestamp uint64, maxTi
 				return err
 			}
 			skipped, err := tsIter.Skip(minTimestamp, maxTimestamp)
+			if err == io.EOF {
+				continue
+			}
 			if err != nil {
 				return err
 			}
@@ -495,6 +738,10 @@ func (e *Engine) deleteInRowGroup(parquetPath string, minTimestamp uint64, maxTi
 				return err
 			}
 
+			// pages written in place come after metadata, so readers skipping delete columns of
+			// row groups without deletions never miss a written delete. A rewritten column is
+			// renamed into place first, since metadata points at its last page.
+			dirty := make([]chunk.DirtyPage, 0, 1)
 			for {
 				en, err := tsIter.Next()
 				if err == io.EOF {
@@ -508,331 +755,198 @@ func (e *Engine) deleteInRowGroup(parquetPath string, minTimestamp uint64, maxTi
 					break
 				}
 				if !deleteIter.HasNext() {
-					err = e.pageManager.WritePage(deleteIter.ActivePage, deletePath, int64(deleteIter.CurrentPageOffset-e.configuration.PageConfig.PageSize))
-					if err != nil {
-						return err
-					}
+					dirty = append(dirty, chunk.DirtyPage{Page: deleteIter.ActivePage.(*page.DeletePage), Offset: int64(deleteIter.CurrentPageOffset - e.configuration.PageConfig.PageSize)})
 				}
 				en, err = deleteIter.Next()
 				if err != nil {
 					return err
 				}
 				deleteEntry := en.(*entry.DeleteEntry)
+				if !deleteEntry.Deleted {
+					meta.DeletedPoints++
+				}
 				deleteEntry.Delete()
 			}
-			err = e.pageManager.WritePage(deleteIter.ActivePage, deletePath, int64(deleteIter.CurrentPageOffset-e.configuration.PageConfig.PageSize))
+			dirty = append(dirty, chunk.DirtyPage{Page: deleteIter.ActivePage.(*page.DeletePage), Offset: int64(deleteIter.CurrentPageOffset - e.configuration.PageConfig.PageSize)})
+
+			var rewritten bool
+			meta.DeleteOffset, rewritten, err = chunk.RewriteOverflowingChunk(e.pageManager, deletePath, meta.DeleteOffset, dirty)
 			if err != nil {
 				return err
 			}
+
+			// statistics of row groups with deleted points are not used by aggregations any more
+			if meta.HasStatistics || rewritten {
+				err = e.pageManager.WriteStructure(meta.Serialize(), metaPath, 0)
+				if err != nil {
+					return err
+				}
+			}
+			if !rewritten {
+				err = chunk.WriteDirtyPages(e.pageManager, deletePath, dirty)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
 	return nil
 }
 
-func (e *Engine) List(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) error {
+// Query returns points of the time series with timestamps in [minTimestamp, maxTimestamp]
+func (e *Engine) Query(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) ([]*internal.Point, error) {
 	err := e.checkRetentionPeriod()
 	if err != nil {
-		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return nil, err
 	}
 
-	pointsMemory := e.memoryTable.List(ts, minTimestamp, maxTimestamp)
-
-	pointsDisk, err := disk.Get(
-		e.pageManager,
-		e.configuration.TimeWindowConfig.WindowsDirPath,
-		ts,
-		minTimestamp,
-		maxTimestamp,
-	)
-
-	if len(pointsDisk) > 0 || len(pointsMemory) > 0 {
-		fmt.Println()
-		for _, p := range pointsDisk {
-			fmt.Println(p)
-		}
-		for _, p := range pointsMemory {
-			fmt.Println(p)
-		}
-		fmt.Println()
-	} else {
-		fmt.Println()
-		fmt.Println("No points found")
-	}
+	e.diskMu.RLock()
+	defer e.diskMu.RUnlock()
 
-	return err
+	return e.query(ts, minTimestamp, maxTimestamp)
 }
 
-func (e *Engine) aggregate(
-	ts *internal.TimeSeries,
-	minTimestamp, maxTimestamp uint64,
-	function string,
-) error {
-	switch function {
-	case MIN:
-		curBest, _, found := e.memoryTable.Aggregate(ts, minTimestamp, maxTimestamp, MIN)
-		if !found {
-			curBest = math.MaxFloat64
-		}
-		diskBest, _, err := disk.Aggregate(ts, minTimestamp, maxTimestamp, e.pageManager, e.configuration.WindowsDirPath, MIN)
-		if err != nil {
-			return err
-		}
-		if diskBest < curBest {
-			curBest = diskBest
-		}
-		if curBest != math.MaxFloat64 {
-			fmt.Printf("\nMinimum value is %.2f\n\n", curBest)
-		} else {
-			fmt.Println()
-			fmt.Printf("No points found\n")
-		}
-	case MAX:
-		curBest, _, found := e.memoryTable.Aggregate(ts, minTimestamp, maxTimestamp, MAX)
-		if !found {
-			curBest = -math.MaxFloat64
-		}
-		diskBest, _, err := disk.Aggregate(ts, minTimestamp, maxTimestamp, e.pageManager, e.configuration.WindowsDirPath, MAX)
-		if err != nil {
-			return err
-		}
-		if diskBest > curBest {
-			curBest = diskBest
-		}
-		if curBest != -math.MaxFloat64 {
-			fmt.Printf("\nMaximum value is %.2f\n\n", curBest)
-		} else {
-			fmt.Println()
-			fmt.Printf("No points found\n")
-		}
-	case AVG:
-		memorySum, memoryEntriesNum, found := e.memoryTable.Aggregate(ts, minTimestamp, maxTimestamp, AVG)
-		if !found {
-			memorySum = 0
-			memoryEntriesNum = 0
-		}
-		var totalCount uint64
-		var result float64
-		diskSum, diskEntriesNum, err := disk.Aggregate(ts, minTimestamp, maxTimestamp, e.pageManager, e.configuration.WindowsDirPath, AVG)
-		if err != nil {
-			return err
-		}
-		totalCount = diskEntriesNum + memoryEntriesNum
-		if totalCount == 0 {
-			result = 0
-		} else {
-			result = (memorySum + diskSum) / float64(totalCount)
-		}
-		fmt.Printf("\nAverage value is %.2f\n\n", result)
-	default:
-		return nil
+// Iterator streams points of the time series with timestamps in [minTimestamp, maxTimestamp]
+// in timestamp order, reading pages from disk only as they are reached. The iterator holds
+// the disk shared until it is closed, so flushes, deletes and retention wait for it, and it
+// must be closed before writing to the engine from the same goroutine.
+func (e *Engine) Iterator(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) (disk.PointIterator, error) {
+	err := e.checkRetentionPeriod()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	e.diskMu.RLock()
+	it, err := e.iterator(ts, minTimestamp, maxTimestamp)
+	if err != nil {
+		e.diskMu.RUnlock()
+		return nil, err
+	}
+	return &lockedIterator{PointIterator: it, unlock: e.diskMu.RUnlock}, nil
 }
 
-func (e *Engine) Run() {
-	for {
-		err := e.checkRetentionPeriod()
-		if err != nil {
-			fmt.Printf("\n[ERROR]: %v\n\n", err)
-		}
-
-		fmt.Println()
-		fmt.Println(" 1 - Write Point")
-		fmt.Println(" 2 - Delete Range")
-		fmt.Println(" 3 - List")
-		fmt.Println(" 4 - Aggregate")
-		fmt.Println("\n 0 - Exit")
-
-		choice := readUint("\nEnter your choice: ")
-		switch choice {
-		case 0:
-			fmt.Println("Exiting the program.")
-			return
-		case 1:
-			e.PutPoint()
-		case 2:
-			e.DeleteRange()
-		case 3:
-			e.ListRange()
-		case 4:
-			e.AggregateRange()
-		default:
-			fmt.Printf("\nInvalid choice, please try again!\n\n")
-		}
-	}
+// lockedIterator releases the disk lock when closed
+type lockedIterator struct {
+	disk.PointIterator
+	unlock func()
+	once   sync.Once
 }
 
-func (e *Engine) PutPoint() {
-	measurementName := readString("Enter time series measurement name")
-	tags := readTags()
-	////timestamp := getUserInteger("Enter point timestamp")
-	value := readFloat("Enter point value: ")
+func (it *lockedIterator) Close() error {
+	err := it.PointIterator.Close()
+	it.once.Do(it.unlock)
+	return err
+}
 
-	err := e.Put(
-		internal.NewTimeSeries(measurementName, tags),
-		//internal.NewTimeSeries("temp", nil),
-		internal.NewPoint(value),
+// iterator merges points on disk with those in memtables, must be used with diskMu held
+func (e *Engine) iterator(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) (disk.PointIterator, error) {
+	diskIterator, err := disk.NewSeriesIterator(
+		e.pageManager,
+		e.configuration.TimeWindowConfig.WindowsDirPath,
+		ts,
+		minTimestamp,
+		maxTimestamp,
 	)
-
 	if err != nil {
-		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return nil, err
 	}
-}
-
-func (e *Engine) DeleteRange() {
-	measurementName := readString("Enter time series measurement name: ")
-	tags := readTags()
-	minTimestamp, maxTimestamp := readMinMaxTimestamp()
 
-	err := e.delete(
-		internal.NewTimeSeries(measurementName, tags),
-		//internal.NewTimeSeries("temp", nil),
-		minTimestamp, maxTimestamp,
-	)
-	if err != nil {
-		fmt.Printf("\n[ERROR]: %v\n\n", err)
+	// sources go from the oldest to the newest, so rewritten points replace those flushed before
+	e.mu.RLock()
+	its := []disk.PointIterator{diskIterator}
+	for _, table := range append(e.frozenTables(), e.memoryTable) {
+		its = append(its, disk.NewSliceIterator(table.List(ts, minTimestamp, maxTimestamp)))
 	}
-}
+	e.mu.RUnlock()
 
-func (e *Engine) ListRange() {
-	measurementName := readString("Enter time series measurement name: ")
-	tags := readTags()
-	minTimestamp, maxTimestamp := readMinMaxTimestamp()
+	return disk.NewMergeIterator(its...), nil
+}
 
-	err := e.List(
-		internal.NewTimeSeries(measurementName, tags),
-		//internal.NewTimeSeries("temp", nil),
-		minTimestamp, maxTimestamp,
-	)
+// query must be called with diskMu held
+func (e *Engine) query(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) ([]*internal.Point, error) {
+	it, err := e.iterator(ts, minTimestamp, maxTimestamp)
 	if err != nil {
-		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return nil, err
 	}
+	return disk.Collect(it)
 }
 
-func (e *Engine) AggregateRange() {
-	measurementName := readString("Enter time series measurement name: ")
-	tags := readTags()
-	minTimestamp, maxTimestamp := readMinMaxTimestamp()
-
-	// Getting aggregation function:
-	aggregationFunction := readAggregationFunc()
-
-	err := e.aggregate(
-		internal.NewTimeSeries(measurementName, tags),
-		//internal.NewTimeSeries("temp", nil),
-		minTimestamp, maxTimestamp,
-		aggregationFunction,
-	)
+// Aggregate applies one of GetAllAggregationFunctions, or any Percentile, to points of the time series
+// with timestamps in [minTimestamp, maxTimestamp]
+func (e *Engine) Aggregate(
+	ts *internal.TimeSeries,
+	minTimestamp, maxTimestamp uint64,
+	function string,
+) (*AggregationResult, error) {
+	err := e.checkRetentionPeriod()
 	if err != nil {
-		fmt.Printf("\n[ERROR]: %v\n\n", err)
+		return nil, err
 	}
-}
 
-func readString(message string) string {
-	for {
-		fmt.Printf("%s ", message)
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("\n[ERROR]: %v\n\n", err)
-			continue
-		}
-		input = strings.TrimSpace(input)
-		if input == "" {
-			fmt.Printf("\nEnter something!\n\n")
-			continue
-		}
-		return input
-	}
+	e.diskMu.RLock()
+	defer e.diskMu.RUnlock()
+
+	return e.aggregate(ts, minTimestamp, maxTimestamp, function)
 }
 
-func readUint(message string) uint64 {
-	for {
-		fmt.Printf("%s ", message)
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("\n[ERROR]: %v\n\n", err)
-			continue
-		}
-		input = strings.TrimSpace(input)
-		if input == "" {
-			fmt.Printf("\nEnter something!\n\n")
-			continue
-		}
-		parsedNumber, err := strconv.ParseUint(input, 10, 64)
-		if err != nil {
-			fmt.Printf("\n[ERROR]: %v\n\n", err)
-			continue
-		}
-		return parsedNumber
+// aggregate must be called with diskMu held
+func (e *Engine) aggregate(
+	ts *internal.TimeSeries,
+	minTimestamp, maxTimestamp uint64,
+	function string,
+) (*AggregationResult, error) {
+	aggregator, err := e.aggregator(ts, minTimestamp, maxTimestamp, function)
+	if err != nil {
+		return nil, err
 	}
+	return newAggregationResult(function, aggregator), nil
 }
 
-func readFloat(message string) float64 {
-	for {
-		fmt.Printf("%s ", message)
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("\n[ERROR]: %v\n\n", err)
-			continue
-		}
-		input = strings.TrimSpace(input)
-		if input == "" {
-			fmt.Printf("\nEnter something!\n\n")
-			continue
-		}
-		parsedFloat, err := strconv.ParseFloat(input, 64)
-		if err != nil {
-			fmt.Printf("\n[ERROR]: %v\n\n", err)
-			continue
-		}
-		return parsedFloat
-	}
+func newAggregationResult(function string, aggregator disk.Aggregator) *AggregationResult {
+	value, found := aggregator.Result()
+	return &AggregationResult{Function: function, Value: value, Found: found}
 }
 
-func readTags() internal.Tags {
-	var numberOfTags uint64
-	for {
-		numberOfTags = readUint("Enter number of tags in time series:")
-		if numberOfTags != 0 {
-			break
-		}
-		fmt.Printf("\nEnter a postive integer!\n\n")
+// aggregator returns aggregator of the function with points of the time series both on disk
+// and in memory added to it, must be called with diskMu held
+func (e *Engine) aggregator(
+	ts *internal.TimeSeries,
+	minTimestamp, maxTimestamp uint64,
+	function string,
+) (disk.Aggregator, error) {
+	aggregator, err := disk.NewAggregator(function)
+	if err != nil {
+		return nil, err
 	}
-	tags := make(internal.Tags, 0)
-	for i := 0; i < int(numberOfTags); i++ {
-		name := readString("Enter tag name:")
-		value := readString("Enter tag value:")
-		tags = append(tags, internal.NewTag(name, value))
+
+	// from the oldest memtable to the active one, so rewritten points replace older ones
+	e.mu.RLock()
+	memoryPoints := make([][]*internal.Point, 0, len(e.immutables)+1)
+	for _, table := range append(e.frozenTables(), e.memoryTable) {
+		memoryPoints = append(memoryPoints, table.List(ts, minTimestamp, maxTimestamp))
 	}
-	tags.Sort()
-	return tags
-}
+	e.mu.RUnlock()
 
-func readMinMaxTimestamp() (uint64, uint64) {
-	minTimestamp := readUint("Enter minimum timestamp:")
-	for {
-		maxTimestamp := readUint("Enter maximum timestamp:")
-		if maxTimestamp >= minTimestamp {
-			return minTimestamp, maxTimestamp
-		}
-		fmt.Printf("\nMaximum timestamp can't be smaller than minimum!\n\n")
+	err = disk.AggregateSeries(
+		e.pageManager,
+		e.configuration.TimeWindowConfig.WindowsDirPath,
+		ts,
+		minTimestamp,
+		maxTimestamp,
+		memoryPoints,
+		aggregator,
+	)
+	if err != nil {
+		return nil, err
 	}
+	return aggregator, nil
 }
 
-func readAggregationFunc() string {
-	aggFunctions := GetAllAggregationFunctions()
-	maxIndex := uint64(len(aggFunctions))
-	fmt.Printf("Select aggregation function:\n\n")
-	for i, function := range aggFunctions {
-		fmt.Printf(" %d - %s\n", i+1, function)
-	}
-	fmt.Println()
-	for {
-		userInput := readUint(">>")
-		if 1 <= userInput && userInput <= maxIndex {
-			return aggFunctions[userInput-1]
-		}
-		fmt.Printf("\nYou must select a number from range [%d, %d]!\n\n", 1, maxIndex)
+// frozenTables returns memtables waiting to be flushed, must be called with mu held
+func (e *Engine) frozenTables() []*memory.MemTable {
+	tables := make([]*memory.MemTable, 0, len(e.immutables))
+	for _, frozen := range e.immutables {
+		tables = append(tables, frozen.table)
 	}
+	return tables
 }
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time-series-engine/internal/disk/write_ahead_log"
+	"time-series-engine/internal/memory"
+)
+
+// frozenMemTable is a full memtable queued to be flushed. It is read only,
+// except for deletes and retention, which hold storageMu and so never overlap a flush.
+type frozenMemTable struct {
+	table *memory.MemTable
+	// end is the position right after its last entry in the log, where replay continues once it is flushed
+	end write_ahead_log.Position
+}
+
+func (e *Engine) flushWorker() {
+	defer close(e.flushDone)
+
+	for frozen := range e.flushRequests {
+		e.mu.RLock()
+		failed := e.flushErr != nil
+		e.mu.RUnlock()
+		if failed {
+			// flushing newer memtables would move replay start past the failed one
+			continue
+		}
+
+		e.flushFrozen(frozen)
+	}
+}
+
+// waitForFlush blocks until all frozen memtables are flushed, must be called with mu held
+func (e *Engine) waitForFlush() error {
+	for len(e.immutables) > 0 && e.flushErr == nil {
+		e.flushed.Wait()
+	}
+	return e.flushErr
+}
+
+// waitForRoom blocks while the flush queue is full, must be called with mu held
+func (e *Engine) waitForRoom() error {
+	for uint64(len(e.immutables)) >= e.configuration.MemTableConfig.MaxImmutable && e.flushErr == nil {
+		e.flushed.Wait()
+	}
+	return e.flushErr
+}
+
+// flushFrozen writes points of the frozen memtable to their time windows and removes it
+// from the queue, moving start of replay past it and deleting log segments which are no
+// longer needed. On failure the memtable stays queued and visible to queries, since its
+// points are still in the log, and the error is reported to writers.
+func (e *Engine) flushFrozen(frozen *frozenMemTable) {
+	e.storageMu.Lock()
+	defer e.storageMu.Unlock()
+
+	// readers keep seeing the frozen memtable while copies of parquets are written
+	err := e.writeFrozen(frozen)
+	if err == nil {
+		err = e.publishFrozen(frozen)
+	}
+	if err != nil {
+		e.mu.Lock()
+		e.flushErr = err
+		e.flushed.Broadcast()
+		e.mu.Unlock()
+		return
+	}
+
+	e.mu.RLock()
+	recovering := e.recovering
+	e.mu.RUnlock()
+	if recovering {
+		return
+	}
+
+	_, err = e.wal.DeleteWalSegments(frozen.end.Segment)
+	if err != nil {
+		e.mu.Lock()
+		e.flushErr = err
+		e.flushed.Broadcast()
+		e.mu.Unlock()
+	}
+}
+
+// writeFrozen writes points of the frozen memtable to staged copies of the parquets they belong to.
+// Must be called with storageMu held, which is enough to read the frozen memtable, since writers
+// only change the active one.
+func (e *Engine) writeFrozen(frozen *frozenMemTable) error {
+	// copies left by a failed flush
+	err := os.RemoveAll(e.flushDir())
+	if err != nil {
+		return err
+	}
+	e.parquetManager.TakeStaged()
+
+	series := frozen.table.AllTimeSeries()
+
+	var newest uint64
+	for _, points := range series {
+		if len(points) > 0 {
+			newest = max(newest, points[len(points)-1].Timestamp)
+		}
+	}
+
+	err = e.UpdateTimeWindow(newest)
+	if err != nil {
+		return err
+	}
+
+	groups, err := e.prepareFlush(series)
+	if err != nil {
+		return err
+	}
+	err = e.flush(groups)
+	if err != nil {
+		return err
+	}
+
+	// series of flushed points have to be indexed before their log entries are gone
+	return e.seriesIndex.Save()
+}
+
+// publishFrozen swaps the staged parquets in place and removes the frozen memtable from the queue,
+// both while diskMu is held, so readers never see points both on disk and in memory
+func (e *Engine) publishFrozen(frozen *frozenMemTable) error {
+	e.diskMu.Lock()
+	defer e.diskMu.Unlock()
+
+	for _, parquetPath := range e.parquetManager.TakeStaged() {
+		err := e.publishParquet(parquetPath)
+		if err != nil {
+			return err
+		}
+	}
+	err := e.configuration.SetUnstagedPosition(frozen.end.Segment, frozen.end.Offset)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	// memtables are flushed in the order they were frozen
+	e.immutables = e.immutables[1:]
+	e.flushed.Broadcast()
+	e.mu.Unlock()
+
+	return os.RemoveAll(e.flushDir())
+}
+
+// publishParquet moves the staged copy of the parquet in its place, the original is kept as
+// a backup until the copy is in place
+func (e *Engine) publishParquet(parquetPath string) error {
+	staged := e.parquetManager.StagedPath(parquetPath)
+	backup := staged + backupSuffix
+
+	_, err := os.Stat(parquetPath)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if exists {
+		err = os.Rename(parquetPath, backup)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.Rename(staged, parquetPath)
+	if err != nil {
+		if exists {
+			return errors.Join(err, os.Rename(backup, parquetPath))
+		}
+		return err
+	}
+
+	// pages are cached under paths of both the copy and the original
+	err = e.pageManager.Invalidate(staged)
+	if err != nil {
+		return err
+	}
+	err = e.pageManager.Invalidate(parquetPath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	return e.pageManager.RemoveFile(backup)
+}
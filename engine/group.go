@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk"
+	"time-series-engine/internal/index"
+)
+
+// GroupAggregation is aggregation result of all selected series sharing values of the group by tags
+type GroupAggregation struct {
+	// Tags are the group by tags in the requested order, series without a tag have an empty value
+	Tags   internal.Tags
+	Result *AggregationResult
+}
+
+// AggregateGroupBy selects series of the measurement by the tag matchers, splits them into groups
+// by values of the groupBy tags and applies the aggregation function to points of each group
+// with timestamps in [minTimestamp, maxTimestamp], as if they were one series. Without groupBy
+// tags all selected series form one group. Groups without points are left out, the rest are
+// sorted by their tag values.
+func (e *Engine) AggregateGroupBy(
+	measurement string, matchers []*index.Matcher, groupBy []string,
+	minTimestamp, maxTimestamp uint64,
+	function string,
+) ([]*GroupAggregation, error) {
+	err := e.checkRetentionPeriod()
+	if err != nil {
+		return nil, err
+	}
+
+	e.diskMu.RLock()
+	defer e.diskMu.RUnlock()
+
+	parts := make(map[string]disk.Aggregator)
+	groups := make(map[string]internal.Tags)
+	for _, ts := range e.Series(measurement, matchers...) {
+		part, err := e.aggregator(ts, minTimestamp, maxTimestamp, function)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := part.Result(); !found {
+			continue
+		}
+
+		tags := groupTags(ts, groupBy)
+		key := groupKey(tags)
+		if merged, ok := parts[key]; ok {
+			merged.Merge(part)
+			continue
+		}
+		parts[key] = part
+		groups[key] = tags
+	}
+
+	keys := make([]string, 0, len(parts))
+	for key := range parts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*GroupAggregation, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &GroupAggregation{Tags: groups[key], Result: newAggregationResult(function, parts[key])})
+	}
+	return result, nil
+}
+
+// groupTags returns values of the groupBy tags of the series
+func groupTags(ts *internal.TimeSeries, groupBy []string) internal.Tags {
+	tags := make(internal.Tags, 0, len(groupBy))
+	for _, name := range groupBy {
+		value := ""
+		for _, tag := range ts.Tags {
+			if tag.Name == name {
+				value = tag.Value
+				break
+			}
+		}
+		tags = append(tags, internal.NewTag(name, value))
+	}
+	return tags
+}
+
+// groupKey joins tag values with a separator which sorts before any printable character
+func groupKey(tags internal.Tags) string {
+	values := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		values = append(values, tag.Value)
+	}
+	return strings.Join(values, "\x00")
+}
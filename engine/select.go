@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk/parquet"
+	"time-series-engine/internal/index"
+)
+
+// indexFileName is kept next to the windows directory, which may contain only windows
+const indexFileName = "series.index"
+
+// SeriesPoints are points of one of the selected series
+type SeriesPoints struct {
+	TimeSeries *internal.TimeSeries
+	Points     []*internal.Point
+}
+
+// SeriesAggregation is aggregation result of one of the selected series
+type SeriesAggregation struct {
+	TimeSeries *internal.TimeSeries
+	Result     *AggregationResult
+}
+
+// loadIndex loads the series catalog and index, or builds it from parquets on disk when there is none yet
+func (e *Engine) loadIndex() error {
+	path := filepath.Join(filepath.Dir(filepath.Clean(e.configuration.WindowsDirPath)), indexFileName)
+
+	idx, err := index.Load(path)
+	if err == nil {
+		e.seriesIndex = idx
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	e.seriesIndex = index.New(path)
+	err = e.indexDisk()
+	if err != nil {
+		return err
+	}
+	// series which are only in the log are indexed again during replay
+	return e.seriesIndex.Save()
+}
+
+// indexDisk adds series of all parquets in the windows directory to the index
+func (e *Engine) indexDisk() error {
+	windowsDir := e.configuration.WindowsDirPath
+	windows, err := os.ReadDir(windowsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, window := range windows {
+		if !window.IsDir() {
+			continue
+		}
+		parquets, err := os.ReadDir(filepath.Join(windowsDir, window.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, p := range parquets {
+			metaPath := filepath.Join(windowsDir, window.Name(), p.Name(), "metadata.db")
+			data, err := e.pageManager.ReadStructure(metaPath, 0)
+			if err != nil {
+				// parquet which was never closed has no metadata yet
+				continue
+			}
+			meta, err := parquet.DeserializeParquetMetadata(data)
+			if err != nil {
+				return err
+			}
+			ts, err := internal.ParseTimeSeriesHash(meta.TimeSeriesHash)
+			if err != nil {
+				return err
+			}
+			e.seriesIndex.Add(ts)
+		}
+	}
+	return nil
+}
+
+// Series returns all known series of the measurement selected by the tag matchers, sorted by hash.
+// Series stay known after all of their points are deleted or expired.
+func (e *Engine) Series(measurement string, matchers ...*index.Matcher) []*internal.TimeSeries {
+	return e.seriesIndex.Select(measurement, matchers...)
+}
+
+// SeriesID returns ID the series catalog assigned to the series, false if it is unknown.
+// IDs are kept as long as the catalog file is, rebuilding it assigns new ones.
+func (e *Engine) SeriesID(ts *internal.TimeSeries) (uint64, bool) {
+	return e.seriesIndex.ID(ts.Hash)
+}
+
+// SeriesByID returns series with the ID assigned by the series catalog
+func (e *Engine) SeriesByID(id uint64) (*internal.TimeSeries, bool) {
+	return e.seriesIndex.ByID(id)
+}
+
+// Measurements returns names of all known measurements, sorted
+func (e *Engine) Measurements() []string {
+	return e.seriesIndex.Measurements()
+}
+
+// TagKeys returns tag names used by series of the measurement, sorted
+func (e *Engine) TagKeys(measurement string) []string {
+	return e.seriesIndex.TagKeys(measurement)
+}
+
+// TagValues returns values of the tag among series of the measurement, sorted
+func (e *Engine) TagValues(measurement string, key string) []string {
+	return e.seriesIndex.TagValues(measurement, key)
+}
+
+// QueryMatching returns points with timestamps in [minTimestamp, maxTimestamp] of every series
+// of the measurement selected by the tag matchers. Series without such points are left out.
+func (e *Engine) QueryMatching(
+	measurement string, matchers []*index.Matcher,
+	minTimestamp, maxTimestamp uint64,
+) ([]*SeriesPoints, error) {
+	err := e.checkRetentionPeriod()
+	if err != nil {
+		return nil, err
+	}
+
+	e.diskMu.RLock()
+	defer e.diskMu.RUnlock()
+
+	result := make([]*SeriesPoints, 0)
+	for _, ts := range e.Series(measurement, matchers...) {
+		points, err := e.query(ts, minTimestamp, maxTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) > 0 {
+			result = append(result, &SeriesPoints{TimeSeries: ts, Points: points})
+		}
+	}
+	return result, nil
+}
+
+// AggregateMatching applies the aggregation function to every series of the measurement selected
+// by the tag matchers separately. Series without points in the range are left out.
+func (e *Engine) AggregateMatching(
+	measurement string, matchers []*index.Matcher,
+	minTimestamp, maxTimestamp uint64,
+	function string,
+) ([]*SeriesAggregation, error) {
+	err := e.checkRetentionPeriod()
+	if err != nil {
+		return nil, err
+	}
+
+	e.diskMu.RLock()
+	defer e.diskMu.RUnlock()
+
+	result := make([]*SeriesAggregation, 0)
+	for _, ts := range e.Series(measurement, matchers...) {
+		aggregation, err := e.aggregate(ts, minTimestamp, maxTimestamp, function)
+		if err != nil {
+			return nil, err
+		}
+		if aggregation.Found {
+			result = append(result, &SeriesAggregation{TimeSeries: ts, Result: aggregation})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"time-series-engine/internal"
+	"time-series-engine/internal/query"
+)
+
+// Result of a statement of the query language, one series per selected time series
+// for raw values, or per group for aggregations
+type Result struct {
+	Function string // empty for raw values
+	Series   []*ResultSeries
+}
+
+type ResultSeries struct {
+	Measurement string
+	// Tags of the time series, or the group by tags of the group
+	Tags internal.Tags
+	Rows []*Row
+}
+
+// Row is a point, a bucket, or aggregation of the whole range starting at Timestamp
+type Row struct {
+	Timestamp uint64
+	Value     float64
+	Found     bool // false for aggregations without points, and buckets left empty by the fill mode
+}
+
+// Execute parses and runs a statement of the query language, see package query.
+// Syntax errors are returned as *query.Error.
+func (e *Engine) Execute(statement string) (*Result, error) {
+	q, err := query.Parse(statement)
+	if err != nil {
+		return nil, err
+	}
+	return e.ExecuteQuery(q)
+}
+
+// ExecuteQuery runs a parsed statement, mapping it on Query, AggregateGroupBy or AggregateGroupBuckets
+func (e *Engine) ExecuteQuery(q *query.Query) (*Result, error) {
+	now := e.precision.Now()
+	minTimestamp, maxTimestamp, hasMax := e.timeRange(q.TimeConditions, now)
+	// buckets are counted up to now, unless the range ends elsewhere
+	if q.Interval != 0 && !hasMax {
+		maxTimestamp = now
+	}
+
+	result := &Result{Function: q.Function, Series: make([]*ResultSeries, 0)}
+	if minTimestamp > maxTimestamp {
+		return result, nil
+	}
+
+	switch {
+	case q.Function == "":
+		series, err := e.QueryMatching(q.Measurement, q.Matchers, minTimestamp, maxTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			rows := make([]*Row, 0, len(s.Points))
+			for _, p := range s.Points {
+				rows = append(rows, &Row{Timestamp: p.Timestamp, Value: p.Value, Found: true})
+			}
+			result.Series = append(result.Series, &ResultSeries{Measurement: s.TimeSeries.MeasurementName, Tags: s.TimeSeries.Tags, Rows: rows})
+		}
+
+	case q.Interval == 0:
+		groups, err := e.AggregateGroupBy(q.Measurement, q.Matchers, q.GroupBy, minTimestamp, maxTimestamp, q.Function)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			row := &Row{Timestamp: minTimestamp, Value: g.Result.Value, Found: g.Result.Found}
+			result.Series = append(result.Series, &ResultSeries{Measurement: q.Measurement, Tags: g.Tags, Rows: []*Row{row}})
+		}
+
+	default:
+		interval := e.timestampUnits(q.Interval)
+		if interval == 0 {
+			return nil, fmt.Errorf("bucket interval %s is shorter than timestamp precision %s", q.Interval, e.precision)
+		}
+		fill := q.Fill
+		if fill == "" {
+			fill = FillNone
+		}
+
+		groups, err := e.AggregateGroupBuckets(q.Measurement, q.Matchers, q.GroupBy, minTimestamp, maxTimestamp, interval, q.Function, fill)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			rows := make([]*Row, 0, len(g.Buckets))
+			for _, b := range g.Buckets {
+				rows = append(rows, &Row{Timestamp: b.Start, Value: b.Value, Found: b.Found})
+			}
+			result.Series = append(result.Series, &ResultSeries{Measurement: q.Measurement, Tags: g.Tags, Rows: rows})
+		}
+	}
+
+	return result, nil
+}
+
+// timeRange intersects the time conditions into [minTimestamp, maxTimestamp], which is empty
+// when minTimestamp is after maxTimestamp. It also reports whether any condition bounds it from above.
+func (e *Engine) timeRange(conditions []*query.TimeCondition, now uint64) (uint64, uint64, bool) {
+	minTimestamp, maxTimestamp := uint64(0), uint64(math.MaxUint64)
+	hasMax := false
+
+	for _, c := range conditions {
+		timestamp := c.Time.Timestamp
+		if c.Time.Now {
+			timestamp = e.offsetTimestamp(now, c.Time.Offset)
+		}
+
+		switch c.Operator {
+		case "=":
+			minTimestamp, maxTimestamp = max(minTimestamp, timestamp), min(maxTimestamp, timestamp)
+			hasMax = true
+		case ">=":
+			minTimestamp = max(minTimestamp, timestamp)
+		case ">":
+			if timestamp == math.MaxUint64 {
+				return 1, 0, true
+			}
+			minTimestamp = max(minTimestamp, timestamp+1)
+		case "<=":
+			maxTimestamp = min(maxTimestamp, timestamp)
+			hasMax = true
+		case "<":
+			if timestamp == 0 {
+				return 1, 0, true
+			}
+			maxTimestamp = min(maxTimestamp, timestamp-1)
+			hasMax = true
+		}
+	}
+	return minTimestamp, maxTimestamp, hasMax
+}
+
+// timestampUnits converts the duration to units of the engine precision, truncating
+func (e *Engine) timestampUnits(d time.Duration) uint64 {
+	return uint64(d.Abs().Nanoseconds()) / (1_000_000_000 / e.precision.PerSecond())
+}
+
+// offsetTimestamp moves the timestamp by the duration, saturating at the ends of the range
+func (e *Engine) offsetTimestamp(timestamp uint64, d time.Duration) uint64 {
+	units := e.timestampUnits(d)
+	if d < 0 {
+		if units > timestamp {
+			return 0
+		}
+		return timestamp - units
+	}
+	if units > math.MaxUint64-timestamp {
+		return math.MaxUint64
+	}
+	return timestamp + units
+}
@@ -0,0 +1,329 @@
+package engine
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time-series-engine/config"
+	"time-series-engine/internal/disk"
+	"time-series-engine/internal/disk/parquet"
+)
+
+// compactionDirName is kept next to the windows directory, rewritten parquets are
+// written there before they replace the originals
+const compactionDirName = "compaction"
+
+// flushDirName is kept next to the windows directory, flushes write copies of the parquets
+// they change there before they replace the originals
+const flushDirName = "flush"
+
+// backupSuffix marks an original parquet moved aside while its rewrite takes its place
+const backupSuffix = ".old"
+
+// StorageStats describes data stored in the windows directory
+type StorageStats struct {
+	Windows       int
+	Parquets      int
+	RowGroups     int
+	Points        uint64 // points written to row groups, including deleted ones
+	DeletedPoints uint64
+	// Uncompacted counts parquets which Compact would rewrite
+	Uncompacted int
+	// CompressedRowGroups counts row groups with compressed timestamp and value pages
+	CompressedRowGroups int
+	Bytes               int64 // size of parquet files on disk
+	Series              int
+}
+
+// Inspect collects statistics of windows, parquets and row groups on disk
+func (e *Engine) Inspect() (*StorageStats, error) {
+	e.diskMu.RLock()
+	defer e.diskMu.RUnlock()
+
+	stats := &StorageStats{Series: e.seriesIndex.Len()}
+	err := e.walkParquets(func(window string, parquetPath string) error {
+		rowGroups, err := disk.RowGroupsMetadata(e.pageManager, parquetPath)
+		if err != nil {
+			return err
+		}
+		stats.Parquets++
+		stats.RowGroups += len(rowGroups)
+		for _, meta := range rowGroups {
+			stats.Points += meta.PointsNumber
+			stats.DeletedPoints += meta.DeletedPoints
+		}
+
+		rowGroupPaths, err := rowGroupPaths(parquetPath)
+		if err != nil {
+			return err
+		}
+		for _, rgPath := range rowGroupPaths {
+			if e.pageManager.IsCompressed(filepath.Join(rgPath, "timestamp.db")) {
+				stats.CompressedRowGroups++
+			}
+		}
+		err = filepath.WalkDir(parquetPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			stats.Bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		uncompacted, err := disk.NeedsCompaction(e.pageManager, parquetPath, e.configuration.RowGroupSize)
+		if uncompacted {
+			stats.Uncompacted++
+		}
+		return err
+	}, func(string) {
+		stats.Windows++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Compact rewrites parquets with deleted or overwritten points, or row groups which are not full,
+// so that only live points remain, sorted in full row groups. Afterwards pages of windows which
+// ended are compressed, when compression is configured. Returns number of rewritten parquets.
+func (e *Engine) Compact() (int, error) {
+	e.storageMu.Lock()
+	defer e.storageMu.Unlock()
+	e.diskMu.Lock()
+	defer e.diskMu.Unlock()
+
+	compactionDir := e.compactionDir()
+	err := os.RemoveAll(compactionDir)
+	if err != nil {
+		return 0, err
+	}
+
+	compacted := 0
+	err = e.walkParquets(func(window string, parquetPath string) error {
+		needed, err := disk.NeedsCompaction(e.pageManager, parquetPath, e.configuration.RowGroupSize)
+		if err != nil || !needed {
+			return err
+		}
+
+		rewritten, err := e.compactParquet(parquetPath, filepath.Join(compactionDir, window, filepath.Base(parquetPath)))
+		if rewritten {
+			compacted++
+		}
+		return err
+	}, nil)
+	if err != nil {
+		return compacted, err
+	}
+	err = os.RemoveAll(compactionDir)
+	if err != nil {
+		return compacted, err
+	}
+
+	if e.configuration.Compression == config.CompressionNone {
+		return compacted, nil
+	}
+	return compacted, e.compressColdWindows()
+}
+
+// compressColdWindows compresses timestamp and value pages of windows which ended. Delete pages
+// are left as they are, since deletes change them in place. Points written to such a window later
+// decompress only the row group they are appended to.
+func (e *Engine) compressColdWindows() error {
+	now := e.precision.Now()
+	return e.walkParquets(func(window string, parquetPath string) error {
+		_, maxTimestamp, err := disk.MinMaxTimestamp(window)
+		if err != nil || maxTimestamp >= now {
+			return err
+		}
+
+		rowGroupPaths, err := rowGroupPaths(parquetPath)
+		if err != nil {
+			return err
+		}
+		for _, rgPath := range rowGroupPaths {
+			for _, column := range []string{"timestamp.db", "value.db"} {
+				_, err = e.pageManager.CompressFile(filepath.Join(rgPath, column))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// rowGroupPaths returns paths of row groups of the parquet, in order
+func rowGroupPaths(parquetPath string) ([]string, error) {
+	entries, err := os.ReadDir(parquetPath)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			paths = append(paths, filepath.Join(parquetPath, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// compactParquet writes the parquet again to tmpPath and swaps it in, the original is kept as
+// a backup until the rewrite is in place. Parquet without live points is removed, and since names
+// of parquets in a window have to stay contiguous, the last parquet of the window takes its place.
+func (e *Engine) compactParquet(parquetPath string, tmpPath string) (bool, error) {
+	written, err := disk.RewriteParquet(e.pageManager, parquetPath, tmpPath, &e.configuration.ParquetConfig)
+	if err != nil {
+		return false, err
+	}
+
+	replacement := tmpPath
+	if written == 0 {
+		replacement, err = lastParquet(filepath.Dir(parquetPath))
+		if err != nil {
+			return false, err
+		}
+		if replacement == parquetPath {
+			replacement = ""
+		}
+	}
+
+	backup := tmpPath + backupSuffix
+	err = os.MkdirAll(filepath.Dir(backup), 0755)
+	if err != nil {
+		return false, err
+	}
+	err = os.Rename(parquetPath, backup)
+	if err != nil {
+		return false, err
+	}
+	if replacement != "" {
+		err = os.Rename(replacement, parquetPath)
+		if err != nil {
+			return false, errors.Join(err, os.Rename(backup, parquetPath))
+		}
+		err = e.pageManager.Invalidate(replacement)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	// pages of the original are cached under the same path
+	err = e.pageManager.Invalidate(parquetPath)
+	if err != nil {
+		return true, err
+	}
+	return true, e.pageManager.RemoveFile(backup)
+}
+
+// lastParquet returns path of the parquet with the highest name in the window, empty when there is none
+func lastParquet(windowPath string) (string, error) {
+	entries, err := os.ReadDir(windowPath)
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].IsDir() {
+			return filepath.Join(windowPath, entries[i].Name()), nil
+		}
+	}
+	return "", nil
+}
+
+// recoverStaging puts back originals of parquets whose swap from the staging directory was
+// interrupted, and removes rewrites which were not swapped in yet
+func (e *Engine) recoverStaging(stagingDir string) error {
+	windows, err := os.ReadDir(stagingDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, window := range windows {
+		entries, err := os.ReadDir(filepath.Join(stagingDir, window.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name, isBackup := strings.CutSuffix(entry.Name(), backupSuffix)
+			if !isBackup {
+				continue
+			}
+			original := filepath.Join(e.configuration.WindowsDirPath, window.Name(), name)
+			_, err = os.Stat(original)
+			if err == nil {
+				// the rewrite is already in place
+				continue
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			err = os.Rename(filepath.Join(stagingDir, window.Name(), entry.Name()), original)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return os.RemoveAll(stagingDir)
+}
+
+func (e *Engine) compactionDir() string {
+	return filepath.Join(filepath.Dir(filepath.Clean(e.configuration.WindowsDirPath)), compactionDirName)
+}
+
+func (e *Engine) flushDir() string {
+	return filepath.Join(filepath.Dir(filepath.Clean(e.configuration.WindowsDirPath)), flushDirName)
+}
+
+// walkParquets calls visit for every closed parquet in the windows directory, and window
+// for every window before its parquets, when it is not nil
+func (e *Engine) walkParquets(visit func(window string, parquetPath string) error, window func(string)) error {
+	windowsDir := e.configuration.WindowsDirPath
+	windows, err := os.ReadDir(windowsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range windows {
+		if !w.IsDir() {
+			continue
+		}
+		if window != nil {
+			window(w.Name())
+		}
+		parquets, err := os.ReadDir(filepath.Join(windowsDir, w.Name()))
+		if err != nil {
+			return err
+		}
+
+		// from the last one, so that a parquet moved into place of a removed one was already visited
+		for i := len(parquets) - 1; i >= 0; i-- {
+			p := parquets[i]
+			parquetPath := filepath.Join(windowsDir, w.Name(), p.Name())
+			data, err := e.pageManager.ReadStructure(filepath.Join(parquetPath, "metadata.db"), 0)
+			if err != nil {
+				// parquet which was never closed has no metadata yet
+				continue
+			}
+			if _, err = parquet.DeserializeParquetMetadata(data); err != nil {
+				return err
+			}
+			err = visit(w.Name(), parquetPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package disk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time-series-engine/internal"
+)
+
+// Aggregator folds points into a single value. Points may be split into disjoint parts,
+// such as memtables and parquets, aggregated separately and combined with Merge,
+// which accepts only aggregators created for the same function.
+type Aggregator interface {
+	Add(p *internal.Point)
+	Merge(other Aggregator)
+	// Result returns false when no points were added
+	Result() (float64, bool)
+}
+
+// Statistics summarize values of a set of points, such as of a row group
+type Statistics struct {
+	Count uint64
+	Min   float64
+	Max   float64
+	Sum   float64
+}
+
+// StatisticsAggregator is implemented by aggregators which can add a set of points
+// by its statistics, without reading the points
+type StatisticsAggregator interface {
+	AddStatistics(s *Statistics)
+}
+
+// NewAggregator returns aggregator of the function, which is one of Min, Max, Mean, Average,
+// Sum, Count, First, Last, Spread, Stddev, Median or a percentile such as P95 or P99.9
+func NewAggregator(function string) (Aggregator, error) {
+	switch function {
+	case "Min":
+		return &extremeAggregator{less: func(a, b float64) bool { return a < b }}, nil
+	case "Max":
+		return &extremeAggregator{less: func(a, b float64) bool { return a > b }}, nil
+	case "Mean", "Average":
+		return &meanAggregator{}, nil
+	case "Sum":
+		return &sumAggregator{}, nil
+	case "Count":
+		return &countAggregator{}, nil
+	case "First":
+		return &edgeAggregator{first: true}, nil
+	case "Last":
+		return &edgeAggregator{first: false}, nil
+	case "Spread":
+		return &spreadAggregator{}, nil
+	case "Stddev":
+		return &stddevAggregator{}, nil
+	case "Median":
+		return &percentileAggregator{percentile: 50}, nil
+	}
+
+	if p, ok := strings.CutPrefix(function, "P"); ok {
+		percentile, err := strconv.ParseFloat(p, 64)
+		if err == nil && percentile >= 0 && percentile <= 100 {
+			return &percentileAggregator{percentile: percentile}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported aggregation function: %s", function)
+}
+
+type extremeAggregator struct {
+	less  func(a, b float64) bool
+	value float64
+	found bool
+}
+
+func (a *extremeAggregator) Add(p *internal.Point) {
+	if !a.found || a.less(p.Value, a.value) {
+		a.value = p.Value
+		a.found = true
+	}
+}
+
+func (a *extremeAggregator) Merge(other Aggregator) {
+	o := other.(*extremeAggregator)
+	if o.found {
+		a.Add(&internal.Point{Value: o.value})
+	}
+}
+
+func (a *extremeAggregator) AddStatistics(s *Statistics) {
+	if s.Count > 0 {
+		a.Add(&internal.Point{Value: s.Min})
+		a.Add(&internal.Point{Value: s.Max})
+	}
+}
+
+func (a *extremeAggregator) Result() (float64, bool) {
+	return a.value, a.found
+}
+
+type meanAggregator struct {
+	sum   float64
+	count uint64
+}
+
+func (a *meanAggregator) Add(p *internal.Point) {
+	a.sum += p.Value
+	a.count++
+}
+
+func (a *meanAggregator) Merge(other Aggregator) {
+	o := other.(*meanAggregator)
+	a.sum += o.sum
+	a.count += o.count
+}
+
+func (a *meanAggregator) AddStatistics(s *Statistics) {
+	a.sum += s.Sum
+	a.count += s.Count
+}
+
+func (a *meanAggregator) Result() (float64, bool) {
+	if a.count == 0 {
+		return 0, false
+	}
+	return a.sum / float64(a.count), true
+}
+
+type sumAggregator struct {
+	sum   float64
+	found bool
+}
+
+func (a *sumAggregator) Add(p *internal.Point) {
+	a.sum += p.Value
+	a.found = true
+}
+
+func (a *sumAggregator) Merge(other Aggregator) {
+	o := other.(*sumAggregator)
+	a.sum += o.sum
+	a.found = a.found || o.found
+}
+
+func (a *sumAggregator) AddStatistics(s *Statistics) {
+	a.sum += s.Sum
+	a.found = a.found || s.Count > 0
+}
+
+func (a *sumAggregator) Result() (float64, bool) {
+	return a.sum, a.found
+}
+
+type countAggregator struct {
+	count uint64
+}
+
+func (a *countAggregator) Add(*internal.Point) {
+	a.count++
+}
+
+func (a *countAggregator) Merge(other Aggregator) {
+	a.count += other.(*countAggregator).count
+}
+
+func (a *countAggregator) AddStatistics(s *Statistics) {
+	a.count += s.Count
+}
+
+func (a *countAggregator) Result() (float64, bool) {
+	return float64(a.count), a.count > 0
+}
+
+// edgeAggregator keeps value of the earliest or the latest point, whichever was added first on equal timestamps
+type edgeAggregator struct {
+	first bool
+	point internal.Point
+	found bool
+}
+
+func (a *edgeAggregator) Add(p *internal.Point) {
+	if !a.found ||
+		(a.first && p.Timestamp < a.point.Timestamp) ||
+		(!a.first && p.Timestamp > a.point.Timestamp) {
+		a.point = *p
+		a.found = true
+	}
+}
+
+func (a *edgeAggregator) Merge(other Aggregator) {
+	o := other.(*edgeAggregator)
+	if o.found {
+		a.Add(&o.point)
+	}
+}
+
+func (a *edgeAggregator) Result() (float64, bool) {
+	return a.point.Value, a.found
+}
+
+type spreadAggregator struct {
+	min, max float64
+	found    bool
+}
+
+func (a *spreadAggregator) Add(p *internal.Point) {
+	if !a.found {
+		a.min, a.max, a.found = p.Value, p.Value, true
+		return
+	}
+	a.min = math.Min(a.min, p.Value)
+	a.max = math.Max(a.max, p.Value)
+}
+
+func (a *spreadAggregator) Merge(other Aggregator) {
+	o := other.(*spreadAggregator)
+	if o.found {
+		a.Add(&internal.Point{Value: o.min})
+		a.Add(&internal.Point{Value: o.max})
+	}
+}
+
+func (a *spreadAggregator) AddStatistics(s *Statistics) {
+	if s.Count > 0 {
+		a.Add(&internal.Point{Value: s.Min})
+		a.Add(&internal.Point{Value: s.Max})
+	}
+}
+
+func (a *spreadAggregator) Result() (float64, bool) {
+	return a.max - a.min, a.found
+}
+
+// stddevAggregator computes sample standard deviation with Welford's algorithm,
+// merging parts as described by Chan et al.
+type stddevAggregator struct {
+	count uint64
+	mean  float64
+	m2    float64 // sum of squared differences from the mean
+}
+
+func (a *stddevAggregator) Add(p *internal.Point) {
+	a.count++
+	delta := p.Value - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (p.Value - a.mean)
+}
+
+func (a *stddevAggregator) Merge(other Aggregator) {
+	o := other.(*stddevAggregator)
+	if o.count == 0 {
+		return
+	}
+	if a.count == 0 {
+		*a = *o
+		return
+	}
+
+	count := a.count + o.count
+	delta := o.mean - a.mean
+	a.m2 += o.m2 + delta*delta*float64(a.count)*float64(o.count)/float64(count)
+	a.mean += delta * float64(o.count) / float64(count)
+	a.count = count
+}
+
+// Result is 0 for a single point
+func (a *stddevAggregator) Result() (float64, bool) {
+	if a.count < 2 {
+		return 0, a.count == 1
+	}
+	return math.Sqrt(a.m2 / float64(a.count-1)), true
+}
+
+// percentileAggregator keeps all values, interpolating linearly between the closest ranks
+type percentileAggregator struct {
+	percentile float64
+	values     []float64
+}
+
+func (a *percentileAggregator) Add(p *internal.Point) {
+	a.values = append(a.values, p.Value)
+}
+
+func (a *percentileAggregator) Merge(other Aggregator) {
+	a.values = append(a.values, other.(*percentileAggregator).values...)
+}
+
+func (a *percentileAggregator) Result() (float64, bool) {
+	if len(a.values) == 0 {
+		return 0, false
+	}
+	sort.Float64s(a.values)
+
+	rank := a.percentile / 100 * float64(len(a.values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+	return a.values[lower] + (a.values[upper]-a.values[lower])*fraction, true
+}
@@ -1,6 +1,8 @@
 package chunk
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"time-series-engine/internal/disk/entry"
 	"time-series-engine/internal/disk/page"
@@ -10,26 +12,33 @@ type DeleteChunk struct {
 	ActivePage    *page.DeletePage
 	FilePath      string
 	CurrentOffset uint64
+	// Codec of new pages of the chunk
+	Codec page.Codec
 }
 
 func NewDeleteChunk(pageSize uint64, filePath string) *DeleteChunk {
+	return NewDeleteChunkWithCodec(pageSize, filePath, page.DeleteBitmap)
+}
+
+func NewDeleteChunkWithCodec(pageSize uint64, filePath string, codec page.Codec) *DeleteChunk {
 	return &DeleteChunk{
-		ActivePage:    page.NewDeletePage(pageSize),
+		ActivePage:    page.NewDeletePageWithCodec(pageSize, codec),
 		FilePath:      filePath,
 		CurrentOffset: 0,
+		Codec:         codec,
 	}
 }
 
 func (dc *DeleteChunk) Add(pm *page.Manager, deleted bool) error {
 	de := entry.NewDeleteEntry(deleted)
 
-	if de.Size() > dc.ActivePage.Padding {
+	if !dc.ActivePage.Fits(deleted) {
 		err := pm.WritePage(dc.ActivePage, dc.FilePath, int64(dc.CurrentOffset))
 		if err != nil {
 			return err
 		}
 		dc.CurrentOffset += pm.Config.PageSize
-		dc.ActivePage = page.NewDeletePage(pm.Config.PageSize)
+		dc.ActivePage = page.NewDeletePageWithCodec(pm.Config.PageSize, dc.Codec)
 	}
 
 	dc.ActivePage.Add(de)
@@ -52,5 +61,104 @@ func (dc *DeleteChunk) Load(pm *page.Manager) error {
 	}
 
 	dc.ActivePage = p.(*page.DeletePage)
+	// pages added later keep codec of the loaded one
+	dc.Codec = dc.ActivePage.Codec
 	return nil
 }
+
+// WriteDeleteChunk writes pages of the rows to a new delete column in filePath, for example once
+// deleted rows don't fit pages of the existing one any more. Returns offset of the last page.
+func WriteDeleteChunk(pm *page.Manager, filePath string, codec page.Codec, rows []bool) (uint64, error) {
+	err := os.Remove(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	err = pm.Invalidate(filePath)
+	if err != nil {
+		return 0, err
+	}
+	err = pm.CreateFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	dc := NewDeleteChunkWithCodec(pm.Config.PageSize, filePath, codec)
+	for _, deleted := range rows {
+		err = dc.Add(pm, deleted)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = dc.Save(pm)
+	if err != nil {
+		return 0, err
+	}
+	return dc.CurrentOffset, nil
+}
+
+// DirtyPage is a page of a delete column changed since it was read, at its offset in the column
+type DirtyPage struct {
+	Page   *page.DeletePage
+	Offset int64
+}
+
+// WriteDirtyPages writes changed pages in place of the pages of the delete column in filePath
+func WriteDirtyPages(pm *page.Manager, filePath string, dirty []DirtyPage) error {
+	for _, d := range dirty {
+		err := pm.WritePage(d.Page, filePath, d.Offset)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RewriteOverflowingChunk writes the delete column in filePath, whose last page is at lastOffset,
+// again with more pages once some of the changed pages don't fit a page any more. Run length
+// encoded pages hold more rows than a bitmap, so they may stop fitting once rows are deleted.
+// The new column replaces the old one before returning offset of its last page.
+func RewriteOverflowingChunk(pm *page.Manager, filePath string, lastOffset uint64, dirty []DirtyPage) (uint64, bool, error) {
+	overflows := false
+	pages := make(map[int64]*page.DeletePage, len(dirty))
+	for _, d := range dirty {
+		overflows = overflows || d.Page.Overflows()
+		pages[d.Offset] = d.Page
+	}
+	if !overflows {
+		return lastOffset, false, nil
+	}
+
+	rows := make([]bool, 0)
+	for offset := uint64(0); offset <= lastOffset; offset += pm.Config.PageSize {
+		p, ok := pages[int64(offset)]
+		if !ok {
+			bytes, err := pm.ReadPage(filePath, int64(offset))
+			if err != nil {
+				return 0, false, err
+			}
+			read, err := page.DeserializeDeletePage(bytes)
+			if err != nil {
+				return 0, false, err
+			}
+			p = read.(*page.DeletePage)
+		}
+		for _, en := range p.Entries {
+			rows = append(rows, en.(*entry.DeleteEntry).Deleted)
+		}
+	}
+
+	// last page is where appending to the row group continues
+	lastOffset, err := WriteDeleteChunk(pm, filePath+".tmp", page.DeleteRunLength, rows)
+	if err != nil {
+		return 0, false, err
+	}
+	err = os.Rename(filePath+".tmp", filePath)
+	if err != nil {
+		return 0, false, err
+	}
+	err = pm.Invalidate(filePath)
+	if err != nil {
+		return 0, false, err
+	}
+	return lastOffset, true, nil
+}
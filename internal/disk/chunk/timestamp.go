@@ -9,13 +9,20 @@ type TimestampChunk struct {
 	ActivePage    *page.TimestampPage
 	FilePath      string
 	CurrentOffset uint64
+	// Codec of new pages of the chunk
+	Codec page.Codec
 }
 
 func NewTimestampChunk(pageSize uint64, filePath string) *TimestampChunk {
+	return NewTimestampChunkWithCodec(pageSize, filePath, page.TimestampVarint)
+}
+
+func NewTimestampChunkWithCodec(pageSize uint64, filePath string, codec page.Codec) *TimestampChunk {
 	return &TimestampChunk{
-		ActivePage:    page.NewTimestampPage(pageSize),
+		ActivePage:    page.NewTimestampPageWithCodec(pageSize, codec),
 		FilePath:      filePath,
 		CurrentOffset: 0,
+		Codec:         codec,
 	}
 }
 
@@ -25,14 +32,14 @@ func (tsc *TimestampChunk) Add(pm *page.Manager, timestamp uint64) error {
 
 	tse := entry.NewTimestampEntry(timestamp, cd)
 
-	if tse.Size() > tsc.ActivePage.Padding {
+	if !tsc.ActivePage.Fits(tse) {
 		err := pm.WritePage(tsc.ActivePage, tsc.FilePath, int64(tsc.CurrentOffset))
 		if err != nil {
 			return err
 		}
 		tsc.CurrentOffset += pm.Config.PageSize
 
-		tsc.ActivePage = page.NewTimestampPage(pm.Config.PageSize)
+		tsc.ActivePage = page.NewTimestampPageWithCodec(pm.Config.PageSize, tsc.Codec)
 		tse.CompressedData = tsc.ActivePage.TimestampCompressor.CompressNext(
 			timestamp, tsc.ActivePage.Metadata.Count)
 	}
@@ -53,5 +60,7 @@ func (tsc *TimestampChunk) Load(pm *page.Manager) error {
 	}
 
 	tsc.ActivePage = timestampPage.(*page.TimestampPage)
+	// pages added later keep codec of the loaded one
+	tsc.Codec = tsc.ActivePage.Codec
 	return nil
 }
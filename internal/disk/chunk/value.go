@@ -9,16 +9,28 @@ type ValueChunk struct {
 	ActivePage    *page.ValuePage
 	FilePath      string
 	CurrentOffset uint64
+	// Codec of new pages of the chunk
+	Codec page.Codec
 }
 
 func NewValueChunk(pageSize uint64, filePath string) *ValueChunk {
+	return NewValueChunkWithCodec(pageSize, filePath, page.ValueScaled)
+}
+
+func NewValueChunkWithCodec(pageSize uint64, filePath string, codec page.Codec) *ValueChunk {
 	return &ValueChunk{
-		ActivePage:    page.NewValuePage(pageSize),
+		ActivePage:    page.NewValuePageWithCodec(pageSize, codec),
 		FilePath:      filePath,
 		CurrentOffset: 0,
+		Codec:         codec,
 	}
 }
 
+// StoredValue returns value as it is read back from the chunk
+func (vc *ValueChunk) StoredValue(value float64) float64 {
+	return vc.ActivePage.StoredValue(value)
+}
+
 func (vc *ValueChunk) Add(pm *page.Manager, value float64) error {
 	cd := vc.ActivePage.ValueCompressor.CompressNext(value, vc.ActivePage.Metadata.Count)
 	ve := entry.NewValueEntry(value, cd)
@@ -32,7 +44,7 @@ func (vc *ValueChunk) Add(pm *page.Manager, value float64) error {
 
 		vc.CurrentOffset += pm.Config.PageSize
 
-		vc.ActivePage = page.NewValuePage(pm.Config.PageSize)
+		vc.ActivePage = page.NewValuePageWithCodec(pm.Config.PageSize, vc.Codec)
 		ve.CompressedData = vc.ActivePage.ValueCompressor.CompressNext(value, vc.ActivePage.Metadata.Count)
 	}
 
@@ -52,5 +64,7 @@ func (vc *ValueChunk) Load(pm *page.Manager) error {
 	}
 
 	vc.ActivePage = valuePage.(*page.ValuePage)
+	// pages added later keep codec of the loaded one
+	vc.Codec = vc.ActivePage.Codec
 	return nil
 }
@@ -0,0 +1,133 @@
+package disk
+
+import (
+	"math"
+	"path/filepath"
+	"time-series-engine/config"
+	"time-series-engine/internal/disk/page"
+	"time-series-engine/internal/disk/parquet"
+	"time-series-engine/internal/disk/row_group"
+)
+
+// NeedsCompaction reports whether rewriting the parquet would change its layout, because it has
+// deleted points, row groups which are out of order or not full, or row groups without statistics
+func NeedsCompaction(pm *page.Manager, parquetPath string, rowGroupSize uint64) (bool, error) {
+	rowGroups, err := parquetRowGroups(pm, parquetPath, 0, math.MaxUint64)
+	if err != nil {
+		return false, err
+	}
+
+	for i, rg := range rowGroups {
+		meta := rg.meta
+		if !meta.HasStatistics || meta.DeletedPoints > 0 {
+			return true, nil
+		}
+		// sorted and disjoint row groups don't hide overwritten points either
+		if i > 0 && meta.MinTimestamp <= rowGroups[i-1].meta.MaxTimestamp {
+			return true, nil
+		}
+		if i < len(rowGroups)-1 && meta.PointsNumber < rowGroupSize {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RewriteParquet writes points of the parquet, which are not deleted nor overwritten, to a new parquet
+// in targetPath in full row groups, with codecs of the parquet. Returns number of written points,
+// nothing is written without them.
+func RewriteParquet(pm *page.Manager, parquetPath string, targetPath string, c *config.ParquetConfig) (uint64, error) {
+	data, err := pm.ReadStructure(filepath.Join(parquetPath, "metadata.db"), 0)
+	if err != nil {
+		return 0, err
+	}
+	meta, err := parquet.DeserializeParquetMetadata(data)
+	if err != nil {
+		return 0, err
+	}
+	encoding, err := parquetEncoding(pm, parquetPath)
+	if err != nil {
+		return 0, err
+	}
+
+	it, err := NewParquetIterator(pm, parquetPath, 0, math.MaxUint64)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+
+	var rewritten *parquet.Parquet
+	var written uint64
+	for it.Next() {
+		if rewritten == nil {
+			rewritten, err = parquet.NewParquetWithEncoding(meta.TimeSeriesHash, meta.Precision, c, pm, targetPath, encoding)
+			if err != nil {
+				return 0, err
+			}
+		}
+		err = rewritten.AddPoint(it.At())
+		if err != nil {
+			return 0, err
+		}
+		written++
+	}
+	if err = it.Err(); err != nil {
+		return 0, err
+	}
+
+	if rewritten != nil {
+		err = rewritten.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return written, nil
+}
+
+// parquetEncoding returns codecs the parquet is written with, so rewriting it keeps stored values.
+// Codecs of the last row group win, but values of any lossless row group stay lossless.
+func parquetEncoding(pm *page.Manager, parquetPath string) (row_group.Encoding, error) {
+	rowGroups, err := parquetRowGroups(pm, parquetPath, 0, math.MaxUint64)
+	if err != nil {
+		return row_group.Encoding{}, err
+	}
+
+	var encoding row_group.Encoding
+	lossless := false
+	for _, rg := range rowGroups {
+		if rg.meta.PointsNumber == 0 {
+			continue
+		}
+		rgEncoding, err := row_group.ReadEncoding(pm, rg.path)
+		if err != nil {
+			return row_group.Encoding{}, err
+		}
+		if rgEncoding.Timestamp != nil {
+			encoding.Timestamp = rgEncoding.Timestamp
+		}
+		if rgEncoding.Value != nil {
+			encoding.Value = rgEncoding.Value
+			lossless = lossless || rgEncoding.Value == page.ValueLossless
+		}
+		if rgEncoding.Delete != nil {
+			encoding.Delete = rgEncoding.Delete
+		}
+	}
+	if lossless {
+		encoding.Value = page.ValueLossless
+	}
+	return encoding, nil
+}
+
+// RowGroupsMetadata returns metadata of all row groups of the parquet, in the order they were written
+func RowGroupsMetadata(pm *page.Manager, parquetPath string) ([]*row_group.Metadata, error) {
+	rowGroups, err := parquetRowGroups(pm, parquetPath, 0, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]*row_group.Metadata, 0, len(rowGroups))
+	for _, rg := range rowGroups {
+		metas = append(metas, rg.meta)
+	}
+	return metas, nil
+}
@@ -31,8 +31,9 @@ func DeserializeTimestampEntry(b []byte) (*TimestampEntry, uint64) {
 	}, uint64(n)
 }
 
+// Size returns number of bytes the timestamp takes on page, rounded up for bit packed ones
 func (tse *TimestampEntry) Size() uint64 {
-	return uint64(len(tse.CompressedData.Bytes))
+	return (tse.CompressedData.BitSize() + 7) / 8
 }
 
 func (tse *TimestampEntry) GetValue() uint64 {
@@ -4,6 +4,21 @@ import "encoding/binary"
 
 type TSCompressedData struct {
 	Bytes []byte
+
+	// bit packed encodings keep control bits and the value instead of bytes,
+	// both aligned to the most significant bit
+	Control     uint64
+	ControlSize int
+	Value       uint64
+	ValueSize   int
+}
+
+// BitSize returns number of bits the timestamp takes on page
+func (cd *TSCompressedData) BitSize() uint64 {
+	if cd.Bytes != nil {
+		return uint64(len(cd.Bytes)) * 8
+	}
+	return uint64(cd.ControlSize + cd.ValueSize)
 }
 
 func NewTSCompressedData(bytes []byte) *TSCompressedData {
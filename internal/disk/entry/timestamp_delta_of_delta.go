@@ -0,0 +1,150 @@
+package entry
+
+/*
+	Delta-of-delta timestamp compression based on Facebook's Gorilla time-series encoding.
+
+	The first timestamp of a page is stored in 64 bits. Every next one is stored as the difference
+	between its delta and the delta of the previous timestamp, zigzag encoded, behind a prefix
+	choosing the number of bits:
+
+		'0'      delta-of-delta is zero, regular intervals take a single bit
+		'10'     7 bits
+		'110'    9 bits
+		'1110'   12 bits
+		'11110'  32 bits
+		'11111'  64 bits
+
+	Deltas are wrapping differences, so timestamps don't have to be ascending.
+*/
+
+import (
+	"time-series-engine/internal"
+)
+
+// dodValueSizes are sizes of delta-of-delta values behind a prefix of i+1 ones
+var dodValueSizes = []int{7, 9, 12, 32, 64}
+
+type DeltaOfDeltaCompressor struct {
+	lastValue uint64
+	lastDelta uint64
+}
+
+func NewDeltaOfDeltaCompressor() *DeltaOfDeltaCompressor {
+	return &DeltaOfDeltaCompressor{}
+}
+
+func (c *DeltaOfDeltaCompressor) CompressNext(timestamp uint64, count uint64) *TSCompressedData {
+	if count == 0 {
+		c.Update(timestamp, 0)
+		return &TSCompressedData{Value: timestamp, ValueSize: 64}
+	}
+
+	delta := timestamp - c.lastValue
+	dod := zigzag(int64(delta - c.lastDelta))
+	c.Update(timestamp, delta)
+
+	if dod == 0 {
+		return &TSCompressedData{ControlSize: 1}
+	}
+	for i, size := range dodValueSizes {
+		if size < 64 && dod >= 1<<size {
+			continue
+		}
+		ones := i + 1
+		controlSize := ones + 1
+		if ones == len(dodValueSizes) {
+			// the longest prefix needs no terminating zero
+			controlSize = ones
+		}
+		control := (uint64(1)<<ones - 1) << (controlSize - ones)
+		return &TSCompressedData{
+			Control:     control << (64 - controlSize),
+			ControlSize: controlSize,
+			Value:       dod << (64 - size),
+			ValueSize:   size,
+		}
+	}
+	return nil
+}
+
+// Update sets the last timestamp and its delta, which the next one is compressed against
+func (c *DeltaOfDeltaCompressor) Update(lastValue uint64, lastDelta uint64) {
+	c.lastValue = lastValue
+	c.lastDelta = lastDelta
+}
+
+type DeltaOfDeltaReconstructor struct {
+	bitReader *internal.BitReader
+	count     uint64
+	lastValue uint64
+	lastDelta uint64
+}
+
+func NewDeltaOfDeltaReconstructor(bytes []byte) *DeltaOfDeltaReconstructor {
+	return &DeltaOfDeltaReconstructor{
+		bitReader: internal.NewBitReader(bytes),
+	}
+}
+
+func (r *DeltaOfDeltaReconstructor) ReconstructNext() *TimestampEntry {
+	if r.count == 0 {
+		timestamp, err := r.bitReader.ReadBits(64)
+		if err != nil {
+			return nil
+		}
+		r.count++
+		r.lastValue = timestamp
+		return NewTimestampEntry(timestamp, &TSCompressedData{Value: timestamp, ValueSize: 64})
+	}
+
+	ones := 0
+	for ones < len(dodValueSizes) {
+		bit, err := r.bitReader.ReadBit()
+		if err != nil {
+			return nil
+		}
+		if bit == 0 {
+			break
+		}
+		ones++
+	}
+
+	cd := &TSCompressedData{ControlSize: ones + 1}
+	var dod uint64
+	if ones > 0 {
+		if ones == len(dodValueSizes) {
+			cd.ControlSize = ones
+		}
+		cd.Control = (uint64(1)<<ones - 1) << (cd.ControlSize - ones) << (64 - cd.ControlSize)
+
+		size := dodValueSizes[ones-1]
+		var err error
+		dod, err = r.bitReader.ReadBits(size)
+		if err != nil {
+			return nil
+		}
+		cd.Value = dod << (64 - size)
+		cd.ValueSize = size
+	}
+
+	r.lastDelta += uint64(unzigzag(dod))
+	r.lastValue += r.lastDelta
+	r.count++
+	return NewTimestampEntry(r.lastValue, cd)
+}
+
+func (r *DeltaOfDeltaReconstructor) LastValue() uint64 {
+	return r.lastValue
+}
+
+func (r *DeltaOfDeltaReconstructor) LastDelta() uint64 {
+	return r.lastDelta
+}
+
+func zigzag(n int64) uint64 {
+	return uint64(n<<1) ^ uint64(n>>63)
+}
+
+func unzigzag(n uint64) int64 {
+	return int64(n>>1) ^ -int64(n&1)
+}
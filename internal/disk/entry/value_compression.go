@@ -28,6 +28,9 @@ package entry
 
 	Decompression reconstructs the current value as:
 		current = previous ^ (XOR bits << number of trailing zeros)
+
+	Values are scaled by scaleFactor and truncated before encoding, which keeps 5 decimals.
+	In lossless mode raw IEEE-754 bits are encoded instead, as in the original paper.
 */
 
 import (
@@ -59,13 +62,14 @@ func (cd *ValCompressedData) Update(value uint64, valueSize int) {
 }
 
 type ValueCompressor struct {
+	lossless     bool
 	lastValue    uint64
 	lastLeading  int
 	lastTrailing int
 }
 
-func NewValueCompressor() *ValueCompressor {
-	return &ValueCompressor{}
+func NewValueCompressor(lossless bool) *ValueCompressor {
+	return &ValueCompressor{lossless: lossless}
 }
 
 func (vc *ValueCompressor) CompressNext(value float64, count uint64) *ValCompressedData {
@@ -75,7 +79,7 @@ func (vc *ValueCompressor) CompressNext(value float64, count uint64) *ValCompres
 		compressed = false
 	)
 
-	valueScaled := scale(value)
+	valueScaled := encodeValue(value, vc.lossless)
 
 	if count == 0 { // if first value to be written on page
 		vc.Update(valueScaled, 0, 0)
@@ -129,8 +133,29 @@ func (vc *ValueCompressor) Update(newLastValue uint64, newLastLeading, newLastTr
 	vc.lastTrailing = newLastTrailing
 }
 
+func encodeValue(value float64, lossless bool) uint64 {
+	if lossless {
+		return math.Float64bits(value)
+	}
+	return scale(value)
+}
+
+func decodeValue(value uint64, lossless bool) float64 {
+	if lossless {
+		return math.Float64frombits(value)
+	}
+	return downScale(value)
+}
+
 func scale(value float64) uint64 {
 	scaled := math.Trunc(value * scaleFactor)
+	// product of a value with 5 decimals may fall just below it, so a value that is read
+	// back from a page keeps its stored scaled value when it is written again
+	for _, neighbour := range []float64{scaled - 1, scaled + 1} {
+		if neighbour/scaleFactor == value {
+			scaled = neighbour
+		}
+	}
 	return math.Float64bits(scaled)
 }
 
@@ -139,16 +164,23 @@ func downScale(value uint64) float64 {
 	return scaled / scaleFactor
 }
 
+// StoredValue returns value as it is read back after compression
+func (vc *ValueCompressor) StoredValue(value float64) float64 {
+	return decodeValue(encodeValue(value, vc.lossless), vc.lossless)
+}
+
 type ValueReconstructor struct {
 	bitReader    *internal.BitReader
+	lossless     bool
 	lastValue    uint64
 	lastLeading  int
 	lastTrailing int
 }
 
-func NewValueReconstructor(bytes []byte) *ValueReconstructor {
+func NewValueReconstructor(bytes []byte, lossless bool) *ValueReconstructor {
 	return &ValueReconstructor{
 		bitReader: internal.NewBitReader(bytes),
+		lossless:  lossless,
 	}
 }
 
@@ -156,7 +188,7 @@ func (vr *ValueReconstructor) ReconstructNext() *ValueEntry {
 	controlBits, _ := vr.bitReader.ReadBits(2)
 	if controlBits == 0 { // Case 1
 		cd := NewValCompressedData(0, 2, true)
-		return NewValueEntry(downScale(vr.lastValue), cd)
+		return NewValueEntry(decodeValue(vr.lastValue, vr.lossless), cd)
 	}
 	if controlBits == 1 {
 		return vr.Case2()
@@ -185,7 +217,7 @@ func (vr *ValueReconstructor) Case2() *ValueEntry {
 	cmpValSize := xorLen + 2
 	cd := NewValCompressedData(cmpVal, cmpValSize, true)
 
-	return NewValueEntry(downScale(value), cd)
+	return NewValueEntry(decodeValue(value, vr.lossless), cd)
 }
 
 func (vr *ValueReconstructor) Case3() *ValueEntry {
@@ -208,7 +240,7 @@ func (vr *ValueReconstructor) Case3() *ValueEntry {
 	cmpValSize := xorLen + 14
 	cd := NewValCompressedData(cmpVal, int(cmpValSize), true)
 
-	return NewValueEntry(downScale(value), cd)
+	return NewValueEntry(decodeValue(value, vr.lossless), cd)
 }
 
 func (vr *ValueReconstructor) Case4() *ValueEntry {
@@ -216,7 +248,7 @@ func (vr *ValueReconstructor) Case4() *ValueEntry {
 	vr.Update(value, 0, 0)
 	cd := NewValCompressedData(value, 64, false)
 
-	return NewValueEntry(downScale(value), cd)
+	return NewValueEntry(decodeValue(value, vr.lossless), cd)
 }
 
 func (vr *ValueReconstructor) Update(lastValue uint64, lastLeading, lastTrailing int) {
@@ -2,6 +2,7 @@ package entry
 
 import (
 	"encoding/binary"
+	"errors"
 	"hash/crc32"
 	"io"
 	"math"
@@ -67,8 +68,19 @@ func NewWALPutEntry(timeSeries *internal.TimeSeries, point *internal.Point) *WAL
 	return &we
 }
 
+var (
+	ErrTruncatedEntry   = errors.New("truncated wal entry")
+	ErrChecksumMismatch = errors.New("wal entry checksum mismatch")
+)
+
+// Deserialize reads entry from the start of data. Zero CRC marks the end of entries
+// in a page and returns io.EOF. Entries which don't fit into data or don't match
+// their CRC return ErrTruncatedEntry or ErrChecksumMismatch.
 func (e *WALEntry) Deserialize(data []byte) error {
 	offset := 0
+	if len(data) < CRC {
+		return io.EOF
+	}
 
 	e.CRC = binary.BigEndian.Uint32(data[offset:])
 	if e.CRC == 0 {
@@ -76,12 +88,18 @@ func (e *WALEntry) Deserialize(data []byte) error {
 	}
 	offset += 4
 
+	if len(data) < offset+TOMBSTONE+MEASUREMENT_NAME_SIZE {
+		return ErrTruncatedEntry
+	}
 	e.Delete = data[offset] == 1
 	offset++
 
 	e.MeasurementNameSize = binary.BigEndian.Uint64(data[offset:])
 	offset += 8
 
+	if len(data) < offset+NUMBER_OF_TAGS || e.MeasurementNameSize > uint64(len(data)-offset-NUMBER_OF_TAGS) {
+		return ErrTruncatedEntry
+	}
 	e.MeasurementName = string(data[offset : offset+int(e.MeasurementNameSize)])
 	offset += int(e.MeasurementNameSize)
 
@@ -89,9 +107,16 @@ func (e *WALEntry) Deserialize(data []byte) error {
 	offset += 8
 
 	var tagsSize int
-	e.Tags, tagsSize = internal.DeserializeTags(data[offset:], e.NumberOfTags)
+	var err error
+	e.Tags, tagsSize, err = internal.DeserializeTags(data[offset:], e.NumberOfTags)
+	if err != nil {
+		return ErrTruncatedEntry
+	}
 	offset += tagsSize
 
+	if len(data) < offset+2*TIMESTAMP+VALUE {
+		return ErrTruncatedEntry
+	}
 	e.MinTimestamp = binary.BigEndian.Uint64(data[offset:])
 	offset += 8
 
@@ -100,6 +125,13 @@ func (e *WALEntry) Deserialize(data []byte) error {
 
 	e.Value = math.Float64frombits(binary.BigEndian.Uint64(data[offset:]))
 
+	crc := e.CRC
+	e.calculateCRC()
+	if e.CRC != crc {
+		e.CRC = crc
+		return ErrChecksumMismatch
+	}
+
 	return nil
 }
 
@@ -2,52 +2,24 @@ package disk
 
 import (
 	"errors"
-	"fmt"
-	"io"
-	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"time-series-engine/internal"
-	"time-series-engine/internal/disk/entry"
 	"time-series-engine/internal/disk/page"
 	"time-series-engine/internal/disk/parquet"
-	"time-series-engine/internal/disk/row_group"
 )
 
+// Get returns points of the time series stored on disk with timestamps in [minTimestamp, maxTimestamp],
+// sorted by timestamp
 func Get(pm *page.Manager, windowsDir string, ts *internal.TimeSeries, minTimestamp uint64, maxTimestamp uint64) ([]*internal.Point, error) {
-	windows, err := os.ReadDir(windowsDir)
-	result := make([]*internal.Point, 0)
+	it, err := NewSeriesIterator(pm, windowsDir, ts, minTimestamp, maxTimestamp)
 	if err != nil {
-		return nil, errors.New("[ERROR]: cannot read from time windows directory")
-	}
-
-	for _, window := range windows {
-		start, end, err := MinMaxTimestamp(window.Name())
-		if err != nil {
-			return nil, err
-		}
-
-		if DoIntervalsOverlap(minTimestamp, maxTimestamp, start, end) {
-			p, err := GetParquet(pm, windowsDir, window.Name(), ts, minTimestamp, maxTimestamp)
-			if err != nil {
-				return nil, err
-			}
-
-			if p != "" {
-				items, err := GetInParquet(pm, p, minTimestamp, maxTimestamp)
-				result = append(result, items...)
-				if err != nil {
-					return nil, err
-				}
-			}
-			continue
-		}
-		break
+		return nil, err
 	}
-
-	return result, nil
+	return Collect(it)
 }
 
 func MinMaxTimestamp(name string) (uint64, uint64, error) {
@@ -104,40 +76,11 @@ func GetParquet(
 }
 
 func GetInParquet(pm *page.Manager, parquetPath string, minTimestamp uint64, maxTimestamp uint64) ([]*internal.Point, error) {
-	rowGroups, err := os.ReadDir(parquetPath)
-	result := make([]*internal.Point, 0)
+	it, err := NewParquetIterator(pm, parquetPath, minTimestamp, maxTimestamp)
 	if err != nil {
-		return nil, fmt.Errorf("[ERROR]: cannot read from parquet directory: %s", parquetPath)
-	}
-
-	for _, rg := range rowGroups {
-		if !rg.IsDir() {
-			continue
-		}
-
-		rgPath := filepath.Join(parquetPath, rg.Name())
-		metaPath := filepath.Join(rgPath, "metadata.db")
-
-		metaBytes, err := pm.ReadStructure(metaPath, 0)
-		if err != nil {
-			return nil, err
-		}
-
-		meta, err := row_group.DeserializeMetadata(metaBytes)
-		if err != nil {
-			return nil, err
-		}
-
-		if DoIntervalsOverlap(minTimestamp, maxTimestamp, meta.MinTimestamp, meta.MaxTimestamp) {
-			items, err := GetInRowGroup(pm, rgPath, minTimestamp, maxTimestamp)
-			result = append(result, items...)
-			if err != nil {
-				return nil, err
-			}
-		}
+		return nil, err
 	}
-
-	return result, nil
+	return Collect(it)
 }
 
 func DoIntervalsOverlap(min1, max1, min2, max2 uint64) bool {
@@ -148,172 +91,125 @@ func GetInRowGroup(
 	pm *page.Manager, rgPath string,
 	minTimestamp uint64, maxTimestamp uint64,
 ) ([]*internal.Point, error) {
-	result := make([]*internal.Point, 0)
-	tsPath := filepath.Join(rgPath, "timestamp.db")
-	valuePath := filepath.Join(rgPath, "value.db")
-	deletePath := filepath.Join(rgPath, "delete.db")
-
-	tsIter, err := NewIterator(pm, tsPath, Timestamp)
-	if err != nil {
-		return nil, err
-	}
-	skipped, err := tsIter.Skip(minTimestamp, maxTimestamp)
-	if err != nil {
-		return nil, err
-	}
-
-	valueIter, err := NewIterator(pm, valuePath, Value)
-	if err != nil {
-		return nil, err
-	}
-	err = valueIter.Advance(skipped)
+	it, err := NewRowGroupIterator(pm, rgPath, minTimestamp, maxTimestamp)
 	if err != nil {
 		return nil, err
 	}
+	return Collect(it)
+}
 
-	deleteIter, err := NewIterator(pm, deletePath, Delete)
-	if err != nil {
-		return nil, err
-	}
-	err = deleteIter.Advance(skipped)
+// AggregateSeries adds points of the time series with timestamps in [minTimestamp, maxTimestamp]
+// to the aggregator, those stored on disk merged with the newer ones in memory, each part of which
+// has to be sorted by timestamp. Points are deduplicated as by the merge iterator, except for row
+// groups which lie inside the range, have no deleted points and share no timestamps with other
+// row groups or memory. Those are added by their statistics, if the aggregator supports it.
+func AggregateSeries(
+	pm *page.Manager, windowsDir string,
+	ts *internal.TimeSeries, minTimestamp uint64, maxTimestamp uint64,
+	memory [][]*internal.Point,
+	aggregator Aggregator,
+) error {
+	windows, err := os.ReadDir(windowsDir)
 	if err != nil {
-		return nil, err
+		return errors.New("[ERROR]: cannot read from time windows directory")
 	}
 
-	for {
-		e, err := tsIter.Next()
-		if err == io.EOF {
-			break
-		}
+	rowGroups := make([]*rowGroupInfo, 0)
+	for _, window := range windows {
+		start, end, err := MinMaxTimestamp(window.Name())
 		if err != nil {
-			return nil, err
+			return err
 		}
-		tsEntry := e.(*entry.TimestampEntry)
-		if tsEntry.GetValue() > maxTimestamp {
-			break
+		if !DoIntervalsOverlap(minTimestamp, maxTimestamp, start, end) {
+			continue
 		}
 
-		e, err = valueIter.Next()
+		p, err := GetParquet(pm, windowsDir, window.Name(), ts, minTimestamp, maxTimestamp)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		valueEntry := e.(*entry.ValueEntry)
-
-		e, err = deleteIter.Next()
+		if p == "" {
+			continue
+		}
+		parts, err := parquetRowGroups(pm, p, minTimestamp, maxTimestamp)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		deleteEntry := e.(*entry.DeleteEntry)
+		rowGroups = append(rowGroups, parts...)
+	}
 
-		if !deleteEntry.Deleted {
-			p := internal.Point{
-				Value:     valueEntry.Value,
-				Timestamp: tsEntry.Value,
-			}
-			result = append(result, &p)
+	intervals := make([][2]uint64, 0, len(rowGroups)+len(memory))
+	for _, rg := range rowGroups {
+		intervals = append(intervals, [2]uint64{
+			max(rg.meta.MinTimestamp, minTimestamp),
+			min(rg.meta.MaxTimestamp, maxTimestamp),
+		})
+	}
+	for _, points := range memory {
+		if len(points) > 0 {
+			intervals = append(intervals, [2]uint64{points[0].Timestamp, points[len(points)-1].Timestamp})
+		}
+	}
+	overlapping := overlappingIntervals(intervals)
+
+	statsAggregator, usesStatistics := aggregator.(StatisticsAggregator)
+	sources := make([]*LazySource, 0)
+	for i, rg := range rowGroups {
+		meta := rg.meta
+		if usesStatistics && !overlapping[i] && meta.HasStatistics && meta.DeletedPoints == 0 && meta.Covers(minTimestamp, maxTimestamp) {
+			statsAggregator.AddStatistics(&Statistics{
+				Count: meta.PointsNumber,
+				Min:   meta.MinValue,
+				Max:   meta.MaxValue,
+				Sum:   meta.SumValue,
+			})
+			continue
 		}
+		sources = append(sources, rg.source(pm, minTimestamp, maxTimestamp))
 	}
-
-	return result, nil
-}
-
-func Aggregate(ts *internal.TimeSeries, minTimestamp uint64, maxTimestamp uint64, pm *page.Manager, windowsDir string, function string) (float64, uint64, error) {
-	var result float64
-	var sumValue float64
-	var pointsNumber uint64
-
-	switch function {
-	case "Min":
-		result = math.MaxFloat64
-	case "Max":
-		result = -math.MaxFloat64
-	case "Average":
-		result = 0
+	for _, points := range memory {
+		if len(points) > 0 {
+			sources = append(sources, &LazySource{
+				MinTimestamp: points[0].Timestamp,
+				Open:         func() (PointIterator, error) { return NewSliceIterator(points), nil },
+			})
+		}
 	}
 
-	windows, err := os.ReadDir(windowsDir)
+	it := NewLazyMergeIterator(sources)
+	for it.Next() {
+		aggregator.Add(it.At())
+	}
+	err = it.Err()
+	closeErr := it.Close()
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
+	return closeErr
+}
 
-	for _, window := range windows {
-		windowName := window.Name()
-		parquets, err := os.ReadDir(filepath.Join(windowsDir, windowName))
-		if err != nil {
-			return 0, 0, err
-		}
-
-		for _, p := range parquets {
-			pPath := filepath.Join(windowsDir, windowName, p.Name())
-			metaPath := filepath.Join(pPath, "metadata.db")
-
-			data, err := pm.ReadStructure(metaPath, 0)
-			if err != nil {
-				return 0, 0, err
-			}
-
-			meta, err := parquet.DeserializeParquetMetadata(data)
-			if err != nil {
-				return 0, 0, err
-			}
-
-			if meta.TimeSeriesHash != ts.Hash {
-				continue
-			}
-			if !DoIntervalsOverlap(minTimestamp, maxTimestamp, meta.MinTimestamp, meta.MaxTimestamp) {
-				continue
-			}
-
-			items, err := GetInParquet(pm, pPath, minTimestamp, maxTimestamp)
-			if err != nil {
-				return 0, 0, err
-			}
-			if len(items) == 0 {
-				continue
-			}
-
-			sum := insertionSort(items)
-
-			switch function {
-			case "Min":
-				first := items[0].Value
-				if first < result {
-					result = first
-				}
-			case "Max":
-				last := items[len(items)-1].Value
-				if last > result {
-					result = last
-				}
-			case "Average":
-				pointsNumber += uint64(len(items))
-				sumValue += sum
-			}
-		}
+// overlappingIntervals reports for each of the closed intervals whether it overlaps any other
+func overlappingIntervals(intervals [][2]uint64) []bool {
+	order := make([]int, len(intervals))
+	for i := range order {
+		order[i] = i
 	}
+	sort.Slice(order, func(i, j int) bool {
+		return intervals[order[i]][0] < intervals[order[j]][0]
+	})
 
-	if function == "Average" {
-		if pointsNumber == 0 {
-			return 0, 0, nil
+	// sorted by start, an interval overlaps a later one only if it overlaps the next one,
+	// and an earlier one only if it starts before the furthest end of the earlier ones
+	overlapping := make([]bool, len(intervals))
+	var furthestEnd uint64
+	for k, i := range order {
+		if k > 0 && intervals[i][0] <= furthestEnd {
+			overlapping[i] = true
 		}
-		return sumValue, pointsNumber, nil
-	}
-
-	return result, pointsNumber, nil
-}
-
-func insertionSort(array []*internal.Point) float64 {
-	var sum float64
-	for i := 0; i < len(array); i++ {
-		key := array[i]
-		j := i - 1
-
-		for j >= 0 && array[j].Value > key.Value {
-			array[j+1] = array[j]
-			j--
+		if k+1 < len(order) && intervals[order[k+1]][0] <= intervals[i][1] {
+			overlapping[i] = true
 		}
-		array[j+1] = key
-		sum += key.Value
+		furthestEnd = max(furthestEnd, intervals[i][1])
 	}
-	return sum
+	return overlapping
 }
@@ -101,7 +101,8 @@ func (it *Iterator) Skip(minTimestamp uint64, maxTimestamp uint64) (uint64, erro
 			return 0, err
 		}
 
-		if minTimestamp <= e.GetValue() && e.GetValue() <= maxTimestamp {
+		// timestamps are sorted, so the first one not below the range is where reading starts
+		if minTimestamp <= e.GetValue() {
 			it.CurrentEntryIndex--
 			break
 		}
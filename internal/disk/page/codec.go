@@ -0,0 +1,166 @@
+package page
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Column is a kind of pages, each column of a row group has its own file
+type Column uint8
+
+const (
+	TimestampColumn Column = iota
+	ValueColumn
+	DeleteColumn
+)
+
+func (c Column) String() string {
+	switch c {
+	case TimestampColumn:
+		return "timestamp"
+	case ValueColumn:
+		return "value"
+	case DeleteColumn:
+		return "delete"
+	}
+	return fmt.Sprintf("column %d", uint8(c))
+}
+
+// IDs of the built-in codecs, unique within a column
+const (
+	TimestampCodecVarint       uint8 = 0 // uvarint deltas
+	TimestampCodecDeltaOfDelta uint8 = 1 // bit packed deltas of deltas
+
+	ValueCodecScaled   uint8 = 0 // values rounded to 5 decimals
+	ValueCodecLossless uint8 = 1 // raw bits of floats
+
+	DeleteCodecBitmap    uint8 = 0 // a bit per row
+	DeleteCodecRunLength uint8 = 1 // lengths of runs of active and deleted rows
+)
+
+// Codec encodes pages of a column. Every page keeps ID and version of its codec in metadata,
+// so pages of different codecs may be mixed in one file. A new version of a codec has to read
+// pages written by all of its older versions, an incompatible encoding needs a new ID.
+type Codec interface {
+	Column() Column
+	ID() uint8
+	// Version is written to new pages
+	Version() uint8
+	// Name identifies the codec in configuration
+	Name() string
+	NewPage(pageSize uint64) Page
+	// Deserialize reads page of the codec, metadata is already deserialized from its bytes
+	Deserialize(bytes []byte, metadata *Metadata) (Page, error)
+}
+
+// codecInfo implements identification of built-in codecs
+type codecInfo struct {
+	column  Column
+	id      uint8
+	version uint8
+	name    string
+}
+
+func (ci *codecInfo) Column() Column {
+	return ci.column
+}
+
+func (ci *codecInfo) ID() uint8 {
+	return ci.id
+}
+
+func (ci *codecInfo) Version() uint8 {
+	return ci.version
+}
+
+func (ci *codecInfo) Name() string {
+	return ci.name
+}
+
+var codecs = map[Column]map[uint8]Codec{}
+
+func init() {
+	for _, codec := range []Codec{TimestampVarint, TimestampDeltaOfDelta, ValueScaled, ValueLossless, DeleteBitmap, DeleteRunLength} {
+		err := RegisterCodec(codec)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterCodec makes codec available for new pages and for reading pages written with it
+func RegisterCodec(codec Codec) error {
+	column, ok := codecs[codec.Column()]
+	if !ok {
+		column = make(map[uint8]Codec)
+		codecs[codec.Column()] = column
+	}
+	if registered, ok := column[codec.ID()]; ok {
+		return fmt.Errorf("[ERROR]: %s codec ID %d is already used by %s", codec.Column(), codec.ID(), registered.Name())
+	}
+	for _, registered := range column {
+		if registered.Name() == codec.Name() {
+			return fmt.Errorf("[ERROR]: %s codec %s is already registered", codec.Column(), codec.Name())
+		}
+	}
+
+	column[codec.ID()] = codec
+	return nil
+}
+
+// LookupCodec returns codec of the column with the ID
+func LookupCodec(column Column, id uint8) (Codec, error) {
+	codec, ok := codecs[column][id]
+	if !ok {
+		return nil, fmt.Errorf("[ERROR]: unknown %s codec ID %d", column, id)
+	}
+	return codec, nil
+}
+
+// CodecByName returns codec of the column with the name
+func CodecByName(column Column, name string) (Codec, error) {
+	for _, codec := range codecs[column] {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("[ERROR]: unknown %s codec %q", column, name)
+}
+
+// Codecs returns codecs registered for the column, ordered by ID
+func Codecs(column Column) []Codec {
+	result := make([]Codec, 0, len(codecs[column]))
+	for _, codec := range codecs[column] {
+		result = append(result, codec)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID() < result[j].ID()
+	})
+	return result
+}
+
+// DeserializePage reads page of the column with the codec named in its metadata
+func DeserializePage(column Column, bytes []byte) (Page, error) {
+	metadata := DeserializeMetadata(bytes)
+	if metadata == nil {
+		return nil, fmt.Errorf("[ERROR]: invalid %s page metadata", column)
+	}
+
+	codec, err := LookupCodec(column, metadata.Codec)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Version > codec.Version() {
+		return nil, fmt.Errorf("[ERROR]: %s page is written by version %d of codec %s, newer than supported %d",
+			column, metadata.Version, codec.Name(), codec.Version())
+	}
+	return codec.Deserialize(bytes, metadata)
+}
+
+// newMetadata creates metadata of an empty page of the codec
+func newMetadata(codec Codec) *Metadata {
+	md := NewMetadata()
+	md.Codec = codec.ID()
+	md.Version = codec.Version()
+	return md
+}
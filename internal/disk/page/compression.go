@@ -0,0 +1,225 @@
+package page
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// CompressedSuffix is appended to name of a column file once its pages are compressed.
+// Compressed file holds flate compressed pages one after another, followed by an index
+// with end offset of every page and number of pages, each as 8 bytes. Pages are still
+// addressed by their offsets in the uncompressed file.
+const CompressedSuffix = ".z"
+
+// CompressFile compresses pages of the file into a file with CompressedSuffix, which replaces it.
+// Returns false when the file is missing, for example because it is compressed already.
+func (m *Manager) CompressFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	pageSize := int(m.Config.PageSize)
+	if len(data)%pageSize != 0 {
+		return false, fmt.Errorf("[ERROR]: size of %s is not a multiple of page size", path)
+	}
+
+	var compressed bytes.Buffer
+	w, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return false, err
+	}
+	index := make([]byte, 0, (len(data)/pageSize+1)*8)
+	for offset := 0; offset < len(data); offset += pageSize {
+		w.Reset(&compressed)
+		_, err = w.Write(data[offset : offset+pageSize])
+		if err != nil {
+			return false, err
+		}
+		err = w.Close()
+		if err != nil {
+			return false, err
+		}
+		index = binary.BigEndian.AppendUint64(index, uint64(compressed.Len()))
+	}
+	index = binary.BigEndian.AppendUint64(index, uint64(len(data)/pageSize))
+	compressed.Write(index)
+
+	err = replaceFile(path+CompressedSuffix, compressed.Bytes())
+	if err != nil {
+		return false, err
+	}
+	// pages are cached by the path either way, so the cache stays valid
+	return true, os.Remove(path)
+}
+
+// DecompressFile writes pages of the compressed file back to the file, so they can be changed again.
+// Nothing is done when the file is not compressed.
+func (m *Manager) DecompressFile(path string) error {
+	_, err := os.Stat(path)
+	if err == nil {
+		// left by interrupted compression or decompression, pages are the same
+		return removeIfExists(path + CompressedSuffix)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	compressed, err := os.ReadFile(path + CompressedSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	count, err := compressedPageCount(compressed)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, count*m.Config.PageSize)
+	for i := uint64(0); i < count; i++ {
+		p, err := m.decompressPage(compressed, i)
+		if err != nil {
+			return err
+		}
+		data = append(data, p...)
+	}
+
+	err = replaceFile(path, data)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path + CompressedSuffix)
+}
+
+// IsCompressed reports whether pages of the file are compressed
+func (m *Manager) IsCompressed(path string) bool {
+	_, err := os.Stat(path)
+	if err == nil {
+		return false
+	}
+	_, err = os.Stat(path + CompressedSuffix)
+	return err == nil
+}
+
+// readCompressedPage reads page at the offset of the uncompressed file from its compressed file
+func (m *Manager) readCompressedPage(path string, offset int64) ([]byte, error) {
+	file, err := os.Open(path + CompressedSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	footer := make([]byte, 8)
+	_, err = file.ReadAt(footer, info.Size()-8)
+	if err != nil {
+		return nil, err
+	}
+	count := binary.BigEndian.Uint64(footer)
+	index := uint64(offset) / m.Config.PageSize
+	if index >= count {
+		return nil, io.EOF
+	}
+
+	// end of the previous page is where the page starts
+	bounds := make([]byte, 16)
+	start, end := int64(0), int64(0)
+	indexStart := info.Size() - 8 - int64(count)*8
+	if index == 0 {
+		_, err = file.ReadAt(bounds[8:], indexStart)
+	} else {
+		_, err = file.ReadAt(bounds, indexStart+int64(index-1)*8)
+		start = int64(binary.BigEndian.Uint64(bounds[:8]))
+	}
+	if err != nil {
+		return nil, err
+	}
+	end = int64(binary.BigEndian.Uint64(bounds[8:]))
+
+	block := make([]byte, end-start)
+	_, err = file.ReadAt(block, start)
+	if err != nil {
+		return nil, err
+	}
+	return m.inflate(block)
+}
+
+// decompressPage decompresses page with the index from the whole compressed file
+func (m *Manager) decompressPage(compressed []byte, index uint64) ([]byte, error) {
+	count, err := compressedPageCount(compressed)
+	if err != nil {
+		return nil, err
+	}
+	indexStart := uint64(len(compressed)) - 8 - count*8
+	start := uint64(0)
+	if index > 0 {
+		start = binary.BigEndian.Uint64(compressed[indexStart+(index-1)*8:])
+	}
+	end := binary.BigEndian.Uint64(compressed[indexStart+index*8:])
+	if start > end || end > indexStart {
+		return nil, errors.New("[ERROR]: invalid compressed page index")
+	}
+	return m.inflate(compressed[start:end])
+}
+
+func (m *Manager) inflate(block []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(block))
+	defer r.Close()
+
+	p := make([]byte, m.Config.PageSize)
+	_, err := io.ReadFull(r, p)
+	if err != nil {
+		return nil, fmt.Errorf("[ERROR]: failed to decompress page: %w", err)
+	}
+	return p, nil
+}
+
+func compressedPageCount(compressed []byte) (uint64, error) {
+	if len(compressed) < 8 {
+		return 0, errors.New("[ERROR]: invalid compressed file")
+	}
+	count := binary.BigEndian.Uint64(compressed[len(compressed)-8:])
+	if count > uint64(len(compressed)-8)/8 {
+		return 0, errors.New("[ERROR]: invalid compressed file")
+	}
+	return count, nil
+}
+
+// replaceFile writes data to a temporary file first, so the file is never left partially written
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+	return os.Rename(tmp, path)
+}
+
+func removeIfExists(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package page
 
 import (
+	"encoding/binary"
 	"errors"
 	"time-series-engine/internal"
 	"time-series-engine/internal/disk/entry"
@@ -9,89 +10,225 @@ import (
 type DeletePage struct {
 	Metadata *Metadata
 	Entries  []entry.Entry
+	Codec    Codec
+	// Padding is room left in bits for rows encoded with the codec
 	Padding  uint64
 	pageSize uint64
+	usedBits uint64 // of rows encoded with the codec, may be more than the page holds
+	lastRun  uint64 // rows of the last run of equal rows
+	codec    *deleteCodec
 }
 
-func NewDeletePage(pageSize uint64) *DeletePage {
+// deleteCodec encodes whether rows are deleted
+type deleteCodec struct {
+	codecInfo
+	encode func(entries []entry.Entry) []byte
+	decode func(bytes []byte, count uint64) ([]entry.Entry, error)
+	// size returns bits the row adds to the encoded page
+	size func(p *DeletePage, deleted bool) uint64
+}
+
+// Codecs of delete pages
+var (
+	// DeleteBitmap stores a bit per row, set for deleted ones
+	DeleteBitmap Codec = &deleteCodec{
+		codecInfo: codecInfo{column: DeleteColumn, id: DeleteCodecBitmap, name: "bitmap"},
+		encode:    encodeDeleteBitmap,
+		decode:    decodeDeleteBitmap,
+		size:      deleteBitmapSize,
+	}
+	// DeleteRunLength stores lengths of runs of active and deleted rows, one after another
+	DeleteRunLength Codec = &deleteCodec{
+		codecInfo: codecInfo{column: DeleteColumn, id: DeleteCodecRunLength, name: "rle"},
+		encode:    encodeDeleteRuns,
+		decode:    decodeDeleteRuns,
+		size:      deleteRunsSize,
+	}
+)
+
+func (c *deleteCodec) NewPage(pageSize uint64) Page {
 	return &DeletePage{
-		Metadata: NewMetadata(),
+		Metadata: newMetadata(c),
 		Entries:  make([]entry.Entry, 0),
-		Padding:  (pageSize - MetadataSize) * 8, // x8 since delete page is working with bits
+		Codec:    c,
+		Padding:  (pageSize - MetadataSize) * 8, // x8 since rows are counted in bits
 		pageSize: pageSize,
+		codec:    c,
 	}
 }
 
-func (p *DeletePage) Add(e entry.Entry) {
-	de, ok := e.(*entry.DeleteEntry)
-	if !ok {
-		return
+func (c *deleteCodec) Deserialize(bytes []byte, metadata *Metadata) (Page, error) {
+	p := c.NewPage(uint64(len(bytes))).(*DeletePage)
+	p.Metadata = metadata
+
+	entries, err := c.decode(bytes[MetadataSize:], metadata.Count)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		p.add(e.(*entry.DeleteEntry))
 	}
 
-	p.Metadata.Count++
-	p.Entries = append(p.Entries, de)
-	p.Padding -= de.Size()
+	return p, nil
 }
 
-func (p *DeletePage) Serialize() []byte {
-	allBytes := make([]byte, 0)
-	allBytes = append(allBytes, p.Metadata.Serialize()...)
-
-	w := internal.NewBitWriter(p.pageSize - MetadataSize)
-
-	for _, e := range p.Entries {
-		de, _ := e.(*entry.DeleteEntry)
-		if de.Deleted == true {
-			err := w.WriteBit(entry.DeletedBit)
-			if err != nil {
-				return nil
-			}
+func deleteBitmapSize(_ *DeletePage, _ bool) uint64 {
+	return 1
+}
+
+func encodeDeleteBitmap(entries []entry.Entry) []byte {
+	w := internal.NewBitWriter(uint64(len(entries)+7) / 8)
+	for _, e := range entries {
+		if e.(*entry.DeleteEntry).Deleted {
+			_ = w.WriteBit(entry.DeletedBit)
 		} else {
-			err := w.WriteBit(entry.ActiveBit)
-			if err != nil {
-				return nil
-			}
+			_ = w.WriteBit(entry.ActiveBit)
 		}
 	}
+	w.Flush()
+	return w.Bytes()
+}
+
+func decodeDeleteBitmap(bytes []byte, count uint64) ([]entry.Entry, error) {
+	r := internal.NewBitReader(bytes)
 
-	for i := uint64(0); i < p.Padding; i++ { // write remaining padding bits
-		err := w.WriteBit(0)
+	entries := make([]entry.Entry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		bit, err := r.ReadBit()
 		if err != nil {
-			return nil
+			return nil, err
 		}
+		entries = append(entries, entry.NewDeleteEntry(bit == entry.DeletedBit))
 	}
-
-	allBytes = append(allBytes, w.Bytes()...)
-	return allBytes
+	return entries, nil
 }
 
-func DeserializeDeletePage(bytes []byte) (Page, error) {
-	pageSize := uint64(len(bytes))
-	p := NewDeletePage(pageSize)
+// encodeDeleteRuns writes uvarint lengths of runs, alternating between active and deleted rows.
+// The first run is of active rows, so it is empty when the first row is deleted.
+func encodeDeleteRuns(entries []entry.Entry) []byte {
+	bytes := make([]byte, 0)
+	deleted := false
+	run := uint64(0)
+	for _, e := range entries {
+		if e.(*entry.DeleteEntry).Deleted != deleted {
+			bytes = binary.AppendUvarint(bytes, run)
+			deleted = !deleted
+			run = 0
+		}
+		run++
+	}
+	return binary.AppendUvarint(bytes, run)
+}
 
-	p.Metadata = DeserializeMetadata(bytes)
-	if p.Metadata == nil {
-		return nil, errors.New("[ERROR]: invalid metadata bytes")
+// deleteRunsSize returns bits of a new run, or of the longer length of the last run
+func deleteRunsSize(p *DeletePage, deleted bool) uint64 {
+	if len(p.Entries) == 0 {
+		if deleted {
+			return 16 // after an empty run of active rows
+		}
+		return 8
+	}
+	if p.Entries[len(p.Entries)-1].(*entry.DeleteEntry).Deleted != deleted {
+		return 8
 	}
+	return uint64(uvarintLen(p.lastRun+1)-uvarintLen(p.lastRun)) * 8
+}
 
-	r := internal.NewBitReader(bytes[MetadataSize:])
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
 
-	for i := uint64(0); i < p.Metadata.Count; i++ {
-		bit, err := r.ReadBit()
-		if err != nil {
-			return nil, err
+func decodeDeleteRuns(bytes []byte, count uint64) ([]entry.Entry, error) {
+	entries := make([]entry.Entry, 0, count)
+	deleted := false
+	for uint64(len(entries)) < count {
+		run, n := binary.Uvarint(bytes)
+		if n <= 0 || run > count-uint64(len(entries)) {
+			return nil, errors.New("[ERROR]: invalid run of delete page")
 		}
-		e := &entry.DeleteEntry{}
-		if bit == entry.DeletedBit {
-			e.Deleted = true
-		} else {
-			e.Deleted = false
+		bytes = bytes[n:]
+		for i := uint64(0); i < run; i++ {
+			entries = append(entries, entry.NewDeleteEntry(deleted))
 		}
-		p.Entries = append(p.Entries, e)
-		p.Padding -= e.Size()
+		deleted = !deleted
 	}
+	return entries, nil
+}
 
-	return p, nil
+func NewDeletePage(pageSize uint64) *DeletePage {
+	return NewDeletePageWithCodec(pageSize, DeleteBitmap)
+}
+
+// NewDeletePageWithCodec creates page whose tombstones are encoded with the delete codec
+func NewDeletePageWithCodec(pageSize uint64, codec Codec) *DeletePage {
+	return codec.NewPage(pageSize).(*DeletePage)
+}
+
+func (p *DeletePage) Add(e entry.Entry) {
+	de, ok := e.(*entry.DeleteEntry)
+	if !ok {
+		return
+	}
+
+	p.Metadata.Count++
+	p.add(de)
+}
+
+func (p *DeletePage) add(de *entry.DeleteEntry) {
+	p.usedBits += p.codec.size(p, de.Deleted)
+	p.Padding = p.bodyBits() - min(p.usedBits, p.bodyBits())
+	if len(p.Entries) > 0 && p.Entries[len(p.Entries)-1].(*entry.DeleteEntry).Deleted == de.Deleted {
+		p.lastRun++
+	} else {
+		p.lastRun = 1
+	}
+	p.Entries = append(p.Entries, de)
+}
+
+// Fits reports whether one more row can be added to the page. Rows which don't fit
+// encoded with the codec still fit as long as a bit per row does.
+func (p *DeletePage) Fits(deleted bool) bool {
+	if p.usedBits+p.codec.size(p, deleted) <= p.bodyBits() {
+		return true
+	}
+	return uint64(len(p.Entries)) < p.bodyBits()
+}
+
+// Overflows reports whether the page can't be written any more, because rows deleted
+// after it was filled made its encoding longer than the page
+func (p *DeletePage) Overflows() bool {
+	if uint64(len(p.Entries)) <= p.bodyBits() {
+		return false
+	}
+	return uint64(len(p.codec.encode(p.Entries))) > p.pageSize-MetadataSize
+}
+
+// bodyBits returns bits of the page after metadata, which is also how many rows a bitmap holds
+func (p *DeletePage) bodyBits() uint64 {
+	return (p.pageSize - MetadataSize) * 8
+}
+
+func (p *DeletePage) Serialize() []byte {
+	metadata := *p.Metadata
+	body := p.codec.encode(p.Entries)
+	if uint64(len(body)) > p.pageSize-MetadataSize {
+		// runs of rows which change often may take more space than bits
+		body = encodeDeleteBitmap(p.Entries)
+		metadata.Codec, metadata.Version = DeleteBitmap.ID(), DeleteBitmap.Version()
+	}
+
+	allBytes := make([]byte, 0, p.pageSize)
+	allBytes = append(allBytes, metadata.Serialize()...)
+	allBytes = append(allBytes, body...)
+
+	paddingBytes := make([]byte, p.pageSize-uint64(len(allBytes)))
+	allBytes = append(allBytes, paddingBytes...)
+	return allBytes
+}
+
+func DeserializeDeletePage(bytes []byte) (Page, error) {
+	return DeserializePage(DeleteColumn, bytes)
 }
 
 func (p *DeletePage) EntryCount() uint64 {
@@ -2,6 +2,8 @@ package page
 
 import (
 	"encoding/binary"
+	"errors"
+	"io/fs"
 	"os"
 	"time-series-engine/config"
 	"time-series-engine/internal/memory/buffer_pool"
@@ -49,12 +51,36 @@ func (m *Manager) WritePage(p Page, path string, offset int64) error {
 	return nil
 }
 
+// WritePageAt writes page to an already opened file, which is left open
+func (m *Manager) WritePageAt(p Page, file *os.File, offset int64) error {
+	bytes := p.Serialize()
+	_, err := file.WriteAt(bytes, offset)
+	if err != nil {
+		return err
+	}
+
+	found := m.bufferPool.Get(file.Name(), offset)
+	if found != nil {
+		m.bufferPool.Put(bytes, file.Name(), offset)
+	}
+
+	return nil
+}
+
 func (m *Manager) ReadPage(path string, offset int64) ([]byte, error) {
 	p := m.bufferPool.Get(path, offset)
 	if p != nil {
 		return p, nil
 	}
 	file, err := os.OpenFile(path, os.O_RDONLY, 0644)
+	if errors.Is(err, fs.ErrNotExist) && m.IsCompressed(path) {
+		p, err = m.readCompressedPage(path, offset)
+		if err != nil {
+			return nil, err
+		}
+		m.bufferPool.Put(p, path, offset)
+		return p, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -183,6 +209,12 @@ func (m *Manager) CreateFile(filename string) error {
 	return nil
 }
 
+// Invalidate drops cached pages of the file, or of all files under the directory,
+// after it was replaced on disk
+func (m *Manager) Invalidate(filename string) error {
+	return m.bufferPool.Remove(filename)
+}
+
 func (m *Manager) RemoveFile(filename string) error {
 	err := m.bufferPool.Remove(filename)
 	if err != nil {
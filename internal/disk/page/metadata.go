@@ -4,10 +4,19 @@ import "encoding/binary"
 
 const MetadataSize uint64 = 24
 
+// count takes the low 48 bits, codec ID and its version a byte each above it.
+// Both are zero in pages written before codecs existed, which is the first codec of every column.
+const (
+	codecShift   = 48
+	versionShift = 56
+)
+
 type Metadata struct {
 	MinValue uint64
 	MaxValue uint64
 	Count    uint64
+	Codec    uint8 // ID of the codec the page is encoded with
+	Version  uint8 // version of the codec
 }
 
 func NewMetadata() *Metadata {
@@ -31,7 +40,7 @@ func (md *Metadata) Serialize() []byte {
 	allBytes := make([]byte, MetadataSize)
 	binary.BigEndian.PutUint64(allBytes[0:8], md.MinValue)
 	binary.BigEndian.PutUint64(allBytes[8:16], md.MaxValue)
-	binary.BigEndian.PutUint64(allBytes[16:24], md.Count)
+	binary.BigEndian.PutUint64(allBytes[16:24], md.Count|uint64(md.Codec)<<codecShift|uint64(md.Version)<<versionShift)
 	return allBytes
 }
 
@@ -46,6 +55,8 @@ func DeserializeMetadata(bytes []byte) *Metadata {
 	return &Metadata{
 		MinValue: minValue,
 		MaxValue: maxValue,
-		Count:    count,
+		Count:    count & (1<<codecShift - 1),
+		Codec:    uint8(count >> codecShift),
+		Version:  uint8(count >> versionShift),
 	}
 }
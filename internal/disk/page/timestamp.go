@@ -2,27 +2,94 @@ package page
 
 import (
 	"errors"
+	"time-series-engine/internal"
 	"time-series-engine/internal/disk/entry"
 )
 
+// TimestampCompressor compresses timestamps of a page with its codec
+type TimestampCompressor interface {
+	CompressNext(timestamp uint64, count uint64) *entry.TSCompressedData
+}
+
 type TimestampPage struct {
 	Metadata            *Metadata
 	Entries             []entry.Entry
-	TimestampCompressor *entry.TimestampCompressor
+	TimestampCompressor TimestampCompressor
+	Codec               Codec
 	Padding             uint64
 	pageSize            uint64
+	usedBits            uint64
 }
 
-func NewTimestampPage(pageSize uint64) *TimestampPage {
+// timestampCodec compresses timestamps of a page one after another
+type timestampCodec struct {
+	codecInfo
+	newCompressor    func() TimestampCompressor
+	newReconstructor func(bytes []byte) timestampReconstructor
+}
+
+// Codecs of timestamp pages
+var (
+	TimestampVarint Codec = &timestampCodec{
+		codecInfo:     codecInfo{column: TimestampColumn, id: TimestampCodecVarint, name: "varint"},
+		newCompressor: func() TimestampCompressor { return entry.NewTimestampCompressor() },
+		newReconstructor: func(bytes []byte) timestampReconstructor {
+			return &varintReconstructor{entry.NewTimestampReconstructor(bytes)}
+		},
+	}
+	TimestampDeltaOfDelta Codec = &timestampCodec{
+		codecInfo:     codecInfo{column: TimestampColumn, id: TimestampCodecDeltaOfDelta, name: "delta_of_delta"},
+		newCompressor: func() TimestampCompressor { return entry.NewDeltaOfDeltaCompressor() },
+		newReconstructor: func(bytes []byte) timestampReconstructor {
+			return &deltaOfDeltaReconstructor{entry.NewDeltaOfDeltaReconstructor(bytes)}
+		},
+	}
+)
+
+func (c *timestampCodec) NewPage(pageSize uint64) Page {
 	return &TimestampPage{
-		Metadata:            NewMetadata(),
+		Metadata:            newMetadata(c),
 		Entries:             make([]entry.Entry, 0),
-		TimestampCompressor: entry.NewTimestampCompressor(),
+		TimestampCompressor: c.newCompressor(),
+		Codec:               c,
 		Padding:             pageSize - MetadataSize,
 		pageSize:            pageSize,
 	}
 }
 
+func (c *timestampCodec) Deserialize(bytes []byte, metadata *Metadata) (Page, error) {
+	p := c.NewPage(uint64(len(bytes))).(*TimestampPage)
+	p.Metadata = metadata
+
+	tsr := c.newReconstructor(bytes[MetadataSize:])
+	for i := uint64(0); i < p.Metadata.Count; i++ {
+		tse := tsr.ReconstructNext()
+		if tse == nil {
+			return nil, errors.New("[ERROR]: failed to reconstruct timestamp entry")
+		}
+		p.Entries = append(p.Entries, tse)
+		p.addBits(tse.CompressedData.BitSize())
+	}
+
+	// further timestamps are compressed against the last one
+	tsr.Resume(p.TimestampCompressor)
+	return p, nil
+}
+
+func NewTimestampPage(pageSize uint64) *TimestampPage {
+	return NewTimestampPageWithCodec(pageSize, TimestampVarint)
+}
+
+// NewTimestampPageWithCodec creates page whose timestamps are compressed with the timestamp codec
+func NewTimestampPageWithCodec(pageSize uint64, codec Codec) *TimestampPage {
+	return codec.NewPage(pageSize).(*TimestampPage)
+}
+
+// Fits reports whether the entry compressed by the page compressor still fits in the page
+func (p *TimestampPage) Fits(tse *entry.TimestampEntry) bool {
+	return p.usedBits+tse.CompressedData.BitSize() <= (p.pageSize-MetadataSize)*8
+}
+
 func (p *TimestampPage) Add(e entry.Entry) {
 	tse, ok := e.(*entry.TimestampEntry)
 	if !ok {
@@ -32,47 +99,61 @@ func (p *TimestampPage) Add(e entry.Entry) {
 	p.Metadata.UpdateMinMaxValue(tse.Value)
 	p.Metadata.Count++
 	p.Entries = append(p.Entries, tse)
-	p.Padding -= tse.Size()
+	p.addBits(tse.CompressedData.BitSize())
+}
+
+func (p *TimestampPage) addBits(bits uint64) {
+	p.usedBits += bits
+	p.Padding = p.pageSize - MetadataSize - (p.usedBits+7)/8
 }
 
 func (p *TimestampPage) Serialize() []byte {
 	allBytes := make([]byte, 0)
 	allBytes = append(allBytes, p.Metadata.Serialize()...)
 
+	w := internal.NewBitWriter(p.pageSize - MetadataSize)
 	for _, e := range p.Entries {
-		tse, _ := e.(*entry.TimestampEntry)
-		allBytes = append(allBytes, tse.Serialize()...)
+		cd := e.(*entry.TimestampEntry).CompressedData
+		for _, b := range cd.Bytes {
+			w.WriteBits(uint64(b)<<56, 8)
+		}
+		w.WriteBits(cd.Control, int64(cd.ControlSize))
+		w.WriteBits(cd.Value, int64(cd.ValueSize))
 	}
+	w.Flush()
+	allBytes = append(allBytes, w.Bytes()...)
 
-	paddingBytes := make([]byte, p.Padding)
+	paddingBytes := make([]byte, p.pageSize-uint64(len(allBytes)))
 	allBytes = append(allBytes, paddingBytes...)
 
 	return allBytes
 }
 
-func DeserializeTimestampPage(bytes []byte) (Page, error) {
-	pageSize := uint64(len(bytes))
-	p := NewTimestampPage(pageSize)
+// timestampReconstructor reads timestamps of a page, Resume prepares compressor of the page
+// to continue after the last one read
+type timestampReconstructor interface {
+	ReconstructNext() *entry.TimestampEntry
+	Resume(compressor TimestampCompressor)
+}
 
-	p.Metadata = DeserializeMetadata(bytes)
-	if p.Metadata == nil {
-		return nil, errors.New("[ERROR]: invalid timestamp page")
-	}
+type varintReconstructor struct {
+	*entry.TimestampReconstructor
+}
 
-	tsr := entry.NewTimestampReconstructor(bytes[MetadataSize:])
+func (r *varintReconstructor) Resume(compressor TimestampCompressor) {
+	compressor.(*entry.TimestampCompressor).Update(r.LastValue())
+}
 
-	for i := uint64(0); i < p.Metadata.Count; i++ {
-		tse := tsr.ReconstructNext()
-		if tse == nil {
-			return nil, errors.New("[ERROR]: failed to reconstruct timestamp entry")
-		}
-		p.Entries = append(p.Entries, tse)
-		p.Padding -= tse.Size()
-	}
+type deltaOfDeltaReconstructor struct {
+	*entry.DeltaOfDeltaReconstructor
+}
 
-	p.TimestampCompressor.Update(tsr.LastValue())
+func (r *deltaOfDeltaReconstructor) Resume(compressor TimestampCompressor) {
+	compressor.(*entry.DeltaOfDeltaCompressor).Update(r.LastValue(), r.LastDelta())
+}
 
-	return p, nil
+func DeserializeTimestampPage(bytes []byte) (Page, error) {
+	return DeserializePage(TimestampColumn, bytes)
 }
 
 func (p *TimestampPage) EntryCount() uint64 {
@@ -1,7 +1,6 @@
 package page
 
 import (
-	"errors"
 	"math"
 	"time-series-engine/internal"
 	"time-series-engine/internal/disk/entry"
@@ -11,20 +10,65 @@ type ValuePage struct {
 	Metadata        *Metadata
 	Entries         []entry.Entry
 	ValueCompressor *entry.ValueCompressor
+	Codec           Codec
 	Padding         uint64
 	pageSize        uint64
 }
 
-func NewValuePage(pageSize uint64) *ValuePage {
+// valueCodec compresses XORs of consecutive values, which are rounded to 5 decimals unless lossless
+type valueCodec struct {
+	codecInfo
+	lossless bool
+}
+
+// Codecs of value pages
+var (
+	ValueScaled   Codec = &valueCodec{codecInfo: codecInfo{column: ValueColumn, id: ValueCodecScaled, name: "scaled"}}
+	ValueLossless Codec = &valueCodec{codecInfo: codecInfo{column: ValueColumn, id: ValueCodecLossless, name: "lossless"}, lossless: true}
+)
+
+func (c *valueCodec) NewPage(pageSize uint64) Page {
 	return &ValuePage{
-		Metadata:        NewMetadata(),
+		Metadata:        newMetadata(c),
 		Entries:         make([]entry.Entry, 0),
-		ValueCompressor: entry.NewValueCompressor(),
+		ValueCompressor: entry.NewValueCompressor(c.lossless),
+		Codec:           c,
 		Padding:         (pageSize - MetadataSize) * 8, // x8 since value page is working with bits
 		pageSize:        pageSize,
 	}
 }
 
+func (c *valueCodec) Deserialize(bytes []byte, metadata *Metadata) (Page, error) {
+	p := c.NewPage(uint64(len(bytes))).(*ValuePage)
+	p.Metadata = metadata
+
+	vr := entry.NewValueReconstructor(bytes[MetadataSize:], c.lossless)
+
+	for i := uint64(0); i < p.Metadata.Count; i++ {
+		ve := vr.ReconstructNext()
+		p.Entries = append(p.Entries, ve)
+		p.Padding -= ve.Size()
+	}
+
+	p.ValueCompressor.Update(vr.LastValue(), vr.LastLeading(), vr.LastTrailing())
+
+	return p, nil
+}
+
+func NewValuePage(pageSize uint64) *ValuePage {
+	return NewValuePageWithCodec(pageSize, ValueScaled)
+}
+
+// NewValuePageWithCodec creates page whose values are compressed with the value codec
+func NewValuePageWithCodec(pageSize uint64, codec Codec) *ValuePage {
+	return codec.NewPage(pageSize).(*ValuePage)
+}
+
+// StoredValue returns value as it is read back from the page
+func (p *ValuePage) StoredValue(value float64) float64 {
+	return p.ValueCompressor.StoredValue(value)
+}
+
 func (p *ValuePage) Add(e entry.Entry) {
 	ve, ok := e.(*entry.ValueEntry)
 	if !ok {
@@ -63,25 +107,7 @@ func (p *ValuePage) Serialize() []byte {
 }
 
 func DeserializeValuePage(bytes []byte) (Page, error) {
-	pageSize := uint64(len(bytes))
-	p := NewValuePage(pageSize)
-
-	p.Metadata = DeserializeMetadata(bytes)
-	if p.Metadata == nil {
-		return nil, errors.New("[ERROR]: invalid metadata bytes")
-	}
-
-	vr := entry.NewValueReconstructor(bytes[MetadataSize:])
-
-	for i := uint64(0); i < p.Metadata.Count; i++ {
-		ve := vr.ReconstructNext()
-		p.Entries = append(p.Entries, ve)
-		p.Padding -= ve.Size()
-	}
-
-	p.ValueCompressor.Update(vr.LastValue(), vr.LastLeading(), vr.LastTrailing())
-
-	return p, nil
+	return DeserializePage(ValueColumn, bytes)
 }
 
 func (p *ValuePage) EntryCount() uint64 {
@@ -42,21 +42,25 @@ func (p *WALPage) Serialize() []byte {
 	return allDataBytes
 }
 
+// DeserializeWALPage reads entries until the end of data or the first padding byte.
+// A corrupted entry also ends the page, then the page holds all entries before it
+// and the entry error is returned along with it.
 func DeserializeWALPage(data []byte) (*WALPage, error) {
 	var offset uint64 = 0
 	p := &WALPage{}
 	p.Entries = make([]entry.Entry, 0)
 
+	var corruption error
 	for offset+CRC < uint64(len(data)) {
 
 		e := &entry.WALEntry{}
 
 		err := e.Deserialize(data[offset:])
 		if err != nil {
-			if err == io.EOF {
-				break
+			if err != io.EOF {
+				corruption = err
 			}
-			return nil, err
+			break
 		}
 
 		entrySize := e.Size()
@@ -66,7 +70,7 @@ func DeserializeWALPage(data []byte) (*WALPage, error) {
 	}
 
 	p.paddingSize = uint64(len(data)) - offset
-	return p, nil
+	return p, corruption
 }
 
 func NewWALPage(pageSize uint64) *WALPage {
@@ -16,9 +16,16 @@ type Manager struct {
 	PageManager       *page.Manager
 	TimeWindowPath    string
 	ParquetIndex      uint64
+	Precision         internal.Precision
+
+	// StagingPath, when set, makes flushes write copies of parquets under it, in directories named
+	// after their windows, so readers of the windows never see a parquet half written.
+	// The copies are swapped in place of the originals by the caller.
+	StagingPath string
+	staged      []string
 }
 
-func NewManager(cfg *config.ParquetConfig, pm *page.Manager, path string) *Manager {
+func NewManager(cfg *config.ParquetConfig, pm *page.Manager, path string, precision internal.Precision) *Manager {
 	return &Manager{
 		ActiveParquetHash: "",
 		ActiveParquet:     nil,
@@ -26,12 +33,26 @@ func NewManager(cfg *config.ParquetConfig, pm *page.Manager, path string) *Manag
 		PageManager:       pm,
 		TimeWindowPath:    path,
 		ParquetIndex:      0,
+		Precision:         precision,
 	}
 }
 
 func (m *Manager) createParquetDirectoryPath() (string, error) {
 	pName := fmt.Sprintf("parquet%04d", m.ParquetIndex)
 	pPath := filepath.Join(m.TimeWindowPath, pName)
+	if m.StagingPath != "" {
+		m.staged = append(m.staged, pPath)
+		pPath = m.StagedPath(pPath)
+		err := os.RemoveAll(pPath)
+		if err != nil {
+			return "", err
+		}
+		err = os.MkdirAll(filepath.Dir(pPath), 0755)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	err := os.Mkdir(pPath, 0755)
 	if err != nil {
 		return "", err
@@ -58,17 +79,28 @@ func (m *Manager) FlushSeries(tsHash string, points []*internal.Point) error {
 			}
 		}
 
-		foundParquet, err := m.findParquetDirectory(tsHash)
+		meta, path, err := m.findParquetDirectory(tsHash)
 		if err != nil {
 			return err
 		}
 
-		if foundParquet != nil {
-			m.ActiveParquet = foundParquet
+		if meta != nil {
+			if m.StagingPath != "" {
+				path, err = m.stageParquet(path)
+				if err != nil {
+					return err
+				}
+			}
+			m.ActiveParquet, err = LoadParquet(meta, m.Config, m.PageManager, path)
+			if err != nil {
+				return err
+			}
 		} else {
-			var path string
 			path, err = m.createParquetDirectoryPath()
-			m.ActiveParquet, err = NewParquet(tsHash, m.Config, m.PageManager, path)
+			if err != nil {
+				return err
+			}
+			m.ActiveParquet, err = NewParquet(tsHash, m.Precision, m.Config, m.PageManager, path)
 			if err != nil {
 				return err
 			}
@@ -109,11 +141,11 @@ func (m *Manager) FlushAll(series map[string][]*internal.Point) error {
 
 // findParquetDirectory : search if already exists parquet file
 // with appropriate time series hash in actual time window
-//   - returns parquet if it already exists (nil otherwise), and error indicator
-func (m *Manager) findParquetDirectory(timeSeriesHash string) (*Parquet, error) {
+//   - returns metadata and path of the parquet if it already exists (nil otherwise), and error indicator
+func (m *Manager) findParquetDirectory(timeSeriesHash string) (*Metadata, string, error) {
 	entries, err := os.ReadDir(m.TimeWindowPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read time window directory: %w", m.TimeWindowPath)
+		return nil, "", fmt.Errorf("failed to read time window directory %s: %w", m.TimeWindowPath, err)
 	}
 
 	for _, entry := range entries {
@@ -126,25 +158,20 @@ func (m *Manager) findParquetDirectory(timeSeriesHash string) (*Parquet, error)
 
 		data, err := m.PageManager.ReadStructure(metaPath, 0)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		meta, err := DeserializeParquetMetadata(data)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		if meta.TimeSeriesHash == timeSeriesHash {
-			p, err := LoadParquet(meta, m.Config, m.PageManager, parquetDir)
-			if err != nil {
-				return nil, err
-			}
-
-			return p, nil
+			return meta, parquetDir, nil
 		}
 	}
 
-	return nil, nil
+	return nil, "", nil
 }
 
 func (m *Manager) Update(twPath string) {
@@ -152,4 +179,15 @@ func (m *Manager) Update(twPath string) {
 	m.ActiveParquet = nil
 	m.TimeWindowPath = twPath
 	m.ParquetIndex = 0
+
+	// continue numbering after parquets which are already in the window
+	entries, err := os.ReadDir(twPath)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			m.ParquetIndex++
+		}
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"math"
+	"time-series-engine/internal"
 )
 
 type Metadata struct {
@@ -11,13 +12,18 @@ type Metadata struct {
 	MaxTimestamp   uint64
 	PointsNumber   uint64
 	TimeSeriesHash string
+	Precision      internal.Precision
+	// EscapedHash is false for parquets written before separators in hashes were escaped
+	EscapedHash bool
 }
 
-func NewMetadata(timeSeriesHash string) *Metadata {
+func NewMetadata(timeSeriesHash string, precision internal.Precision) *Metadata {
 	return &Metadata{
 		MinTimestamp:   math.MaxUint64,
 		MaxTimestamp:   0,
 		TimeSeriesHash: timeSeriesHash,
+		Precision:      precision,
+		EscapedHash:    true,
 	}
 }
 
@@ -37,6 +43,14 @@ func (m *Metadata) Serialize() []byte {
 	writeUint64(uint64(len(m.TimeSeriesHash)))
 	allBytes = append(allBytes, m.TimeSeriesHash...)
 
+	allBytes = append(allBytes, m.Precision.Code())
+
+	var escaped byte
+	if m.EscapedHash {
+		escaped = 1
+	}
+	allBytes = append(allBytes, escaped)
+
 	return allBytes
 }
 
@@ -74,6 +88,17 @@ func DeserializeParquetMetadata(data []byte) (*Metadata, error) {
 		return nil, errors.New("unexpected EOF while reading timestamp hash")
 	}
 	m.TimeSeriesHash = string(data[offset : offset+int(hashLength)])
+	offset += int(hashLength)
+
+	// parquets written before precision was configurable use seconds
+	m.Precision = internal.Seconds
+	if offset < len(data) {
+		if m.Precision, err = internal.PrecisionFromCode(data[offset]); err != nil {
+			return nil, err
+		}
+		offset++
+	}
+	m.EscapedHash = offset < len(data) && data[offset] == 1
 
 	return m, nil
 }
@@ -82,5 +107,7 @@ func (m *Metadata) Update(timestamp uint64) {
 	if timestamp < m.MinTimestamp {
 		m.MinTimestamp = timestamp
 	}
-	m.MaxTimestamp = timestamp
+	if timestamp > m.MaxTimestamp {
+		m.MaxTimestamp = timestamp
+	}
 }
@@ -17,16 +17,24 @@ type Parquet struct {
 	PageManager    *page.Manager
 	DirectoryPath  string
 	RowGroupIndex  uint64
+	// Encoding overrides configured codecs of new row groups, for columns whose codec is set
+	Encoding row_group.Encoding
 }
 
-func NewParquet(timeSeriesHash string, c *config.ParquetConfig, pm *page.Manager, dirPath string) (*Parquet, error) {
+func NewParquet(timeSeriesHash string, precision internal.Precision, c *config.ParquetConfig, pm *page.Manager, dirPath string) (*Parquet, error) {
+	return NewParquetWithEncoding(timeSeriesHash, precision, c, pm, dirPath, row_group.Encoding{})
+}
+
+// NewParquetWithEncoding creates parquet whose row groups use codecs of the encoding instead of configured ones
+func NewParquetWithEncoding(timeSeriesHash string, precision internal.Precision, c *config.ParquetConfig, pm *page.Manager, dirPath string, codecs row_group.Encoding) (*Parquet, error) {
 	p := &Parquet{
-		Metadata:       NewMetadata(timeSeriesHash),
+		Metadata:       NewMetadata(timeSeriesHash, precision),
 		ActiveRowGroup: nil,
 		Config:         c,
 		PageManager:    pm,
 		RowGroupIndex:  0,
 		DirectoryPath:  dirPath,
+		Encoding:       codecs,
 	}
 
 	var err error
@@ -36,7 +44,11 @@ func NewParquet(timeSeriesHash string, c *config.ParquetConfig, pm *page.Manager
 		return nil, err
 	}
 
-	p.ActiveRowGroup, err = row_group.NewRowGroup(pm, path, p.RowGroupIndex)
+	encoding, err := p.encoding()
+	if err != nil {
+		return nil, err
+	}
+	p.ActiveRowGroup, err = row_group.NewRowGroup(pm, path, p.RowGroupIndex, encoding)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +65,7 @@ func (p *Parquet) AddPoint(point *internal.Point) error {
 	p.Metadata.Update(point.Timestamp)
 
 	var err error
-	if p.shouldFlushRowGroup() {
+	if p.shouldFlushRowGroup(point) {
 		err = p.ActiveRowGroup.Save()
 		if err != nil {
 			return err
@@ -68,7 +80,11 @@ func (p *Parquet) AddPoint(point *internal.Point) error {
 			return err
 		}
 
-		p.ActiveRowGroup, err = row_group.NewRowGroup(p.PageManager, path, p.RowGroupIndex)
+		encoding, err := p.encoding()
+		if err != nil {
+			return err
+		}
+		p.ActiveRowGroup, err = row_group.NewRowGroup(p.PageManager, path, p.RowGroupIndex, encoding)
 		if err != nil {
 			return err
 		}
@@ -98,6 +114,32 @@ func (p *Parquet) Close() error {
 	return nil
 }
 
+// encoding returns codecs of new row groups of the time series, as configured unless overridden
+func (p *Parquet) encoding() (row_group.Encoding, error) {
+	measurement := internal.HashMeasurement(p.Metadata.TimeSeriesHash)
+	encoding := p.Encoding
+	var err error
+	if encoding.Timestamp == nil {
+		encoding.Timestamp, err = page.CodecByName(page.TimestampColumn, p.Config.TimestampEncoding)
+		if err != nil {
+			return row_group.Encoding{}, err
+		}
+	}
+	if encoding.Value == nil {
+		encoding.Value, err = page.CodecByName(page.ValueColumn, p.Config.MeasurementValueEncoding(measurement))
+		if err != nil {
+			return row_group.Encoding{}, err
+		}
+	}
+	if encoding.Delete == nil {
+		encoding.Delete, err = page.CodecByName(page.DeleteColumn, p.Config.DeleteEncoding)
+		if err != nil {
+			return row_group.Encoding{}, err
+		}
+	}
+	return encoding, nil
+}
+
 func (p *Parquet) createRowGroupDirectoryPath() (string, error) {
 	rgName := fmt.Sprintf("rowgroup%04d", p.RowGroupIndex)
 
@@ -110,8 +152,15 @@ func (p *Parquet) createRowGroupDirectoryPath() (string, error) {
 	return rgPath, nil
 }
 
-func (p *Parquet) shouldFlushRowGroup() bool {
-	return p.Metadata.PointsNumber != 0 && p.Metadata.PointsNumber%p.Config.RowGroupSize == 0
+// shouldFlushRowGroup reports whether the point has to go to a new row group, either because
+// active one is full, or because the point is older than its last point. Readers rely on
+// timestamps being sorted inside a row group, so backfilled points start a new one.
+func (p *Parquet) shouldFlushRowGroup(point *internal.Point) bool {
+	rgMeta := p.ActiveRowGroup.Metadata
+	if rgMeta.PointsNumber == 0 {
+		return false
+	}
+	return rgMeta.PointsNumber >= p.Config.RowGroupSize || point.Timestamp < rgMeta.MaxTimestamp
 }
 
 func LoadParquet(m *Metadata, c *config.ParquetConfig, pm *page.Manager, path string) (*Parquet, error) {
@@ -142,7 +191,11 @@ func LoadParquet(m *Metadata, c *config.ParquetConfig, pm *page.Manager, path st
 			return nil, err
 		}
 
-		p.ActiveRowGroup, err = row_group.NewRowGroup(pm, rgPath, p.RowGroupIndex)
+		encoding, err := p.encoding()
+		if err != nil {
+			return nil, err
+		}
+		p.ActiveRowGroup, err = row_group.NewRowGroup(pm, rgPath, p.RowGroupIndex, encoding)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,92 @@
+package parquet
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StagedPath returns where the copy of the parquet is written while the manager stages flushes
+func (m *Manager) StagedPath(parquetPath string) string {
+	return filepath.Join(m.StagingPath, filepath.Base(filepath.Dir(parquetPath)), filepath.Base(parquetPath))
+}
+
+// TakeStaged returns paths of parquets whose copies were written since the last call
+func (m *Manager) TakeStaged() []string {
+	staged := m.staged
+	m.staged = nil
+	return staged
+}
+
+// stageParquet copies the parquet to its staged path and returns it. A flush changes only
+// metadata and the last row group, files of the other row groups are linked instead.
+func (m *Manager) stageParquet(parquetPath string) (string, error) {
+	staged := m.StagedPath(parquetPath)
+	err := os.RemoveAll(staged)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(staged, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(parquetPath)
+	if err != nil {
+		return "", err
+	}
+	for i, entry := range entries {
+		src := filepath.Join(parquetPath, entry.Name())
+		dst := filepath.Join(staged, entry.Name())
+		if !entry.IsDir() {
+			err = copyFile(src, dst)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		err = os.Mkdir(dst, 0755)
+		if err != nil {
+			return "", err
+		}
+		files, err := os.ReadDir(src)
+		if err != nil {
+			return "", err
+		}
+		// last row group is the one points are appended to, same as in LoadParquet
+		last := i == len(entries)-1
+		for _, f := range files {
+			if last {
+				err = copyFile(filepath.Join(src, f.Name()), filepath.Join(dst, f.Name()))
+			} else {
+				err = os.Link(filepath.Join(src, f.Name()), filepath.Join(dst, f.Name()))
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	m.staged = append(m.staged, parquetPath)
+	return staged, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,465 @@
+package disk
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk/entry"
+	"time-series-engine/internal/disk/page"
+	"time-series-engine/internal/disk/row_group"
+)
+
+// PointIterator streams points in timestamp order:
+//
+//	for it.Next() {
+//		p := it.At()
+//	}
+//	err := it.Err()
+//
+// Close releases resources held by the iterator and may be called at any time.
+type PointIterator interface {
+	Next() bool
+	At() *internal.Point
+	Err() error
+	Close() error
+}
+
+// Collect drains the iterator into a slice and closes it
+func Collect(it PointIterator) ([]*internal.Point, error) {
+	result := make([]*internal.Point, 0)
+	for it.Next() {
+		result = append(result, it.At())
+	}
+	err := it.Err()
+	closeErr := it.Close()
+	if err != nil {
+		return nil, err
+	}
+	return result, closeErr
+}
+
+type sliceIterator struct {
+	points  []*internal.Point
+	current int
+}
+
+// NewSliceIterator iterates over points already sorted by timestamp
+func NewSliceIterator(points []*internal.Point) PointIterator {
+	return &sliceIterator{points: points, current: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.current+1 >= len(it.points) {
+		it.current = len(it.points)
+		return false
+	}
+	it.current++
+	return true
+}
+
+func (it *sliceIterator) At() *internal.Point {
+	return it.points[it.current]
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	it.points = nil
+	return nil
+}
+
+// rowGroupIterator decodes the three columns of a row group page by page,
+// deleteIter is nil when the row group has no deletions
+type rowGroupIterator struct {
+	tsIter, valueIter, deleteIter *Iterator
+	maxTimestamp                  uint64
+	current                       *internal.Point
+	err                           error
+	done                          bool
+}
+
+// NewRowGroupIterator iterates over points of the row group with timestamps in [minTimestamp, maxTimestamp],
+// skipping deleted ones. Only pages of the range are read.
+func NewRowGroupIterator(pm *page.Manager, rgPath string, minTimestamp uint64, maxTimestamp uint64) (PointIterator, error) {
+	return newRowGroupIterator(pm, rgPath, minTimestamp, maxTimestamp, true)
+}
+
+// newRowGroupIterator reads the delete column only when the row group has deletions
+func newRowGroupIterator(
+	pm *page.Manager, rgPath string,
+	minTimestamp uint64, maxTimestamp uint64,
+	hasDeletions bool,
+) (PointIterator, error) {
+	it := &rowGroupIterator{maxTimestamp: maxTimestamp}
+
+	var err error
+	it.tsIter, err = NewIterator(pm, filepath.Join(rgPath, "timestamp.db"), Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := it.tsIter.Skip(minTimestamp, maxTimestamp)
+	if err == io.EOF {
+		// row group overlaps the range, but none of its timestamps is inside it
+		it.done = true
+		return it, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	it.valueIter, err = NewIterator(pm, filepath.Join(rgPath, "value.db"), Value)
+	if err != nil {
+		return nil, err
+	}
+	err = it.valueIter.Advance(skipped)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasDeletions {
+		return it, nil
+	}
+	it.deleteIter, err = NewIterator(pm, filepath.Join(rgPath, "delete.db"), Delete)
+	if err != nil {
+		return nil, err
+	}
+	err = it.deleteIter.Advance(skipped)
+	if err != nil {
+		return nil, err
+	}
+
+	return it, nil
+}
+
+func (it *rowGroupIterator) Next() bool {
+	for !it.done {
+		e, err := it.tsIter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			it.err = err
+			break
+		}
+		tsEntry := e.(*entry.TimestampEntry)
+		if tsEntry.GetValue() > it.maxTimestamp {
+			break
+		}
+
+		e, err = it.valueIter.Next()
+		if err != nil {
+			it.err = err
+			break
+		}
+		valueEntry := e.(*entry.ValueEntry)
+
+		if it.deleteIter != nil {
+			e, err = it.deleteIter.Next()
+			if err != nil {
+				it.err = err
+				break
+			}
+			if e.(*entry.DeleteEntry).Deleted {
+				continue
+			}
+		}
+
+		it.current = &internal.Point{
+			Value:     valueEntry.Value,
+			Timestamp: tsEntry.Value,
+		}
+		return true
+	}
+
+	it.done = true
+	it.current = nil
+	return false
+}
+
+func (it *rowGroupIterator) At() *internal.Point {
+	return it.current
+}
+
+func (it *rowGroupIterator) Err() error {
+	return it.err
+}
+
+func (it *rowGroupIterator) Close() error {
+	it.done = true
+	it.tsIter, it.valueIter, it.deleteIter = nil, nil, nil
+	return nil
+}
+
+// LazySource is an iterator opened by the merge iterator once points before MinTimestamp are consumed
+type LazySource struct {
+	MinTimestamp uint64
+	Open         func() (PointIterator, error)
+}
+
+type mergeEntry struct {
+	it   PointIterator
+	rank int
+}
+
+type mergeHeap []*mergeEntry
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	ti, tj := h[i].it.At().Timestamp, h[j].it.At().Timestamp
+	if ti == tj {
+		return h[i].rank < h[j].rank
+	}
+	return ti < tj
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*mergeEntry)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// mergeIterator merges sorted iterators, opening sources only when their points may be next,
+// so just the sources overlapping the current timestamp are open at once. Ties on the heap are
+// broken by rank, which is the position of the source in the order they were written.
+type mergeIterator struct {
+	pending []*LazySource // sorted by MinTimestamp
+	ranks   []int         // of pending sources
+	heap    mergeHeap
+	current *internal.Point
+	err     error
+}
+
+// NewMergeIterator merges iterators into one in timestamp order. Of points with equal timestamps
+// only the last written one is returned, which is the last one of the latest source, sources being
+// ordered from the oldest to the newest.
+func NewMergeIterator(its ...PointIterator) PointIterator {
+	sources := make([]*LazySource, 0, len(its))
+	for _, it := range its {
+		sources = append(sources, &LazySource{Open: func() (PointIterator, error) { return it, nil }})
+	}
+	return NewLazyMergeIterator(sources)
+}
+
+// NewLazyMergeIterator is NewMergeIterator for sources which are opened when they are reached
+func NewLazyMergeIterator(sources []*LazySource) PointIterator {
+	ranks := make([]int, len(sources))
+	for i := range ranks {
+		ranks[i] = i
+	}
+	pending := append([]*LazySource(nil), sources...)
+	sort.Stable(bySourceStart{pending, ranks})
+
+	return &mergeIterator{pending: pending, ranks: ranks}
+}
+
+type bySourceStart struct {
+	sources []*LazySource
+	ranks   []int
+}
+
+func (s bySourceStart) Len() int { return len(s.sources) }
+func (s bySourceStart) Less(i, j int) bool {
+	return s.sources[i].MinTimestamp < s.sources[j].MinTimestamp
+}
+func (s bySourceStart) Swap(i, j int) {
+	s.sources[i], s.sources[j] = s.sources[j], s.sources[i]
+	s.ranks[i], s.ranks[j] = s.ranks[j], s.ranks[i]
+}
+
+// openPending opens sources which may contain points not after the smallest open timestamp
+func (it *mergeIterator) openPending() bool {
+	for len(it.pending) > 0 {
+		if len(it.heap) > 0 && it.heap[0].it.At().Timestamp < it.pending[0].MinTimestamp {
+			return true
+		}
+
+		source, rank := it.pending[0], it.ranks[0]
+		it.pending, it.ranks = it.pending[1:], it.ranks[1:]
+
+		opened, err := source.Open()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if !it.advance(opened, rank) {
+			return false
+		}
+	}
+	return true
+}
+
+// advance moves the source to its next point and puts it on the heap, or closes it when it is
+// exhausted, false on error
+func (it *mergeIterator) advance(source PointIterator, rank int) bool {
+	if source.Next() {
+		heap.Push(&it.heap, &mergeEntry{it: source, rank: rank})
+		return true
+	}
+	err := source.Err()
+	closeErr := source.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+	return true
+}
+
+func (it *mergeIterator) Next() bool {
+	if it.err != nil || !it.openPending() || len(it.heap) == 0 {
+		it.current = nil
+		return false
+	}
+
+	// points with equal timestamps are popped in the order they were written, the last one wins
+	timestamp := it.heap[0].it.At().Timestamp
+	for len(it.heap) > 0 && it.heap[0].it.At().Timestamp == timestamp {
+		top := heap.Pop(&it.heap).(*mergeEntry)
+		it.current = top.it.At()
+		if !it.advance(top.it, top.rank) {
+			it.current = nil
+			return false
+		}
+	}
+	return true
+}
+
+func (it *mergeIterator) At() *internal.Point {
+	return it.current
+}
+
+func (it *mergeIterator) Err() error {
+	return it.err
+}
+
+func (it *mergeIterator) Close() error {
+	var err error
+	for _, e := range it.heap {
+		if closeErr := e.it.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	it.pending, it.ranks, it.heap = nil, nil, nil
+	return err
+}
+
+// NewParquetIterator iterates over points of the parquet with timestamps in [minTimestamp, maxTimestamp].
+// Row groups may overlap when older points were flushed after newer ones, so they are merged.
+func NewParquetIterator(pm *page.Manager, parquetPath string, minTimestamp uint64, maxTimestamp uint64) (PointIterator, error) {
+	rowGroups, err := parquetRowGroups(pm, parquetPath, minTimestamp, maxTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]*LazySource, 0, len(rowGroups))
+	for _, rg := range rowGroups {
+		sources = append(sources, rg.source(pm, minTimestamp, maxTimestamp))
+	}
+	return NewLazyMergeIterator(sources), nil
+}
+
+// rowGroupInfo is a row group overlapping the range of a query
+type rowGroupInfo struct {
+	path string
+	meta *row_group.Metadata
+}
+
+func (rg *rowGroupInfo) source(pm *page.Manager, minTimestamp uint64, maxTimestamp uint64) *LazySource {
+	return &LazySource{
+		MinTimestamp: rg.meta.MinTimestamp,
+		Open: func() (PointIterator, error) {
+			return newRowGroupIterator(pm, rg.path, minTimestamp, maxTimestamp, rg.meta.HasDeletions())
+		},
+	}
+}
+
+// parquetRowGroups returns row groups of the parquet overlapping [minTimestamp, maxTimestamp],
+// from the oldest to the newest
+func parquetRowGroups(pm *page.Manager, parquetPath string, minTimestamp uint64, maxTimestamp uint64) ([]*rowGroupInfo, error) {
+	entries, err := os.ReadDir(parquetPath)
+	if err != nil {
+		return nil, fmt.Errorf("[ERROR]: cannot read from parquet directory: %s", parquetPath)
+	}
+	// indices outgrow the zero padding of the names
+	sort.SliceStable(entries, func(i, j int) bool {
+		return rowGroupIndex(entries[i].Name()) < rowGroupIndex(entries[j].Name())
+	})
+
+	rowGroups := make([]*rowGroupInfo, 0)
+	for _, rg := range entries {
+		if !rg.IsDir() {
+			continue
+		}
+
+		rgPath := filepath.Join(parquetPath, rg.Name())
+		metaBytes, err := pm.ReadStructure(filepath.Join(rgPath, "metadata.db"), 0)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := row_group.DeserializeMetadata(metaBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !DoIntervalsOverlap(minTimestamp, maxTimestamp, meta.MinTimestamp, meta.MaxTimestamp) {
+			continue
+		}
+		rowGroups = append(rowGroups, &rowGroupInfo{path: rgPath, meta: meta})
+	}
+	return rowGroups, nil
+}
+
+// rowGroupIndex parses index of the row group from its directory name
+func rowGroupIndex(name string) uint64 {
+	index, _ := strconv.ParseUint(strings.TrimPrefix(name, "rowgroup"), 10, 64)
+	return index
+}
+
+// NewSeriesIterator iterates over points of the time series stored in the windows directory
+// with timestamps in [minTimestamp, maxTimestamp]. Windows are read one after another.
+func NewSeriesIterator(pm *page.Manager, windowsDir string, ts *internal.TimeSeries, minTimestamp uint64, maxTimestamp uint64) (PointIterator, error) {
+	windows, err := os.ReadDir(windowsDir)
+	if err != nil {
+		return nil, errors.New("[ERROR]: cannot read from time windows directory")
+	}
+
+	sources := make([]*LazySource, 0)
+	for _, window := range windows {
+		start, end, err := MinMaxTimestamp(window.Name())
+		if err != nil {
+			return nil, err
+		}
+		if !DoIntervalsOverlap(minTimestamp, maxTimestamp, start, end) {
+			continue
+		}
+
+		windowName := window.Name()
+		sources = append(sources, &LazySource{
+			MinTimestamp: start,
+			Open: func() (PointIterator, error) {
+				p, err := GetParquet(pm, windowsDir, windowName, ts, minTimestamp, maxTimestamp)
+				if err != nil {
+					return nil, err
+				}
+				if p == "" {
+					return NewSliceIterator(nil), nil
+				}
+				return NewParquetIterator(pm, p, minTimestamp, maxTimestamp)
+			},
+		})
+	}
+
+	return NewLazyMergeIterator(sources), nil
+}
@@ -20,6 +20,13 @@ type Metadata struct {
 	TimestampOffset uint64
 	ValueOffset     uint64
 	DeleteOffset    uint64
+
+	SumValue      float64
+	DeletedPoints uint64 // points marked deleted since the row group was written
+
+	// HasStatistics is false for row groups written before SumValue and DeletedPoints were
+	// recorded, their statistics can't be used instead of reading the points
+	HasStatistics bool
 }
 
 func NewMetadata(rgIndex uint64) *Metadata {
@@ -30,6 +37,7 @@ func NewMetadata(rgIndex uint64) *Metadata {
 		MaxValue: math.Inf(-1),
 
 		RowGroupIndex: rgIndex,
+		HasStatistics: true,
 	}
 }
 
@@ -48,9 +56,21 @@ func (m *Metadata) Update(p *internal.Point) {
 		m.MaxValue = p.Value
 	}
 
+	m.SumValue += p.Value
 	m.PointsNumber++
 }
 
+// HasDeletions reports whether some points of the row group may be deleted, otherwise its delete
+// column doesn't have to be read. Deletes are not counted in row groups without statistics.
+func (m *Metadata) HasDeletions() bool {
+	return !m.HasStatistics || m.DeletedPoints > 0
+}
+
+// Covers reports whether all points of the row group have timestamps in [minTimestamp, maxTimestamp]
+func (m *Metadata) Covers(minTimestamp, maxTimestamp uint64) bool {
+	return minTimestamp <= m.MinTimestamp && m.MaxTimestamp <= maxTimestamp
+}
+
 func (m *Metadata) Serialize() []byte {
 	allBytes := make([]byte, 0)
 
@@ -78,6 +98,11 @@ func (m *Metadata) Serialize() []byte {
 	writeUint64(m.ValueOffset)
 	writeUint64(m.DeleteOffset)
 
+	if m.HasStatistics {
+		writeFloat64(m.SumValue)
+		writeUint64(m.DeletedPoints)
+	}
+
 	return allBytes
 }
 
@@ -133,5 +158,17 @@ func DeserializeMetadata(data []byte) (*Metadata, error) {
 		return nil, err
 	}
 
+	// older row groups end here
+	if offset == len(data) {
+		return m, nil
+	}
+	if m.SumValue, err = readFloat64(); err != nil {
+		return nil, err
+	}
+	if m.DeletedPoints, err = readUint64(); err != nil {
+		return nil, err
+	}
+	m.HasStatistics = true
+
 	return m, nil
 }
@@ -1,6 +1,10 @@
 package row_group
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"path/filepath"
 	"time-series-engine/internal"
 	"time-series-engine/internal/disk/chunk"
@@ -16,7 +20,14 @@ type RowGroup struct {
 	DirectoryPath  string
 }
 
-func NewRowGroup(pm *page.Manager, path string, rgIndex uint64) (*RowGroup, error) {
+// Encoding selects codecs of columns of a new row group
+type Encoding struct {
+	Timestamp page.Codec
+	Value     page.Codec
+	Delete    page.Codec
+}
+
+func NewRowGroup(pm *page.Manager, path string, rgIndex uint64, encoding Encoding) (*RowGroup, error) {
 	files := make([]*string, 0, 4) // metadata + timestamp + value + delete
 	filePathMetadata := filepath.Join(path, "metadata.db")
 	filePathTimestamp := filepath.Join(path, "timestamp.db")
@@ -32,15 +43,16 @@ func NewRowGroup(pm *page.Manager, path string, rgIndex uint64) (*RowGroup, erro
 	return &RowGroup{
 		PageManager:    pm,
 		Metadata:       NewMetadata(rgIndex),
-		TimestampChunk: chunk.NewTimestampChunk(pm.Config.PageSize, filePathTimestamp),
-		ValueChunk:     chunk.NewValueChunk(pm.Config.PageSize, filePathValue),
-		DeleteChunk:    chunk.NewDeleteChunk(pm.Config.PageSize, filePathDelete),
+		TimestampChunk: chunk.NewTimestampChunkWithCodec(pm.Config.PageSize, filePathTimestamp, encoding.Timestamp),
+		ValueChunk:     chunk.NewValueChunkWithCodec(pm.Config.PageSize, filePathValue, encoding.Value),
+		DeleteChunk:    chunk.NewDeleteChunkWithCodec(pm.Config.PageSize, filePathDelete, encoding.Delete),
 		DirectoryPath:  path,
 	}, nil
 }
 
 func (rg *RowGroup) AddPoint(p *internal.Point) error {
-	rg.Metadata.Update(p)
+	// statistics have to match values read back, so aggregations may use them instead
+	rg.Metadata.Update(&internal.Point{Timestamp: p.Timestamp, Value: rg.ValueChunk.StoredValue(p.Value)})
 
 	err := rg.TimestampChunk.Add(rg.PageManager, p.Timestamp)
 	if err != nil {
@@ -124,6 +136,14 @@ func LoadRowGroup(pm *page.Manager, path string) (*RowGroup, error) {
 
 	rg.Metadata = meta
 
+	// pages of the active row group are written again, so they can't stay compressed
+	for _, columnPath := range []string{timestampPath, valuePath} {
+		err = pm.DecompressFile(columnPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	timestampChunk := &chunk.TimestampChunk{
 		ActivePage:    nil,
 		FilePath:      timestampPath,
@@ -160,3 +180,36 @@ func LoadRowGroup(pm *page.Manager, path string) (*RowGroup, error) {
 
 	return rg, nil
 }
+
+// ReadEncoding returns codecs of the first pages of columns of the row group.
+// Codec of a column without pages, like a missing delete column, is left nil.
+func ReadEncoding(pm *page.Manager, path string) (Encoding, error) {
+	var encoding Encoding
+	columns := []struct {
+		column page.Column
+		file   string
+		codec  *page.Codec
+	}{
+		{page.TimestampColumn, "timestamp.db", &encoding.Timestamp},
+		{page.ValueColumn, "value.db", &encoding.Value},
+		{page.DeleteColumn, "delete.db", &encoding.Delete},
+	}
+	for _, c := range columns {
+		bytes, err := pm.ReadPage(filepath.Join(path, c.file), 0)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, io.EOF) {
+			continue
+		}
+		if err != nil {
+			return Encoding{}, err
+		}
+		md := page.DeserializeMetadata(bytes)
+		if md == nil {
+			return Encoding{}, fmt.Errorf("[ERROR]: invalid %s page metadata in %s", c.column, path)
+		}
+		*c.codec, err = page.LookupCodec(c.column, md.Codec)
+		if err != nil {
+			return Encoding{}, err
+		}
+	}
+	return encoding, nil
+}
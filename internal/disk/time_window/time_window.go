@@ -11,6 +11,8 @@ import (
 	"time-series-engine/internal/disk/parquet"
 )
 
+// TimeWindow bounds are inclusive and expressed in units of the engine timestamp precision,
+// which is also how window directories are named
 type TimeWindow struct {
 	StartTimestamp uint64
 	EndTimestamp   uint64
@@ -21,10 +23,10 @@ type TimeWindow struct {
 }
 
 func NewTimeWindow(startTimestamp uint64, windowsDir string,
-	parquetManager *parquet.Manager, c *config.TimeWindowConfig) (*TimeWindow, error) {
+	parquetManager *parquet.Manager, c *config.TimeWindowConfig, precision internal.Precision) (*TimeWindow, error) {
 	tw := &TimeWindow{
 		StartTimestamp: startTimestamp,
-		EndTimestamp:   startTimestamp + c.Duration,
+		EndTimestamp:   startTimestamp + Duration(c, precision) - 1,
 		WindowsDir:     windowsDir,
 		ParquetManager: parquetManager,
 		Config:         c,
@@ -38,6 +40,11 @@ func NewTimeWindow(startTimestamp uint64, windowsDir string,
 	return tw, nil
 }
 
+// Duration returns configured window length in timestamp units
+func Duration(c *config.TimeWindowConfig, precision internal.Precision) uint64 {
+	return c.Duration * precision.PerSecond()
+}
+
 func (tw *TimeWindow) Belongs(timestamp uint64) bool {
 	if tw.StartTimestamp <= timestamp && timestamp <= tw.EndTimestamp {
 		return true
@@ -66,7 +73,54 @@ func (tw *TimeWindow) FlushSeries(timeSeriesHash string, points []*internal.Poin
 	return tw.ParquetManager.FlushSeries(timeSeriesHash, points)
 }
 
-func LoadExistingTimeWindow(currentTime uint64, windowsDir string, conf *config.TimeWindowConfig, parquetManager *parquet.Manager) (*TimeWindow, error) {
+// LoadExistingTimeWindow returns the time window containing timestamp, creating it if there is none
+func LoadExistingTimeWindow(timestamp uint64, windowsDir string, conf *config.TimeWindowConfig,
+	precision internal.Precision, parquetManager *parquet.Manager) (*TimeWindow, error) {
+	bounds, err := existingWindows(windowsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range bounds {
+		if b.start <= timestamp && timestamp <= b.end {
+			tw := &TimeWindow{
+				StartTimestamp: b.start,
+				EndTimestamp:   b.end,
+				WindowsDir:     windowsDir,
+				Path:           filepath.Join(windowsDir, b.name),
+				ParquetManager: parquetManager,
+				Config:         conf,
+			}
+			tw.ParquetManager.Update(tw.Path)
+			return tw, nil
+		}
+	}
+
+	start, end := newWindowBounds(timestamp, Duration(conf, precision), bounds)
+	tw := &TimeWindow{
+		StartTimestamp: start,
+		EndTimestamp:   end,
+		WindowsDir:     windowsDir,
+		ParquetManager: parquetManager,
+		Config:         conf,
+	}
+
+	err = tw.CreateNewWindowDirectory()
+	if err != nil {
+		return nil, err
+	}
+	tw.ParquetManager.Update(tw.Path)
+
+	return tw, nil
+}
+
+type windowBounds struct {
+	name  string
+	start uint64
+	end   uint64
+}
+
+func existingWindows(windowsDir string) ([]windowBounds, error) {
 	files, err := os.ReadDir(windowsDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read windows directory: %w", err)
@@ -74,6 +128,7 @@ func LoadExistingTimeWindow(currentTime uint64, windowsDir string, conf *config.
 
 	re := regexp.MustCompile(`^window_(\d+)-(\d+)$`)
 
+	bounds := make([]windowBounds, 0, len(files))
 	for _, f := range files {
 		if !f.IsDir() {
 			continue
@@ -90,18 +145,27 @@ func LoadExistingTimeWindow(currentTime uint64, windowsDir string, conf *config.
 			continue
 		}
 
-		if currentTime >= start && currentTime < end {
-			tw := &TimeWindow{
-				StartTimestamp: start,
-				EndTimestamp:   end,
-				WindowsDir:     windowsDir,
-				Path:           filepath.Join(windowsDir, f.Name()),
-				ParquetManager: parquetManager,
-				Config:         conf,
-			}
-			tw.ParquetManager.Update(tw.Path)
-			return tw, nil
+		bounds = append(bounds, windowBounds{name: f.Name(), start: start, end: end})
+	}
+
+	return bounds, nil
+}
+
+// newWindowBounds aligns a new window to a multiple of duration, so windows created
+// for out of order timestamps never overlap. Windows created by older versions are not
+// aligned, so the new window is shrunk to fit between its neighbours.
+func newWindowBounds(timestamp uint64, duration uint64, existing []windowBounds) (uint64, uint64) {
+	start := timestamp - timestamp%duration
+	end := start + duration - 1
+
+	for _, b := range existing {
+		if b.end < timestamp && b.end >= start {
+			start = b.end + 1
+		}
+		if b.start > timestamp && b.start <= end {
+			end = b.start - 1
 		}
 	}
-	return NewTimeWindow(currentTime, windowsDir, parquetManager, conf)
+
+	return start, end
 }
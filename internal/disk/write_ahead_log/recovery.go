@@ -0,0 +1,180 @@
+package write_ahead_log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time-series-engine/internal/disk/entry"
+	"time-series-engine/internal/disk/page"
+)
+
+// Corruption is a part of a segment discarded during recovery
+type Corruption struct {
+	Segment string
+	Offset  uint64 // of the first corrupted entry
+	Length  uint64 // number of discarded bytes, including padding
+	Err     error
+}
+
+// RecoveryReport summarizes replay of the log
+type RecoveryReport struct {
+	Mode            string
+	Replayed        uint64 // number of entries passed to the replay function
+	Corruptions     []Corruption
+	RemovedSegments []string // segments after a corruption, removed in truncate mode
+	DiscardedBytes  uint64
+}
+
+func (r *RecoveryReport) Clean() bool {
+	return len(r.Corruptions) == 0
+}
+
+func (r *RecoveryReport) String() string {
+	if r.Clean() {
+		return fmt.Sprintf("WAL recovery replayed %d entries", r.Replayed)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "WAL recovery (%s mode) replayed %d entries and discarded %d bytes:",
+		r.Mode, r.Replayed, r.DiscardedBytes)
+	for _, c := range r.Corruptions {
+		fmt.Fprintf(&b, "\n  %s at offset %d: %v, %d bytes discarded", c.Segment, c.Offset, c.Err, c.Length)
+	}
+	for _, segment := range r.RemovedSegments {
+		fmt.Fprintf(&b, "\n  %s removed", segment)
+	}
+	return b.String()
+}
+
+// Replay calls fn for every entry after offset of the given segment, in the order they were written.
+// Segments before it are skipped, if it is empty replay starts with the first segment.
+// The first corrupted entry either truncates the log right before it, or, in skip mode,
+// only the rest of its page is skipped and replay continues with the next page.
+func (wal *WriteAheadLog) Replay(fromSegment string, offset uint64, fn func(e *entry.WALEntry, position Position) error) (*RecoveryReport, error) {
+	report := &RecoveryReport{Mode: wal.config.RecoveryMode}
+	pageSize := wal.pageManager.Config.PageSize
+
+	first := 0
+	found := fromSegment == ""
+	for i, segment := range wal.segments {
+		if segment == fromSegment {
+			first = i
+			found = true
+		}
+	}
+	if !found {
+		// segment was lost to truncation, entries of segments after it were not flushed
+		offset = INDEX
+		for first < len(wal.segments) && wal.segments[first] < fromSegment {
+			first++
+		}
+	}
+
+	for i := first; i < len(wal.segments); i++ {
+		segment := wal.segments[i]
+		filename := wal.SegmentFilename(uint64(i))
+
+		stat, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		fileSize := uint64(stat.Size())
+
+		var pageIndex uint64 = 0
+		if i == first && offset > INDEX {
+			pageIndex = (offset - INDEX) / pageSize
+		}
+
+		for pageOffset := INDEX + pageIndex*pageSize; pageOffset < fileSize; pageOffset += pageSize {
+			pageBytes, err := wal.pageManager.ReadPage(filename, int64(pageOffset))
+			if err != nil {
+				return nil, err
+			}
+
+			walPage, corruption := page.DeserializeWALPage(pageBytes)
+
+			entryEnd := pageOffset
+			for _, en := range walPage.GetEntries() {
+				entryEnd += en.Size()
+				if i == first && entryEnd <= offset {
+					// already flushed to disk
+					continue
+				}
+
+				err = fn(en.(*entry.WALEntry), Position{Segment: segment, Offset: entryEnd})
+				if err != nil {
+					return nil, err
+				}
+				report.Replayed++
+			}
+
+			if corruption == nil {
+				continue
+			}
+
+			if wal.config.RecoveryMode == RecoverySkip {
+				length := pageOffset + pageSize - entryEnd
+				report.Corruptions = append(report.Corruptions, Corruption{segment, entryEnd, length, corruption})
+				report.DiscardedBytes += length
+				continue
+			}
+
+			length := max(fileSize, pageOffset+pageSize) - entryEnd
+			report.Corruptions = append(report.Corruptions, Corruption{segment, entryEnd, length, corruption})
+			report.DiscardedBytes += length
+
+			err = wal.truncate(i, pageOffset, walPage, report)
+			if err != nil {
+				return nil, err
+			}
+			return report, nil
+		}
+	}
+
+	return report, nil
+}
+
+// truncate drops everything after valid entries of the page at pageOffset in the segment,
+// removing the following segments, and continues the log from that page
+func (wal *WriteAheadLog) truncate(segmentIndex int, pageOffset uint64, validPage *page.WALPage, report *RecoveryReport) error {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+
+	err := wal.closeActiveFile()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range wal.segments[segmentIndex+1:] {
+		filename := wal.config.LogsDirPath + "/" + segment
+		stat, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+
+		err = wal.pageManager.RemoveFile(filename)
+		if err != nil {
+			return err
+		}
+		report.RemovedSegments = append(report.RemovedSegments, segment)
+		report.DiscardedBytes += uint64(stat.Size())
+	}
+	wal.segments = wal.segments[:segmentIndex+1]
+
+	filename := wal.SegmentFilename(uint64(segmentIndex))
+	err = wal.pageManager.WritePage(validPage, filename, int64(pageOffset))
+	if err != nil {
+		return err
+	}
+	err = os.Truncate(filename, int64(pageOffset+wal.pageManager.Config.PageSize))
+	if err != nil {
+		return err
+	}
+
+	wal.activeSegment = wal.segments[segmentIndex]
+	err = wal.loadActivePage()
+	if err != nil {
+		return err
+	}
+	return wal.openActiveSegment()
+}
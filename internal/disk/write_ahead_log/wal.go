@@ -2,10 +2,14 @@ package write_ahead_log
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"time-series-engine/config"
 	"time-series-engine/internal"
 	"time-series-engine/internal/disk/entry"
@@ -14,13 +18,41 @@ import (
 
 const INDEX = 8
 
+// Sync modes decide when written pages are flushed to stable storage:
+// after every write, periodically in the background, or never by the log itself
+const (
+	SyncAlways   = config.SyncModeAlways
+	SyncInterval = config.SyncModeInterval
+	SyncNever    = config.SyncModeNever
+)
+
+// Recovery modes decide what happens to the log after a corrupted entry found by Replay
+const (
+	RecoveryTruncate = config.RecoveryModeTruncate
+	RecoverySkip     = config.RecoveryModeSkip
+)
+
+// WriteAheadLog appends are serialized internally, so it can be shared by goroutines.
+// Loading and replay must be done before it is used concurrently.
 type WriteAheadLog struct {
 	segments        []string
 	activeSegment   string
+	activeFile      *os.File
 	activePageIndex uint64
 	activePage      *page.WALPage
 	pageManager     *page.Manager
 	config          *config.WALConfig
+
+	// mu guards segments and active file against concurrent appends,
+	// segment deletion and the background syncer
+	mu       sync.Mutex
+	unsynced bool
+	syncErr  error // failed sync, returned by every write, Sync and Close until the log is reopened
+	stopSync chan struct{}
+	syncDone chan struct{}
+
+	// SyncFile flushes a segment file to stable storage, it can be replaced to inject failures
+	SyncFile func(*os.File) error
 }
 
 func NewWriteAheadLog(c *config.WALConfig, pm *page.Manager) *WriteAheadLog {
@@ -31,60 +63,232 @@ func NewWriteAheadLog(c *config.WALConfig, pm *page.Manager) *WriteAheadLog {
 		activePage:      nil,
 		pageManager:     pm,
 		config:          c,
+		SyncFile:        (*os.File).Sync,
 	}
 }
 
+// Position is the location right after an entry in the log
+type Position struct {
+	Segment string
+	Offset  uint64
+}
+
 func (wal *WriteAheadLog) Put(ts *internal.TimeSeries, p *internal.Point) (uint64, error) {
-	offsetBefore := wal.ActiveSegmentOffset()
+	positions, err := wal.PutBatch([]*internal.Sample{internal.NewSample(ts, p)})
+	if err != nil {
+		return 0, err
+	}
+	return positions[0].Offset, nil
+}
 
-	walEnt := entry.NewWALPutEntry(ts, p)
-	if walEnt.Size() > wal.activePage.PaddingSize() {
-		err := wal.changePage()
+// PutBatch appends entries for all samples, writing every touched page only once.
+// Returns position after each entry, in the order of samples.
+func (wal *WriteAheadLog) PutBatch(samples []*internal.Sample) ([]Position, error) {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+
+	err := wal.syncErr
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]Position, 0, len(samples))
+	dirty := false
+
+	for _, sample := range samples {
+		walEnt := entry.NewWALPutEntry(sample.TimeSeries, sample.Point)
+		if walEnt.Size() > wal.activePage.PaddingSize() {
+			if dirty {
+				err := wal.writeWalBlock()
+				if err != nil {
+					return nil, err
+				}
+			}
+			err := wal.changePage()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		wal.activePage.Add(walEnt)
+		dirty = true
+		positions = append(positions, Position{
+			Segment: wal.activeSegment,
+			Offset:  wal.ActiveSegmentOffset(),
+		})
+	}
+
+	if dirty {
+		err = wal.writeWalBlock()
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		offsetBefore = wal.ActiveSegmentOffset()
 	}
 
-	wal.activePage.Add(walEnt)
-	err := wal.writeWalBlock()
+	err = wal.commit()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	offsetAfter := offsetBefore + walEnt.Size()
-	return offsetAfter, nil
+	return positions, nil
 }
 
 func (wal *WriteAheadLog) Delete(ts *internal.TimeSeries, minTimestamp, maxTimestamp uint64) error {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+
+	err := wal.syncErr
+	if err != nil {
+		return err
+	}
+
 	walEnt := entry.NewWALDeleteEntry(ts, minTimestamp, maxTimestamp)
 	if walEnt.Size() > wal.activePage.PaddingSize() {
-		err := wal.changePage()
+		err = wal.changePage()
 		if err != nil {
 			return err
 		}
 	}
 	wal.activePage.Add(walEnt)
-	err := wal.writeWalBlock()
+	err = wal.writeWalBlock()
 	if err != nil {
 		return err
 	}
-	return nil
+	return wal.commit()
 }
 
 func (wal *WriteAheadLog) writeWalBlock() error {
-	filename := wal.config.LogsDirPath + "/" + wal.activeSegment
 	offset := INDEX + wal.activePageIndex*wal.pageManager.Config.PageSize
 
-	err := wal.pageManager.WritePage(wal.activePage, filename, int64(offset))
+	err := wal.pageManager.WritePageAt(wal.activePage, wal.activeFile, int64(offset))
 	if err != nil {
 		return err
 	}
+	wal.unsynced = true
 
 	return nil
 }
 
+// commit makes written pages durable according to the sync mode. With interval
+// mode all writes since the last tick are synced together by the background syncer.
+func (wal *WriteAheadLog) commit() error {
+	if wal.config.SyncMode != SyncAlways {
+		return nil
+	}
+	return wal.syncActive()
+}
+
+func (wal *WriteAheadLog) syncActive() error {
+	if wal.syncErr != nil {
+		return wal.syncErr
+	}
+	if !wal.unsynced || wal.activeFile == nil {
+		return nil
+	}
+	err := wal.SyncFile(wal.activeFile)
+	if err != nil {
+		// entries written since the last sync may be lost, so the log refuses writes until
+		// it is reopened
+		wal.syncErr = fmt.Errorf("failed to sync write ahead log segment %s: %w", wal.activeSegment, err)
+		return wal.syncErr
+	}
+	wal.unsynced = false
+	return nil
+}
+
+func (wal *WriteAheadLog) syncPeriodically() {
+	defer close(wal.syncDone)
+
+	ticker := time.NewTicker(time.Duration(wal.config.SyncInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wal.stopSync:
+			return
+		case <-ticker.C:
+			// a failed sync is kept and returned by the next call
+			wal.mu.Lock()
+			_ = wal.syncActive()
+			wal.mu.Unlock()
+		}
+	}
+}
+
+// Sync makes all written entries durable, whatever the sync mode is
+func (wal *WriteAheadLog) Sync() error {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+
+	return wal.syncActive()
+}
+
+// openActiveSegment closes the previous segment file, syncing it first unless
+// sync mode is never, and keeps the active one open for writing
+func (wal *WriteAheadLog) openActiveSegment() error {
+	err := wal.closeActiveFile()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(wal.config.LogsDirPath, wal.activeSegment), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	wal.activeFile = file
+	return nil
+}
+
+func (wal *WriteAheadLog) closeActiveFile() error {
+	if wal.activeFile == nil {
+		return wal.syncErr
+	}
+
+	err := wal.syncErr
+	if err == nil && wal.config.SyncMode != SyncNever {
+		err = wal.syncActive()
+	}
+	wal.unsynced = false
+
+	err = errors.Join(err, wal.activeFile.Close())
+	wal.activeFile = nil
+	return err
+}
+
+// Close stops the background syncer and closes the active segment
+func (wal *WriteAheadLog) Close() error {
+	if wal.stopSync != nil {
+		close(wal.stopSync)
+		<-wal.syncDone
+		wal.stopSync = nil
+	}
+
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+	return wal.closeActiveFile()
+}
+
+// LoadWal finds existing segments, or creates the first one, and opens the active segment
 func (wal *WriteAheadLog) LoadWal() error {
+	err := wal.loadSegments()
+	if err != nil {
+		return err
+	}
+
+	err = wal.openActiveSegment()
+	if err != nil {
+		return err
+	}
+
+	if wal.config.SyncMode == SyncInterval {
+		wal.stopSync = make(chan struct{})
+		wal.syncDone = make(chan struct{})
+		go wal.syncPeriodically()
+	}
+	return nil
+}
+
+func (wal *WriteAheadLog) loadSegments() error {
 	files, err := os.ReadDir(wal.config.LogsDirPath)
 	if err != nil {
 		return err
@@ -124,6 +328,12 @@ func (wal *WriteAheadLog) LoadWal() error {
 
 	insertionSort(&wal.segments)
 	wal.activeSegment = wal.segments[len(wal.segments)-1]
+
+	return wal.loadActivePage()
+}
+
+// loadActivePage reads the last page of the active segment, which new entries are appended to
+func (wal *WriteAheadLog) loadActivePage() error {
 	activeSegmentFilename := wal.config.LogsDirPath + "/" + wal.activeSegment
 
 	stat, err := os.Stat(activeSegmentFilename)
@@ -138,20 +348,21 @@ func (wal *WriteAheadLog) LoadWal() error {
 		return nil
 	}
 
-	offset := fileSize - int64(wal.pageManager.Config.PageSize)
-	wal.activePage = page.NewWALPage(wal.pageManager.Config.PageSize)
-	activePageBytes, err := wal.pageManager.ReadBytes(activeSegmentFilename, offset, int64(wal.pageManager.Config.PageSize))
+	// last page may be only partially written, its missing part reads as padding
+	pageSize := int64(wal.pageManager.Config.PageSize)
+	lastPageIndex := (fileSize - INDEX + pageSize - 1) / pageSize
+	if lastPageIndex != 0 {
+		lastPageIndex -= 1
+	}
 
-	wal.activePage, err = page.DeserializeWALPage(activePageBytes)
+	activePageBytes, err := wal.pageManager.ReadBytes(activeSegmentFilename, INDEX+lastPageIndex*pageSize, pageSize)
 	if err != nil {
 		return err
 	}
 
-	lastPageIndex := uint64(fileSize-INDEX) / wal.pageManager.Config.PageSize
-	if lastPageIndex != 0 {
-		lastPageIndex -= 1
-	}
-	wal.activePageIndex = lastPageIndex
+	// a corrupted tail is overwritten by the next write, replay reports it
+	wal.activePage, _ = page.DeserializeWALPage(activePageBytes)
+	wal.activePageIndex = uint64(lastPageIndex)
 
 	return nil
 }
@@ -173,13 +384,34 @@ func (wal *WriteAheadLog) createNewSegment() error {
 		return err
 	}
 
+	if wal.config.SyncMode != SyncNever {
+		err = syncDir(wal.config.LogsDirPath)
+		if err != nil {
+			return err
+		}
+	}
+
 	wal.segments = append(wal.segments, segment)
 	wal.activeSegment = segment
 	wal.activePage = page.NewWALPage(wal.pageManager.Config.PageSize)
 	wal.activePageIndex = 0
+
+	if wal.activeFile != nil {
+		return wal.openActiveSegment()
+	}
 	return nil
 }
 
+// syncDir makes creation of new files in the directory durable
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
 func (wal *WriteAheadLog) changePage() error {
 	newSegBool := false
 	if wal.IsFullSegment() {
@@ -198,7 +430,11 @@ func (wal *WriteAheadLog) changePage() error {
 	return nil
 }
 
+// DeleteWalSegments removes all segments before minSegment
 func (wal *WriteAheadLog) DeleteWalSegments(minSegment string) (uint64, error) {
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+
 	var deleted uint64 = 0
 	for _, segment := range wal.segments {
 		if segment >= minSegment {
@@ -206,11 +442,13 @@ func (wal *WriteAheadLog) DeleteWalSegments(minSegment string) (uint64, error) {
 		}
 		err := wal.pageManager.RemoveFile(wal.config.LogsDirPath + "/" + segment)
 		if err != nil {
+			wal.segments = wal.segments[deleted:]
 			return deleted, err
 		}
 		deleted++
 	}
 
+	wal.segments = wal.segments[deleted:]
 	return deleted, nil
 }
 
@@ -238,6 +476,10 @@ func (wal *WriteAheadLog) SetUnstagedOffset(offset uint64) {
 	wal.config.UnstagedOffset = offset
 }
 
+func (wal *WriteAheadLog) UnstagedSegment() string {
+	return wal.config.UnstagedSegment
+}
+
 func (wal *WriteAheadLog) LastSegmentIndex() uint64 {
 	parts := strings.Split(wal.activeSegment, "_")
 	if len(parts) != 2 {
@@ -0,0 +1,320 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time-series-engine/internal"
+)
+
+type set map[string]struct{}
+
+// Index is a catalog of known series, which assigns each of them a numeric ID, with an inverted
+// index from tags to hashes of series which have them. It is safe for concurrent use.
+// Only the list of series and their IDs is persisted, postings are built again when it is loaded.
+type Index struct {
+	mu           sync.RWMutex
+	path         string
+	series       map[string]*internal.TimeSeries // by hash
+	ids          map[string]uint64               // by hash
+	byID         map[uint64]*internal.TimeSeries
+	lastID       uint64
+	measurements map[string]set
+	postings     map[string]map[string]set // tag name -> tag value -> series hashes
+	changed      bool                      // since the last save
+}
+
+// New returns empty index persisted to path
+func New(path string) *Index {
+	return &Index{
+		path:         path,
+		series:       make(map[string]*internal.TimeSeries),
+		ids:          make(map[string]uint64),
+		byID:         make(map[uint64]*internal.TimeSeries),
+		measurements: make(map[string]set),
+		postings:     make(map[string]map[string]set),
+	}
+}
+
+// Load reads index saved to path, error satisfies errors.Is(err, fs.ErrNotExist) when there is none
+func Load(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := New(path)
+	if len(data) < 8 {
+		return nil, fmt.Errorf("corrupted series index %s: %w", path, io.ErrUnexpectedEOF)
+	}
+	count := binary.BigEndian.Uint64(data)
+	offset := 8
+
+	for i := uint64(0); i < count; i++ {
+		if len(data) < offset+8 {
+			return nil, fmt.Errorf("corrupted series index %s: %w", path, io.ErrUnexpectedEOF)
+		}
+		id := binary.BigEndian.Uint64(data[offset:])
+		offset += 8
+
+		ts, n, err := deserializeSeries(data[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("corrupted series index %s: %w", path, err)
+		}
+		offset += n
+		idx.add(ts, id)
+	}
+
+	return idx, nil
+}
+
+// Add indexes a copy of the series with the next free ID, if it is not already indexed,
+// so callers may keep changing their series and tags
+func (idx *Index) Add(ts *internal.TimeSeries) {
+	idx.mu.RLock()
+	_, exists := idx.series[ts.Hash]
+	idx.mu.RUnlock()
+	if exists {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, exists = idx.series[ts.Hash]; !exists {
+		idx.add(internal.NewTimeSeries(ts.MeasurementName, ts.Tags.Copy()), idx.lastID+1)
+		idx.changed = true
+	}
+}
+
+func (idx *Index) add(ts *internal.TimeSeries, id uint64) {
+	idx.series[ts.Hash] = ts
+	idx.ids[ts.Hash] = id
+	idx.byID[id] = ts
+	idx.lastID = max(idx.lastID, id)
+
+	hashes, ok := idx.measurements[ts.MeasurementName]
+	if !ok {
+		hashes = make(set)
+		idx.measurements[ts.MeasurementName] = hashes
+	}
+	hashes[ts.Hash] = struct{}{}
+
+	for _, tag := range ts.Tags {
+		values, ok := idx.postings[tag.Name]
+		if !ok {
+			values = make(map[string]set)
+			idx.postings[tag.Name] = values
+		}
+		hashes, ok = values[tag.Value]
+		if !ok {
+			hashes = make(set)
+			values[tag.Value] = hashes
+		}
+		hashes[ts.Hash] = struct{}{}
+	}
+}
+
+// Len returns number of indexed series
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.series)
+}
+
+// ID returns ID of the series with the hash, false if it is unknown
+func (idx *Index) ID(hash string) (uint64, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	id, ok := idx.ids[hash]
+	return id, ok
+}
+
+// ByID returns series with the ID, false if there is none
+func (idx *Index) ByID(id uint64) (*internal.TimeSeries, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ts, ok := idx.byID[id]
+	return ts, ok
+}
+
+// Measurements returns names of all measurements, sorted
+func (idx *Index) Measurements() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	result := make([]string, 0, len(idx.measurements))
+	for measurement := range idx.measurements {
+		result = append(result, measurement)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// TagKeys returns names of tags of the measurement's series, sorted
+func (idx *Index) TagKeys(measurement string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	keys := make(set)
+	for hash := range idx.measurements[measurement] {
+		for _, tag := range idx.series[hash].Tags {
+			keys[tag.Name] = struct{}{}
+		}
+	}
+	return sorted(keys)
+}
+
+// TagValues returns values of the tag among the measurement's series, sorted
+func (idx *Index) TagValues(measurement string, key string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	values := make(set)
+	for value, hashes := range idx.postings[key] {
+		for hash := range hashes {
+			if idx.series[hash].MeasurementName == measurement {
+				values[value] = struct{}{}
+				break
+			}
+		}
+	}
+	return sorted(values)
+}
+
+func sorted(s set) []string {
+	result := make([]string, 0, len(s))
+	for value := range s {
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Select returns series of the measurement selected by all matchers, sorted by hash
+func (idx *Index) Select(measurement string, matchers ...*Matcher) []*internal.TimeSeries {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	candidates := make(set)
+	for hash := range idx.measurements[measurement] {
+		candidates[hash] = struct{}{}
+	}
+
+	for _, m := range matchers {
+		values := idx.postings[m.Name]
+
+		if m.Matches("") {
+			// series without the tag are selected, so remove only those with a rejected value
+			for value, hashes := range values {
+				if m.Matches(value) {
+					continue
+				}
+				for hash := range hashes {
+					delete(candidates, hash)
+				}
+			}
+			continue
+		}
+
+		selected := make(set)
+		for value, hashes := range values {
+			if !m.Matches(value) {
+				continue
+			}
+			for hash := range hashes {
+				if _, ok := candidates[hash]; ok {
+					selected[hash] = struct{}{}
+				}
+			}
+		}
+		candidates = selected
+	}
+
+	result := make([]*internal.TimeSeries, 0, len(candidates))
+	for hash := range candidates {
+		result = append(result, idx.series[hash])
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Hash < result[j].Hash
+	})
+	return result
+}
+
+// Save writes the index to its file if it changed since it was loaded or saved last time.
+// File is replaced atomically, so a crash leaves either the old or the new index.
+func (idx *Index) Save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.changed {
+		return nil
+	}
+
+	data := binary.BigEndian.AppendUint64(nil, uint64(len(idx.series)))
+	for hash, ts := range idx.series {
+		data = binary.BigEndian.AppendUint64(data, idx.ids[hash])
+		data = append(data, serializeSeries(ts)...)
+	}
+
+	tmpPath := idx.path + ".tmp"
+	err := writeSynced(tmpPath, data)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, idx.path)
+	if err != nil {
+		return err
+	}
+
+	idx.changed = false
+	return nil
+}
+
+// writeSynced writes data to the file and syncs it, so it is complete on disk before it is renamed
+func writeSynced(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	return errors.Join(err, file.Close())
+}
+
+func serializeSeries(ts *internal.TimeSeries) []byte {
+	data := binary.BigEndian.AppendUint64(nil, uint64(len(ts.MeasurementName)))
+	data = append(data, ts.MeasurementName...)
+	data = binary.BigEndian.AppendUint64(data, uint64(ts.Tags.Len()))
+	return append(data, ts.Tags.Serialize()...)
+}
+
+func deserializeSeries(data []byte) (*internal.TimeSeries, int, error) {
+	// name size and number of tags
+	if len(data) < 16 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	nameSize := binary.BigEndian.Uint64(data)
+	offset := 8
+	if nameSize > uint64(len(data)-16) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	name := string(data[offset : offset+int(nameSize)])
+	offset += int(nameSize)
+
+	numTags := binary.BigEndian.Uint64(data[offset:])
+	offset += 8
+
+	tags, n, err := internal.DeserializeTags(data[offset:], numTags)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += n
+
+	return internal.NewTimeSeries(name, tags), offset, nil
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matcher operators:
+const (
+	Equal    = "="
+	NotEqual = "!="
+	Regex    = "=~"
+)
+
+// Matcher selects series by value of one tag. Series without the tag are
+// treated as if its value was empty, so host!=a also selects series with no host.
+type Matcher struct {
+	Name     string
+	Operator string
+	Value    string
+	re       *regexp.Regexp
+}
+
+// NewMatcher returns matcher for the operator, regular expressions have to match the whole value
+func NewMatcher(name, operator, value string) (*Matcher, error) {
+	m := &Matcher{
+		Name:     name,
+		Operator: operator,
+		Value:    value,
+	}
+
+	switch operator {
+	case Equal, NotEqual:
+	case Regex:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression for tag %s: %w", name, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("unknown tag matcher operator: %q", operator)
+	}
+
+	return m, nil
+}
+
+// ParseMatcher parses matcher written as name=value, name!=value or name=~regex
+func ParseMatcher(s string) (*Matcher, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid tag matcher: %q", s)
+	}
+
+	name, operator, value := s[:i], Equal, s[i+1:]
+	if strings.HasSuffix(name, "!") {
+		name, operator = name[:len(name)-1], NotEqual
+	} else if strings.HasPrefix(value, "~") {
+		operator, value = Regex, value[1:]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid tag matcher: %q", s)
+	}
+
+	return NewMatcher(name, operator, value)
+}
+
+// Matches reports whether value of the tag is selected, empty for series without the tag
+func (m *Matcher) Matches(value string) bool {
+	switch m.Operator {
+	case Equal:
+		return value == m.Value
+	case NotEqual:
+		return value != m.Value
+	case Regex:
+		return m.re.MatchString(value)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return m.Name + m.Operator + m.Value
+}
@@ -0,0 +1,33 @@
+package line_protocol
+
+import (
+	"strconv"
+	"strings"
+	"time-series-engine/internal"
+)
+
+var escaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `)
+
+// FormatLine writes the point of the time series as a line, which is parsed back into the same
+// series and point. Timestamp is written as it is, in the precision the line will be read in.
+func FormatLine(ts *internal.TimeSeries, p *internal.Point) string {
+	field := ValueField
+
+	var b strings.Builder
+	b.WriteString(escaper.Replace(ts.MeasurementName))
+	for _, tag := range ts.Tags {
+		if tag.Name == FieldTag {
+			field = tag.Value
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(escaper.Replace(tag.Name))
+		b.WriteByte('=')
+		b.WriteString(escaper.Replace(tag.Value))
+	}
+	b.WriteString(" " + escaper.Replace(field) + "=")
+	b.WriteString(strconv.FormatFloat(p.Value, 'g', -1, 64))
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatUint(p.Timestamp, 10))
+	return b.String()
+}
@@ -0,0 +1,310 @@
+package line_protocol
+
+/*
+	Parser of InfluxDB line protocol:
+
+		measurement[,tag=value...] field=value[,field=value...] [timestamp]
+
+	Measurement and tag set become the time series, and every numeric field
+	becomes one point of its own series. A field named "value" is stored under
+	the measurement and tags as written, any other field additionally gets its
+	name as the "_field" tag. String and boolean fields are ignored.
+
+	Commas, spaces and equal signs in names and tag values can be escaped with
+	a backslash. Lines that are empty or start with '#' are skipped.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time-series-engine/internal"
+)
+
+const ValueField = "value"
+
+// FieldTag holds the name of fields other than ValueField, so lines can't use it as a tag
+const FieldTag = "_field"
+
+type Parser struct {
+	scanner   *bufio.Scanner
+	line      uint64
+	input     internal.Precision
+	target    internal.Precision
+	remaining []*internal.Sample
+}
+
+// NewParser parses lines from r, whose timestamps are in input precision,
+// into samples with timestamps in target precision
+func NewParser(r io.Reader, input, target internal.Precision) *Parser {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	return &Parser{
+		scanner: scanner,
+		input:   input,
+		target:  target,
+	}
+}
+
+// NextBatch returns up to size samples, or io.EOF once the input is exhausted
+func (p *Parser) NextBatch(size int) ([]*internal.Sample, error) {
+	batch := make([]*internal.Sample, 0, size)
+
+	for len(batch) < size {
+		if len(p.remaining) > 0 {
+			n := min(size-len(batch), len(p.remaining))
+			batch = append(batch, p.remaining[:n]...)
+			p.remaining = p.remaining[n:]
+			continue
+		}
+
+		if !p.scanner.Scan() {
+			if err := p.scanner.Err(); err != nil {
+				return nil, fmt.Errorf("line %d: %w", p.line+1, err)
+			}
+			break
+		}
+		p.line++
+
+		samples, err := ParseLine(p.scanner.Text(), p.input, p.target)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+		p.remaining = samples
+	}
+
+	if len(batch) == 0 {
+		return nil, io.EOF
+	}
+	return batch, nil
+}
+
+// ParseLine parses a single line. Empty lines and comments produce no samples.
+func ParseLine(line string, input, target internal.Precision) ([]*internal.Sample, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	sections, err := splitSections(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(sections) < 2 {
+		return nil, errors.New("missing field set")
+	}
+	if len(sections) > 3 {
+		return nil, errors.New("unexpected text after timestamp")
+	}
+
+	measurement, tags, err := parseSeriesKey(sections[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var timestamp uint64
+	if len(sections) == 3 {
+		parsed, err := strconv.ParseUint(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		timestamp = target.Convert(parsed, input)
+	} else {
+		timestamp = target.Now()
+	}
+
+	fields, err := splitUnescaped(sections[1], ',', true)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]*internal.Sample, 0, len(fields))
+	for _, field := range fields {
+		key, value, err := splitKeyValue(field, true)
+		if err != nil {
+			return nil, err
+		}
+
+		number, ok, err := parseFieldValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", key, err)
+		}
+		if !ok {
+			continue
+		}
+
+		// every point gets its own copy of tags, since time series sort them in place
+		samples = append(samples, internal.NewSample(
+			internal.NewTimeSeries(measurement, fieldTags(tags, key)),
+			internal.NewPointAt(number, timestamp),
+		))
+	}
+
+	return samples, nil
+}
+
+// fieldTags returns a copy of tags, with the field name appended for fields other than ValueField
+func fieldTags(tags internal.Tags, field string) internal.Tags {
+	copied := copyTags(tags)
+	if field != ValueField {
+		copied = append(copied, internal.NewTag(FieldTag, field))
+	}
+	return copied
+}
+
+func parseSeriesKey(key string) (string, internal.Tags, error) {
+	parts, err := splitUnescaped(key, ',', false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	measurement := unescape(parts[0])
+	if measurement == "" {
+		return "", nil, errors.New("missing measurement name")
+	}
+
+	tags := internal.NewTags()
+	for _, part := range parts[1:] {
+		name, value, err := splitKeyValue(part, false)
+		if err != nil {
+			return "", nil, err
+		}
+		if name == FieldTag {
+			return "", nil, fmt.Errorf("tag %q is reserved for field names", FieldTag)
+		}
+		tags = append(tags, internal.NewTag(name, unescape(value)))
+	}
+
+	return measurement, tags, nil
+}
+
+// parseFieldValue returns false for non numeric fields, which are skipped
+func parseFieldValue(value string) (float64, bool, error) {
+	if value == "" {
+		return 0, false, errors.New("missing value")
+	}
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return 0, false, nil
+	case value == "t" || value == "T" || value == "true" || value == "True" || value == "TRUE",
+		value == "f" || value == "F" || value == "false" || value == "False" || value == "FALSE":
+		return 0, false, nil
+	case strings.HasSuffix(value, "i"):
+		n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid integer %q", value)
+		}
+		return float64(n), true, nil
+	case strings.HasSuffix(value, "u"):
+		n, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		return float64(n), true, nil
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid float %q", value)
+	}
+	return n, true, nil
+}
+
+func splitKeyValue(s string, quoted bool) (string, string, error) {
+	parts, err := splitUnescaped(s, '=', quoted)
+	if err != nil {
+		return "", "", err
+	}
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid key=value pair %q", s)
+	}
+	return unescape(parts[0]), parts[1], nil
+}
+
+// splitSections splits line on unescaped spaces. Only field values can be quoted strings,
+// so quotes are honored only in the field set.
+func splitSections(line string) ([]string, error) {
+	sections := make([]string, 0, 3)
+	for line != "" {
+		end, err := sectionEnd(line, len(sections) == 1)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, line[:end])
+		line = strings.TrimLeft(line[end:], " ")
+	}
+	return sections, nil
+}
+
+// sectionEnd returns index of the first unescaped space in s, outside of
+// double quoted strings if quoted is set
+func sectionEnd(s string, quoted bool) (int, error) {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == ' ' && !inQuotes:
+			return i, nil
+		}
+	}
+	if inQuotes {
+		return 0, errors.New("unterminated string")
+	}
+	return len(s), nil
+}
+
+// splitUnescaped splits s on sep, ignoring separators escaped with a backslash
+// and, if quoted is set, separators inside double quoted strings
+func splitUnescaped(s string, sep byte, quoted bool) ([]string, error) {
+	parts := make([]string, 0)
+	inQuotes := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated string")
+	}
+
+	return append(parts, s[start:]), nil
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func copyTags(tags internal.Tags) internal.Tags {
+	copied := make(internal.Tags, 0, len(tags))
+	for _, tag := range tags {
+		copied = append(copied, internal.NewTag(tag.Name, tag.Value))
+	}
+	return copied
+}
@@ -3,6 +3,7 @@ package buffer_pool
 import (
 	"fmt"
 	"strings"
+	"sync"
 )
 
 type PageKey struct {
@@ -10,7 +11,9 @@ type PageKey struct {
 	Offset   int64
 }
 
+// BufferPool is an LRU cache of pages, safe for concurrent use
 type BufferPool struct {
+	mu         sync.Mutex
 	capacity   uint64
 	hashMap    map[PageKey]*DLLNode
 	doublyList DLL
@@ -25,6 +28,9 @@ func NewBufferPool(c uint64) *BufferPool {
 }
 
 func (bp *BufferPool) Get(path string, offset int64) []byte {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	key := PageKey{Filename: path, Offset: offset}
 	n, ok := bp.hashMap[key]
 	if !ok {
@@ -36,6 +42,9 @@ func (bp *BufferPool) Get(path string, offset int64) []byte {
 }
 
 func (bp *BufferPool) Put(p []byte, filename string, offset int64) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	pk := PageKey{Filename: filename, Offset: offset}
 	if n, ok := bp.hashMap[pk]; ok {
 		n.page = p
@@ -51,6 +60,7 @@ func (bp *BufferPool) Put(p []byte, filename string, offset int64) {
 	}
 
 	bp.doublyList.Put(p)
+	bp.doublyList.tail.pageKey = pk
 	bp.hashMap[pk] = bp.doublyList.tail
 }
 
@@ -59,6 +69,9 @@ func (bp *BufferPool) IsFull() bool {
 }
 
 func (bp *BufferPool) Remove(filename string) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	for key, node := range bp.hashMap {
 		if strings.HasPrefix(key.Filename, filename) {
 			bp.doublyList.DeleteNode(node)
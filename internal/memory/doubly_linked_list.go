@@ -56,14 +56,26 @@ func (dll *DoublyLinkedList) LastPoint() (*internal.Point, error) {
 	return dll.Trailer.Prev.Point, nil
 }
 
-func (dll *DoublyLinkedList) Insert(point *internal.Point) {
-	lastNode := dll.Trailer.Prev
+// Insert keeps the list sorted by timestamp. Points usually arrive in order,
+// so the position is searched for from the end of the list. A point with a timestamp
+// already in the list replaces the old one, in which case false is returned.
+func (dll *DoublyLinkedList) Insert(point *internal.Point) bool {
+	prevNode := dll.Trailer.Prev
+	for prevNode != dll.Header && prevNode.Point.Timestamp > point.Timestamp {
+		prevNode = prevNode.Prev
+	}
+	if prevNode != dll.Header && prevNode.Point.Timestamp == point.Timestamp {
+		prevNode.Point = point
+		return false
+	}
+	nextNode := prevNode.Next
 
-	nodeToAdd := newNode(point, lastNode, dll.Trailer)
-	lastNode.Next = nodeToAdd
-	dll.Trailer.Prev = nodeToAdd
+	nodeToAdd := newNode(point, prevNode, nextNode)
+	prevNode.Next = nodeToAdd
+	nextNode.Prev = nodeToAdd
 
 	dll.Size += 1
+	return true
 }
 func (dll *DoublyLinkedList) DeleteRange(minTimestamp, maxTimestamp uint64) uint64 {
 	// Finding node that is at beginning of range [minTimestamp, maxTimestamp]:
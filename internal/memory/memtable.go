@@ -2,9 +2,11 @@ package memory
 
 import (
 	"fmt"
+	"math"
 	"time-series-engine/internal"
 )
 
+// MemTable is not safe for concurrent use, engine guards it with its own lock
 type MemTable struct {
 	Data            map[string]*DoublyLinkedList
 	Count           uint64
@@ -22,34 +24,47 @@ func NewMemTable(maxSize uint64) *MemTable {
 }
 
 func (mt *MemTable) WritePointWithFlush(timeSeries *internal.TimeSeries, point *internal.Point) map[string][]*internal.Point {
+	mt.WritePoint(timeSeries, point)
+
+	if mt.IsFull() {
+		return mt.FlushAllTimeSeries()
+	}
+	return nil
+}
+
+// WritePoint inserts point, leaving it to the caller to flush the memtable once it is full.
+// The last point written with a timestamp wins, so the memtable never holds duplicates.
+func (mt *MemTable) WritePoint(timeSeries *internal.TimeSeries, point *internal.Point) {
 	storage, exists := mt.Data[timeSeries.Hash]
 	if !exists {
 		mt.Data[timeSeries.Hash] = NewDoublyLinkedList()
 		storage = mt.Data[timeSeries.Hash]
 	}
 
-	storage.Insert(point)
-	mt.Count += 1
-
-	if mt.IsFull() {
-		return mt.FlushAllTimeSeries()
+	if storage.Insert(point) {
+		mt.Count += 1
 	}
-	return nil
 }
 
 func (mt *MemTable) IsFull() bool {
-	return mt.Count == mt.MaxSize
+	return mt.Count >= mt.MaxSize
 }
 
 func (mt *MemTable) FlushAllTimeSeries() map[string][]*internal.Point {
+	allTimeSeries := mt.AllTimeSeries()
+	mt.Count = 0
+	mt.Data = make(map[string]*DoublyLinkedList)
+
+	return allTimeSeries
+}
+
+// AllTimeSeries returns sorted points of every time series, leaving the memtable unchanged
+func (mt *MemTable) AllTimeSeries() map[string][]*internal.Point {
 	allTimeSeries := make(map[string][]*internal.Point)
 
 	for tsHash, storage := range mt.Data {
 		allTimeSeries[tsHash] = storage.GetSortedPoints()
 	}
-	mt.Count = 0
-	mt.Data = make(map[string]*DoublyLinkedList)
-
 	return allTimeSeries
 }
 
@@ -63,7 +78,7 @@ func (mt *MemTable) DeleteRange(timeSeries *internal.TimeSeries, minTimestamp, m
 
 func (mt *MemTable) DeleteExpired(minTimestamp, maxTimestamp uint64) {
 	for _, storage := range mt.Data {
-		storage.DeleteRange(minTimestamp, maxTimestamp)
+		mt.Count -= storage.DeleteRange(minTimestamp, maxTimestamp)
 	}
 }
 
@@ -93,9 +108,17 @@ func (mt *MemTable) Aggregate(
 
 	switch function {
 	case "Min":
-		return points[0].Value, 0, true
+		result := points[0].Value
+		for _, point := range points {
+			result = math.Min(result, point.Value)
+		}
+		return result, 0, true
 	case "Max":
-		return points[len(points)-1].Value, 0, true
+		result := points[0].Value
+		for _, point := range points {
+			result = math.Max(result, point.Value)
+		}
+		return result, 0, true
 	case "Average":
 		for _, point := range points {
 			sum += point.Value
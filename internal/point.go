@@ -2,7 +2,6 @@ package internal
 
 import (
 	"fmt"
-	"time"
 )
 
 type Point struct {
@@ -10,15 +9,20 @@ type Point struct {
 	Value     float64
 }
 
-func NewPoint(value float64) *Point {
+// NewPoint creates point stamped with the current time in the precision of the engine
+func NewPoint(value float64, precision Precision) *Point {
 	return &Point{
-		Timestamp: calculateTimestamp(),
+		Timestamp: precision.Now(),
 		Value:     value,
 	}
 }
 
-func calculateTimestamp() uint64 {
-	return uint64(time.Now().Unix())
+// NewPointAt creates point with a timestamp supplied by the client, which may be in the past
+func NewPointAt(value float64, timestamp uint64) *Point {
+	return &Point{
+		Timestamp: timestamp,
+		Value:     value,
+	}
 }
 
 func (p *Point) String() string {
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// Precision is the unit of point timestamps, counted from the Unix epoch
+type Precision string
+
+const (
+	Seconds      Precision = "s"
+	Milliseconds Precision = "ms"
+	Microseconds Precision = "us"
+	Nanoseconds  Precision = "ns"
+)
+
+func ParsePrecision(name string) (Precision, error) {
+	switch name {
+	case "s":
+		return Seconds, nil
+	case "ms":
+		return Milliseconds, nil
+	case "us", "µs":
+		return Microseconds, nil
+	case "ns":
+		return Nanoseconds, nil
+	}
+	return "", fmt.Errorf("unknown timestamp precision: %q", name)
+}
+
+// PerSecond returns number of timestamp units in one second
+func (p Precision) PerSecond() uint64 {
+	switch p {
+	case Milliseconds:
+		return 1_000
+	case Microseconds:
+		return 1_000_000
+	case Nanoseconds:
+		return 1_000_000_000
+	}
+	return 1
+}
+
+// FromTime converts t to a timestamp of this precision
+func (p Precision) FromTime(t time.Time) uint64 {
+	return uint64(t.UnixNano()) / (1_000_000_000 / p.PerSecond())
+}
+
+// ToTime converts timestamp of this precision to time
+func (p Precision) ToTime(timestamp uint64) time.Time {
+	return time.Unix(0, int64(timestamp*(1_000_000_000/p.PerSecond())))
+}
+
+// Now returns the current timestamp in this precision
+func (p Precision) Now() uint64 {
+	return p.FromTime(time.Now())
+}
+
+// Code returns single byte identifier of the precision, used when it is persisted
+func (p Precision) Code() uint8 {
+	switch p {
+	case Milliseconds:
+		return 1
+	case Microseconds:
+		return 2
+	case Nanoseconds:
+		return 3
+	}
+	return 0
+}
+
+func PrecisionFromCode(code uint8) (Precision, error) {
+	switch code {
+	case 0:
+		return Seconds, nil
+	case 1:
+		return Milliseconds, nil
+	case 2:
+		return Microseconds, nil
+	case 3:
+		return Nanoseconds, nil
+	}
+	return "", fmt.Errorf("unknown timestamp precision code: %d", code)
+}
+
+// Convert converts timestamp of precision from to precision p, truncating if p is coarser
+func (p Precision) Convert(timestamp uint64, from Precision) uint64 {
+	if from.PerSecond() > p.PerSecond() {
+		return timestamp / (from.PerSecond() / p.PerSecond())
+	}
+	return timestamp * (p.PerSecond() / from.PerSecond())
+}
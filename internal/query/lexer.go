@@ -0,0 +1,215 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenDuration
+	tokenEqual
+	tokenNotEqual
+	tokenRegex
+	tokenLess
+	tokenLessEqual
+	tokenGreater
+	tokenGreaterEqual
+	tokenPlus
+	tokenMinus
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+var tokenNames = map[tokenType]string{
+	tokenEOF:          "end of query",
+	tokenIdent:        "identifier",
+	tokenString:       "string",
+	tokenNumber:       "number",
+	tokenDuration:     "duration",
+	tokenEqual:        "'='",
+	tokenNotEqual:     "'!='",
+	tokenRegex:        "'=~'",
+	tokenLess:         "'<'",
+	tokenLessEqual:    "'<='",
+	tokenGreater:      "'>'",
+	tokenGreaterEqual: "'>='",
+	tokenPlus:         "'+'",
+	tokenMinus:        "'-'",
+	tokenLeftParen:    "'('",
+	tokenRightParen:   "')'",
+	tokenComma:        "','",
+}
+
+func (t tokenType) String() string {
+	return tokenNames[t]
+}
+
+type token struct {
+	typ  tokenType
+	text string // unquoted text of identifiers and strings, literal text of the rest
+	pos  int    // byte offset in the query
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return t.typ.String()
+	case tokenString:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// isKeyword reports whether the token is the keyword, which are case insensitive
+func (t token) isKeyword(keyword string) bool {
+	return t.typ == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+// durationUnits are suffixes of durations, longest first so that "ms" is not read as "m"
+var durationUnits = []string{"ns", "us", "µs", "ms", "s", "m", "h", "d", "w"}
+
+// lex splits the query into tokens, ending with tokenEOF
+func lex(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	pos := 0
+
+	for pos < len(input) {
+		r, size := utf8.DecodeRuneInString(input[pos:])
+		if unicode.IsSpace(r) {
+			pos += size
+			continue
+		}
+
+		start := pos
+		switch {
+		case r == '\'' || r == '"':
+			text, end, err := lexQuoted(input, pos)
+			if err != nil {
+				return nil, err
+			}
+			// double quotes are used for identifiers with unusual characters, single ones for strings
+			typ := tokenString
+			if r == '"' {
+				typ = tokenIdent
+			}
+			tokens = append(tokens, token{typ: typ, text: text, pos: start})
+			pos = end
+		case isIdentStart(r):
+			for pos < len(input) {
+				r, size = utf8.DecodeRuneInString(input[pos:])
+				if !isIdentPart(r) {
+					break
+				}
+				pos += size
+			}
+			tokens = append(tokens, token{typ: tokenIdent, text: input[start:pos], pos: start})
+		case r >= '0' && r <= '9':
+			typ, end := lexNumber(input, pos)
+			tokens = append(tokens, token{typ: typ, text: input[start:end], pos: start})
+			pos = end
+		default:
+			typ, size, ok := lexOperator(input[pos:])
+			if !ok {
+				return nil, &Error{Pos: pos, Message: fmt.Sprintf("unexpected character %q", r)}
+			}
+			tokens = append(tokens, token{typ: typ, text: input[pos : pos+size], pos: start})
+			pos += size
+		}
+	}
+
+	return append(tokens, token{typ: tokenEOF, pos: len(input)}), nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lexQuoted reads a string quoted with the character at pos, in which the quote and
+// the backslash can be escaped with a backslash
+func lexQuoted(input string, pos int) (string, int, error) {
+	quote := input[pos]
+	var text strings.Builder
+	for i := pos + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 < len(input) && (input[i+1] == quote || input[i+1] == '\\') {
+				i++
+			}
+			text.WriteByte(input[i])
+		case quote:
+			return text.String(), i + 1, nil
+		default:
+			text.WriteByte(input[i])
+		}
+	}
+	return "", 0, &Error{Pos: pos, Message: "unterminated string"}
+}
+
+// lexNumber reads an integer, a decimal number, or a duration such as 90s or 1h
+func lexNumber(input string, pos int) (tokenType, int) {
+	end := pos
+	for end < len(input) && input[end] >= '0' && input[end] <= '9' {
+		end++
+	}
+	if end+1 < len(input) && input[end] == '.' && input[end+1] >= '0' && input[end+1] <= '9' {
+		end++
+		for end < len(input) && input[end] >= '0' && input[end] <= '9' {
+			end++
+		}
+		return tokenNumber, end
+	}
+
+	for _, unit := range durationUnits {
+		if !strings.HasPrefix(input[end:], unit) {
+			continue
+		}
+		// the unit has to end the token, "5min" is not a duration
+		after, _ := utf8.DecodeRuneInString(input[end+len(unit):])
+		if isIdentPart(after) {
+			continue
+		}
+		return tokenDuration, end + len(unit)
+	}
+	return tokenNumber, end
+}
+
+func lexOperator(input string) (tokenType, int, bool) {
+	twoChar := map[string]tokenType{
+		"!=": tokenNotEqual,
+		"=~": tokenRegex,
+		"<=": tokenLessEqual,
+		">=": tokenGreaterEqual,
+		"<>": tokenNotEqual,
+	}
+	if len(input) >= 2 {
+		if typ, ok := twoChar[input[:2]]; ok {
+			return typ, 2, true
+		}
+	}
+
+	oneChar := map[byte]tokenType{
+		'=': tokenEqual,
+		'<': tokenLess,
+		'>': tokenGreater,
+		'+': tokenPlus,
+		'-': tokenMinus,
+		'(': tokenLeftParen,
+		')': tokenRightParen,
+		',': tokenComma,
+	}
+	typ, ok := oneChar[input[0]]
+	return typ, 1, ok
+}
@@ -0,0 +1,391 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"time-series-engine/internal/index"
+)
+
+// functions maps names of aggregation functions in queries to those of the engine
+var functions = map[string]string{
+	"min":     "Min",
+	"max":     "Max",
+	"mean":    "Mean",
+	"avg":     "Average",
+	"average": "Average",
+	"sum":     "Sum",
+	"count":   "Count",
+	"first":   "First",
+	"last":    "Last",
+	"spread":  "Spread",
+	"stddev":  "Stddev",
+	"median":  "Median",
+}
+
+var fillModes = []string{"none", "null", "previous", "linear"}
+
+var durationUnitLengths = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+type parser struct {
+	tokens  []token
+	current int
+}
+
+// Parse parses a statement, returning *Error on syntax errors
+func Parse(input string) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	return p.parseQuery()
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.current]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.current]
+	if t.typ != tokenEOF {
+		p.current++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &Error{Pos: t.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expect(typ tokenType) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		return t, p.errorf(t, "expected %s, found %s", typ, t)
+	}
+	return t, nil
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	t := p.next()
+	if !t.isKeyword(keyword) {
+		return p.errorf(t, "expected %s, found %s", keyword, t)
+	}
+	return nil
+}
+
+// acceptKeyword consumes the next token if it is the keyword
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.peek().isKeyword(keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	q := &Query{}
+
+	err := p.expectKeyword("SELECT")
+	if err != nil {
+		return nil, err
+	}
+	q.Function, err = p.parseField()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expectKeyword("FROM")
+	if err != nil {
+		return nil, err
+	}
+	measurement, err := p.expect(tokenIdent)
+	if err != nil {
+		return nil, err
+	}
+	q.Measurement = measurement.text
+
+	if p.acceptKeyword("WHERE") {
+		err = p.parseConditions(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if group := p.peek(); p.acceptKeyword("GROUP") {
+		if q.Function == "" {
+			return nil, p.errorf(group, "GROUP BY requires an aggregation function")
+		}
+		err = p.expectKeyword("BY")
+		if err != nil {
+			return nil, err
+		}
+		err = p.parseDimensions(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek().isKeyword("FILL") {
+		err = p.parseFill(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return q, nil
+}
+
+// parseField returns the aggregation function, empty for raw values
+func (p *parser) parseField() (string, error) {
+	name, err := p.expect(tokenIdent)
+	if err != nil {
+		return "", err
+	}
+	if p.peek().typ != tokenLeftParen {
+		if !strings.EqualFold(name.text, "value") {
+			return "", p.errorf(name, "unknown field %s, only value can be selected", name)
+		}
+		return "", nil
+	}
+
+	function, known := functions[strings.ToLower(name.text)]
+	isPercentile := strings.EqualFold(name.text, "percentile")
+	if !known && !isPercentile {
+		return "", p.errorf(name, "unknown function %s", name)
+	}
+
+	p.next()
+	field, err := p.expect(tokenIdent)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(field.text, "value") {
+		return "", p.errorf(field, "unknown field %s, only value can be aggregated", field)
+	}
+
+	if isPercentile {
+		_, err = p.expect(tokenComma)
+		if err != nil {
+			return "", err
+		}
+		n, err := p.expect(tokenNumber)
+		if err != nil {
+			return "", err
+		}
+		percentile, err := strconv.ParseFloat(n.text, 64)
+		if err != nil || percentile > 100 {
+			return "", p.errorf(n, "percentile has to be between 0 and 100, found %s", n.text)
+		}
+		function = "P" + strconv.FormatFloat(percentile, 'f', -1, 64)
+	}
+
+	_, err = p.expect(tokenRightParen)
+	if err != nil {
+		return "", err
+	}
+	return function, nil
+}
+
+func (p *parser) parseConditions(q *Query) error {
+	for {
+		name, err := p.expect(tokenIdent)
+		if err != nil {
+			return err
+		}
+
+		if strings.EqualFold(name.text, "time") {
+			condition, err := p.parseTimeCondition()
+			if err != nil {
+				return err
+			}
+			q.TimeConditions = append(q.TimeConditions, condition)
+		} else {
+			matcher, err := p.parseTagCondition(name)
+			if err != nil {
+				return err
+			}
+			q.Matchers = append(q.Matchers, matcher)
+		}
+
+		if !p.acceptKeyword("AND") {
+			if t := p.peek(); t.isKeyword("OR") {
+				return p.errorf(t, "OR is not supported, conditions can only be joined with AND")
+			}
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseTagCondition(name token) (*index.Matcher, error) {
+	op := p.next()
+	var operator string
+	switch op.typ {
+	case tokenEqual:
+		operator = index.Equal
+	case tokenNotEqual:
+		operator = index.NotEqual
+	case tokenRegex:
+		operator = index.Regex
+	default:
+		return nil, p.errorf(op, "expected '=', '!=' or '=~' after tag %s, found %s", name, op)
+	}
+
+	value, err := p.expect(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	matcher, err := index.NewMatcher(name.text, operator, value.text)
+	if err != nil {
+		return nil, p.errorf(value, "%v", err)
+	}
+	return matcher, nil
+}
+
+func (p *parser) parseTimeCondition() (*TimeCondition, error) {
+	op := p.next()
+	operators := map[tokenType]string{
+		tokenEqual:        "=",
+		tokenLess:         "<",
+		tokenLessEqual:    "<=",
+		tokenGreater:      ">",
+		tokenGreaterEqual: ">=",
+	}
+	operator, ok := operators[op.typ]
+	if !ok {
+		return nil, p.errorf(op, "expected comparison of time, found %s", op)
+	}
+
+	t, err := p.parseTime()
+	if err != nil {
+		return nil, err
+	}
+	return &TimeCondition{Operator: operator, Time: t}, nil
+}
+
+func (p *parser) parseTime() (*Time, error) {
+	t := p.next()
+	switch {
+	case t.typ == tokenNumber:
+		timestamp, err := strconv.ParseUint(t.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid timestamp %s", t.text)
+		}
+		return &Time{Timestamp: timestamp}, nil
+	case t.isKeyword("now"):
+		_, err := p.expect(tokenLeftParen)
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.expect(tokenRightParen)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf(t, "expected timestamp or now(), found %s", t)
+	}
+
+	result := &Time{Now: true}
+	sign := p.peek()
+	if sign.typ != tokenPlus && sign.typ != tokenMinus {
+		return result, nil
+	}
+	p.next()
+
+	offset, err := p.parseDuration()
+	if err != nil {
+		return nil, err
+	}
+	if sign.typ == tokenMinus {
+		offset = -offset
+	}
+	result.Offset = offset
+	return result, nil
+}
+
+func (p *parser) parseDuration() (time.Duration, error) {
+	t, err := p.expect(tokenDuration)
+	if err != nil {
+		return 0, err
+	}
+
+	digits := strings.TrimRightFunc(t.text, func(r rune) bool { return r < '0' || r > '9' })
+	unit := durationUnitLengths[t.text[len(digits):]]
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n > math.MaxInt64/int64(unit) {
+		return 0, p.errorf(t, "duration %s is too long", t.text)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func (p *parser) parseDimensions(q *Query) error {
+	for {
+		name, err := p.expect(tokenIdent)
+		if err != nil {
+			return err
+		}
+
+		if strings.EqualFold(name.text, "time") && p.peek().typ == tokenLeftParen {
+			if q.Interval != 0 {
+				return p.errorf(name, "time can be grouped by only once")
+			}
+			p.next()
+			interval, err := p.parseDuration()
+			if err != nil {
+				return err
+			}
+			if interval == 0 {
+				return p.errorf(name, "interval of time buckets has to be positive")
+			}
+			q.Interval = interval
+			_, err = p.expect(tokenRightParen)
+			if err != nil {
+				return err
+			}
+		} else {
+			q.GroupBy = append(q.GroupBy, name.text)
+		}
+
+		if p.peek().typ != tokenComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseFill(q *Query) error {
+	fill := p.next()
+	_, err := p.expect(tokenLeftParen)
+	if err != nil {
+		return err
+	}
+	mode, err := p.expect(tokenIdent)
+	if err != nil {
+		return err
+	}
+	q.Fill = strings.ToLower(mode.text)
+	if !slices.Contains(fillModes, q.Fill) {
+		return p.errorf(mode, "unknown fill mode %s, expected one of %s", mode, strings.Join(fillModes, ", "))
+	}
+	if q.Interval == 0 {
+		return p.errorf(fill, "FILL requires GROUP BY time(...)")
+	}
+	_, err = p.expect(tokenRightParen)
+	return err
+}
@@ -0,0 +1,65 @@
+package query
+
+/*
+	Query language of the engine:
+
+		SELECT <field> FROM <measurement>
+			[WHERE <condition> [AND <condition>]...]
+			[GROUP BY <dimension> [, <dimension>]...]
+			[FILL(none | null | previous | linear)]
+
+	field      value, or an aggregation of it such as max(value), mean(value) or percentile(value, 95)
+	condition  <tag> = | != | =~ '<string>', or time = | < | <= | > | >= <time>
+	time       a timestamp in the engine precision, or now() optionally followed by + or - a duration
+	dimension  a tag name, or time(<duration>) to aggregate in buckets of the duration
+	duration   an integer with one of the units ns, us, ms, s, m, h, d or w, such as 90s or 1h
+
+	Keywords and function names are case insensitive. Strings are quoted with single quotes,
+	identifiers may be quoted with double quotes. For example:
+
+		SELECT max(value) FROM cpu WHERE host = 'a' AND time >= now() - 1h GROUP BY time(1m), region
+*/
+
+import (
+	"fmt"
+	"time"
+	"time-series-engine/internal/index"
+)
+
+// Query is a parsed statement
+type Query struct {
+	// Function is the aggregation function as accepted by the engine, empty when raw points are selected
+	Function    string
+	Measurement string
+	Matchers    []*index.Matcher
+	// TimeConditions restrict timestamps, all of them have to hold
+	TimeConditions []*TimeCondition
+	// Interval is duration of buckets of GROUP BY time(...), zero without it
+	Interval time.Duration
+	GroupBy  []string
+	// Fill is the fill mode of empty buckets, empty when not given, which is the same as none
+	Fill string
+}
+
+// TimeCondition compares timestamps to a time
+type TimeCondition struct {
+	Operator string // one of =, <, <=, > and >=
+	Time     *Time
+}
+
+// Time is either a timestamp, or an offset from the time the query is run
+type Time struct {
+	Now       bool
+	Offset    time.Duration // relative to now, negative for times in the past
+	Timestamp uint64
+}
+
+// Error is a syntax error at a byte offset in the query
+type Error struct {
+	Pos     int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos+1, e.Message)
+}
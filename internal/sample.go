@@ -0,0 +1,14 @@
+package internal
+
+// Sample is a point together with the time series it belongs to
+type Sample struct {
+	TimeSeries *TimeSeries
+	Point      *Point
+}
+
+func NewSample(ts *TimeSeries, p *Point) *Sample {
+	return &Sample{
+		TimeSeries: ts,
+		Point:      p,
+	}
+}
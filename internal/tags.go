@@ -2,6 +2,7 @@ package internal
 
 import (
 	"encoding/binary"
+	"io"
 	"sort"
 )
 
@@ -42,6 +43,15 @@ func (tags Tags) Sort() {
 	sort.Sort(tags)
 }
 
+// Copy returns tags which share nothing with the original ones
+func (tags Tags) Copy() Tags {
+	copied := make(Tags, 0, len(tags))
+	for _, tag := range tags {
+		copied = append(copied, NewTag(tag.Name, tag.Value))
+	}
+	return copied
+}
+
 func (tags Tags) Size() uint64 {
 	var total uint64 = 0
 	for _, tag := range tags {
@@ -72,22 +82,23 @@ func (tags Tags) Serialize() []byte {
 	return buffer
 }
 
-func DeserializeTags(data []byte, numTags uint64) (Tags, int) {
+// DeserializeTags returns tags and number of bytes they took, or an error if data is too short
+func DeserializeTags(data []byte, numTags uint64) (Tags, int, error) {
 	offset := 0
 	tags := NewTags()
 
 	for i := uint64(0); i < numTags; i++ {
-		nameLen := binary.BigEndian.Uint64(data[offset:])
-		offset += 8
-
-		name := string(data[offset : offset+int(nameLen)])
-		offset += int(nameLen)
-
-		valueLen := binary.BigEndian.Uint64(data[offset:])
-		offset += 8
-
-		value := string(data[offset : offset+int(valueLen)])
-		offset += int(valueLen)
+		name, n, err := deserializeString(data[offset:])
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+
+		value, n, err := deserializeString(data[offset:])
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
 
 		tags = append(tags, &Tag{
 			Name:  name,
@@ -95,5 +106,16 @@ func DeserializeTags(data []byte, numTags uint64) (Tags, int) {
 		})
 	}
 
-	return tags, offset
+	return tags, offset, nil
+}
+
+func deserializeString(data []byte) (string, int, error) {
+	if len(data) < 8 {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+	length := binary.BigEndian.Uint64(data)
+	if length > uint64(len(data)-8) {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+	return string(data[8 : 8+length]), 8 + int(length), nil
 }
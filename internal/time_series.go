@@ -22,15 +22,57 @@ func NewTimeSeries(measurementName string, tags Tags) *TimeSeries {
 	return ts
 }
 
+// separators of the hash are escaped in names and values, so they stay unambiguous
+var (
+	hashEscaper   = strings.NewReplacer("%", "%25", "|", "%7C", "=", "%3D")
+	hashUnescaper = strings.NewReplacer("%25", "%", "%7C", "|", "%3D", "=")
+)
+
 func (ts *TimeSeries) hash() string {
 	var stringBuilder strings.Builder
 
-	stringBuilder.WriteString(ts.MeasurementName)
+	stringBuilder.WriteString(hashEscaper.Replace(ts.MeasurementName))
 	// Add sorted tags:
 	ts.Tags.Sort()
 	for _, tag := range ts.Tags {
-		stringBuilder.WriteString(fmt.Sprintf("|%s=%s", tag.Name, tag.Value))
+		stringBuilder.WriteString(fmt.Sprintf("|%s=%s", hashEscaper.Replace(tag.Name), hashEscaper.Replace(tag.Value)))
 	}
 
 	return stringBuilder.String()
 }
+
+// ParseTimeSeriesHash restores time series from its hash
+func ParseTimeSeriesHash(hash string) (*TimeSeries, error) {
+	parts := strings.Split(hash, "|")
+	tags := NewTags()
+	for _, part := range parts[1:] {
+		name, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid time series hash: %q", hash)
+		}
+		tags = append(tags, NewTag(hashUnescaper.Replace(name), hashUnescaper.Replace(value)))
+	}
+	return NewTimeSeries(HashMeasurement(hash), tags), nil
+}
+
+// ParseLegacyTimeSeriesHash restores time series from a hash written before separators were
+// escaped. Names and values containing '|' or '=' can't be told apart from separators there,
+// so such series are not restored exactly.
+func ParseLegacyTimeSeriesHash(hash string) (*TimeSeries, error) {
+	parts := strings.Split(hash, "|")
+	tags := NewTags()
+	for _, part := range parts[1:] {
+		name, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid time series hash: %q", hash)
+		}
+		tags = append(tags, NewTag(name, value))
+	}
+	return NewTimeSeries(parts[0], tags), nil
+}
+
+// HashMeasurement returns measurement of the time series with the hash
+func HashMeasurement(hash string) string {
+	measurement, _, _ := strings.Cut(hash, "|")
+	return hashUnescaper.Replace(measurement)
+}
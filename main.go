@@ -1,13 +1,10 @@
 package main
 
 import (
-	"time-series-engine/engine"
+	"os"
+	"time-series-engine/cli"
 )
 
 func main() {
-	e, err := engine.NewEngine()
-	if err != nil {
-		panic(err)
-	}
-	e.Run()
+	os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
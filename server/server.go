@@ -0,0 +1,381 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/query"
+)
+
+// Server exposes the engine over HTTP with JSON requests and responses.
+//
+//	POST /write       single point object or array of them, or InfluxDB line protocol
+//	                  when sent as text/plain with optional ?precision=s|ms|us|ns (default ns)
+//	GET  /query       ?measurement=cpu&tag=host=a&start=1&end=2
+//	GET  /aggregate   same parameters as query, plus function=Min
+//	GET  /select      ?q=SELECT max(value) FROM cpu WHERE host='a' GROUP BY time(1m), a statement
+//	                  of the query language, syntax errors carry 1-based position in the statement
+//	POST /delete      {"measurement": "cpu", "tags": {"host": "a"}, "start": 1, "end": 2}
+type Server struct {
+	engine *engine.Engine
+	mux    *http.ServeMux
+}
+
+type pointRequest struct {
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags"`
+	Timestamp   *uint64           `json:"timestamp,omitempty"` // current time if omitted
+	Value       float64           `json:"value"`
+}
+
+type deleteRequest struct {
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags"`
+	Start       uint64            `json:"start"`
+	End         uint64            `json:"end"`
+}
+
+type pointResponse struct {
+	Timestamp uint64  `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type aggregateResponse struct {
+	Function string   `json:"function"`
+	Value    *float64 `json:"value"` // null when there are no points in the range
+}
+
+type selectResponse struct {
+	Function string                 `json:"function,omitempty"`
+	Series   []selectSeriesResponse `json:"series"`
+}
+
+type selectSeriesResponse struct {
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags"`
+	Rows        []selectRow       `json:"rows"`
+}
+
+type selectRow struct {
+	Timestamp uint64   `json:"timestamp"`
+	Value     *float64 `json:"value"` // null for aggregations without points
+}
+
+type errorResponse struct {
+	Error    string `json:"error"`
+	Position int    `json:"position,omitempty"`
+}
+
+func New(e *engine.Engine) *Server {
+	s := &Server{
+		engine: e,
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("POST /write", s.handleWrite)
+	s.mux.HandleFunc("GET /query", s.handleQuery)
+	s.mux.HandleFunc("GET /aggregate", s.handleAggregate)
+	s.mux.HandleFunc("GET /select", s.handleSelect)
+	s.mux.HandleFunc("POST /delete", s.handleDelete)
+
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// ListenAndServe serves requests on address until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	httpServer := &http.Server{
+		Addr:    address,
+		Handler: s.mux,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
+	}
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		s.handleWriteLineProtocol(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var requests []pointRequest
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &requests)
+	} else {
+		var single pointRequest
+		err = json.Unmarshal(body, &single)
+		requests = append(requests, single)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for i, req := range requests {
+		if req.Measurement == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("point %d: measurement is required", i))
+			return
+		}
+	}
+
+	samples := make([]*internal.Sample, 0, len(requests))
+	for _, req := range requests {
+		timestamp := s.engine.Precision().Now()
+		if req.Timestamp != nil {
+			timestamp = *req.Timestamp
+		}
+
+		samples = append(samples, internal.NewSample(
+			internal.NewTimeSeries(req.Measurement, tagsFromMap(req.Tags)),
+			internal.NewPointAt(req.Value, timestamp),
+		))
+	}
+
+	err = s.engine.PutBatch(samples)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleWriteLineProtocol(w http.ResponseWriter, r *http.Request) {
+	precision := internal.Nanoseconds
+	if name := r.URL.Query().Get("precision"); name != "" {
+		var err error
+		precision, err = internal.ParsePrecision(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	_, err := s.engine.WriteLineProtocol(r.Body, precision)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	ts, start, end, err := parseSeriesRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	it, err := s.engine.Iterator(ts, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer it.Close()
+
+	// the first point is read before the status is sent, so failures to open the range are reported,
+	// later failures can only cut the response short
+	found := it.Next()
+	if err = it.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// points are encoded as they are read instead of being collected first
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, "[")
+	encoder := json.NewEncoder(w)
+	for first := true; found; found = it.Next() {
+		if !first {
+			_, _ = io.WriteString(w, ",")
+		}
+		first = false
+		p := it.At()
+		if encoder.Encode(pointResponse{Timestamp: p.Timestamp, Value: p.Value}) != nil {
+			return
+		}
+	}
+	if it.Err() != nil {
+		return
+	}
+	_, _ = io.WriteString(w, "]\n")
+}
+
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	ts, start, end, err := parseSeriesRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	function := r.URL.Query().Get("function")
+	if function == "" {
+		writeError(w, http.StatusBadRequest, errors.New("function is required"))
+		return
+	}
+
+	result, err := s.engine.Aggregate(ts, start, end, function)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := aggregateResponse{Function: result.Function}
+	if result.Found {
+		response.Value = &result.Value
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleSelect(w http.ResponseWriter, r *http.Request) {
+	statement := r.URL.Query().Get("q")
+	if statement == "" {
+		writeError(w, http.StatusBadRequest, errors.New("q is required"))
+		return
+	}
+
+	result, err := s.engine.Execute(statement)
+	var syntaxErr *query.Error
+	if errors.As(err, &syntaxErr) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error(), Position: syntaxErr.Pos + 1})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := selectResponse{Function: result.Function, Series: make([]selectSeriesResponse, 0, len(result.Series))}
+	for _, series := range result.Series {
+		tags := make(map[string]string, len(series.Tags))
+		for _, tag := range series.Tags {
+			tags[tag.Name] = tag.Value
+		}
+		rows := make([]selectRow, 0, len(series.Rows))
+		for _, row := range series.Rows {
+			rows = append(rows, selectRow{Timestamp: row.Timestamp})
+			if row.Found {
+				rows[len(rows)-1].Value = &row.Value
+			}
+		}
+		response.Series = append(response.Series, selectSeriesResponse{Measurement: series.Measurement, Tags: tags, Rows: rows})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	var req deleteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Measurement == "" {
+		writeError(w, http.StatusBadRequest, errors.New("measurement is required"))
+		return
+	}
+	if req.End < req.Start {
+		writeError(w, http.StatusBadRequest, errors.New("end can't be smaller than start"))
+		return
+	}
+
+	err = s.engine.DeleteRange(internal.NewTimeSeries(req.Measurement, tagsFromMap(req.Tags)), req.Start, req.End)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseSeriesRange reads measurement, tags and time range from url parameters.
+// Tags are given as repeated tag=name=value parameters.
+func parseSeriesRange(r *http.Request) (*internal.TimeSeries, uint64, uint64, error) {
+	params := r.URL.Query()
+
+	measurement := params.Get("measurement")
+	if measurement == "" {
+		return nil, 0, 0, errors.New("measurement is required")
+	}
+
+	tags := internal.NewTags()
+	for _, tag := range params["tag"] {
+		name, value, found := strings.Cut(tag, "=")
+		if !found || name == "" {
+			return nil, 0, 0, fmt.Errorf("invalid tag %q, expected name=value", tag)
+		}
+		tags = append(tags, internal.NewTag(name, value))
+	}
+
+	start, err := parseUintParam(params.Get("start"), 0)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid start: %w", err)
+	}
+	end, err := parseUintParam(params.Get("end"), math.MaxUint64)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid end: %w", err)
+	}
+	if end < start {
+		return nil, 0, 0, errors.New("end can't be smaller than start")
+	}
+
+	return internal.NewTimeSeries(measurement, tags), start, end, nil
+}
+
+func parseUintParam(value string, defaultValue uint64) (uint64, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func tagsFromMap(m map[string]string) internal.Tags {
+	tags := internal.NewTags()
+	for name, value := range m {
+		tags = append(tags, internal.NewTag(name, value))
+	}
+	return tags
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk"
+)
+
+// values are added out of timestamp order, first is at timestamp 1 and last at timestamp 8
+var aggregatorTestPoints = []*internal.Point{
+	internal.NewPointAt(4, 3), internal.NewPointAt(2, 1), internal.NewPointAt(9, 8), internal.NewPointAt(4, 2),
+	internal.NewPointAt(5, 4), internal.NewPointAt(7, 7), internal.NewPointAt(4, 5), internal.NewPointAt(5, 6),
+}
+
+var aggregatorTestResults = map[string]float64{
+	engine.MIN:              2,
+	engine.MAX:              9,
+	engine.MEAN:             5,
+	engine.AVG:              5,
+	engine.SUM:              40,
+	engine.COUNT:            8,
+	engine.FIRST:            2,
+	engine.LAST:             9,
+	engine.SPREAD:           7,
+	engine.STDDEV:           math.Sqrt(32.0 / 7),
+	engine.MEDIAN:           4.5,
+	engine.Percentile(0):    2,
+	engine.Percentile(100):  9,
+	engine.Percentile(25):   4,
+	engine.Percentile(87.5): 7.25,
+}
+
+func TestAggregators(t *testing.T) {
+	for function, expected := range aggregatorTestResults {
+		whole, err := disk.NewAggregator(function)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, found := whole.Result(); found {
+			t.Errorf("%s: expected no result without points", function)
+		}
+		for _, p := range aggregatorTestPoints {
+			whole.Add(p)
+		}
+
+		// same points split into parts, including an empty one
+		merged, _ := disk.NewAggregator(function)
+		for _, part := range [][]*internal.Point{aggregatorTestPoints[:3], nil, aggregatorTestPoints[3:7], aggregatorTestPoints[7:]} {
+			aggregator, _ := disk.NewAggregator(function)
+			for _, p := range part {
+				aggregator.Add(p)
+			}
+			merged.Merge(aggregator)
+		}
+
+		for name, aggregator := range map[string]disk.Aggregator{"whole": whole, "merged": merged} {
+			value, found := aggregator.Result()
+			if !found || math.Abs(value-expected) > 1e-9 {
+				t.Errorf("%s (%s): expected %v, got %v (found %v)", function, name, expected, value, found)
+			}
+		}
+	}
+
+	for _, function := range []string{"Mode", "P", "P101", "P-1", "Pabc"} {
+		if _, err := disk.NewAggregator(function); err == nil {
+			t.Errorf("%s: expected error", function)
+		}
+	}
+}
+
+func TestEngineAggregateFunctions(t *testing.T) {
+	// points end up in parquets, frozen memtables and the active memtable
+	e := openTestEngineWith(t, 3, nil)
+	ts := internal.NewTimeSeries("load", internal.Tags{internal.NewTag("host", "a")})
+
+	now := internal.Seconds.Now()
+	for _, p := range aggregatorTestPoints {
+		if err := e.Put(ts, internal.NewPointAt(p.Value, now-100+p.Timestamp)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for function, expected := range aggregatorTestResults {
+		result, err := e.Aggregate(ts, 0, math.MaxUint64, function)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Found || math.Abs(result.Value-expected) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v (found %v)", function, expected, result.Value, result.Found)
+		}
+	}
+
+	for _, function := range engine.GetAllAggregationFunctions() {
+		if _, err := e.Aggregate(ts, 0, math.MaxUint64, function); err != nil {
+			t.Errorf("%s: %v", function, err)
+		}
+	}
+}
@@ -38,12 +38,12 @@ func TestSeek(t *testing.T) {
 	w.WriteBits(0b10101100_11100000_00000000_00000000_00000000_00000000_00000000_00000000, 8)
 	w.Flush()
 
-	_, err := w.Seek(4, internal.SeekStart)
+	off, err := w.Seek(4, internal.SeekStart)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
-	if w.currOff != 4 {
-		t.Errorf("expected offset 4, got %d", w.currOff)
+	if off != 4 {
+		t.Errorf("expected offset 4, got %d", off)
 	}
 
 	_, err = w.Seek(-1, internal.SeekStart)
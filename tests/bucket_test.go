@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"testing"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+)
+
+func TestAggregateBuckets(t *testing.T) {
+	e := openTestEngine(t, 3)
+	ts := internal.NewTimeSeries("requests", internal.Tags{internal.NewTag("path", "/")})
+
+	now := internal.Seconds.Now()
+	start := now - now%60 - 600
+	// buckets of 60s: [1, 3], [], [6], [], [], [9, 20]
+	points := map[uint64]float64{0: 1, 30: 3, 120: 6, 300: 9, 359: 20}
+	for offset, value := range points {
+		if err := e.Put(ts, internal.NewPointAt(value, start+offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type bucket struct {
+		value float64
+		found bool
+	}
+	tests := []struct {
+		function string
+		fill     string
+		expected []bucket
+	}{
+		{engine.AVG, engine.FillNone, []bucket{{2, true}, {6, true}, {14.5, true}}},
+		{engine.SUM, engine.FillNull, []bucket{{4, true}, {}, {6, true}, {}, {}, {29, true}}},
+		{engine.COUNT, engine.FillNull, []bucket{{2, true}, {}, {1, true}, {}, {}, {2, true}}},
+		{engine.MAX, engine.FillPrevious, []bucket{{3, true}, {3, true}, {6, true}, {6, true}, {6, true}, {20, true}}},
+		{engine.MIN, engine.FillLinear, []bucket{{1, true}, {3.5, true}, {6, true}, {7, true}, {8, true}, {9, true}}},
+	}
+
+	for _, test := range tests {
+		buckets, err := e.AggregateBuckets(ts, start, start+359, 60, test.function, test.fill)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buckets) != len(test.expected) {
+			t.Fatalf("%s/%s: expected %d buckets, got %d", test.function, test.fill, len(test.expected), len(buckets))
+		}
+		for i, b := range buckets {
+			if b.Found != test.expected[i].found || b.Value != test.expected[i].value {
+				t.Errorf("%s/%s: bucket %d expected %v, got %v (found %v)",
+					test.function, test.fill, i, test.expected[i].value, b.Value, b.Found)
+			}
+		}
+		if test.fill != engine.FillNone {
+			for i, b := range buckets {
+				if b.Start != start+uint64(i)*60 {
+					t.Errorf("Bucket %d starts at %d, expected %d", i, b.Start, start+uint64(i)*60)
+				}
+			}
+		}
+	}
+
+	// buckets are aligned to the interval, not to the start of the range
+	buckets, err := e.AggregateBuckets(ts, start+45, start+359, 60, engine.COUNT, engine.FillNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 6 || buckets[0].Start != start || buckets[0].Value != 0 || buckets[0].Found {
+		t.Errorf("Expected first bucket at %d without points, got %+v", start, buckets[0])
+	}
+
+	// nothing to fill before the first bucket with points
+	buckets, err = e.AggregateBuckets(ts, start-120, start+59, 60, engine.MAX, engine.FillPrevious)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 3 || buckets[0].Found || buckets[1].Found || !buckets[2].Found {
+		t.Errorf("Unexpected leading buckets: %+v %+v %+v", buckets[0], buckets[1], buckets[2])
+	}
+
+	invalid := []struct {
+		interval uint64
+		function string
+		fill     string
+	}{
+		{0, engine.MAX, engine.FillNone},
+		{60, "Mode", engine.FillNone},
+		{60, engine.MAX, "zero"},
+		{1, engine.MAX, engine.FillNull},
+	}
+	for _, test := range invalid {
+		if _, err = e.AggregateBuckets(ts, 0, now, test.interval, test.function, test.fill); err == nil {
+			t.Errorf("Expected error for interval %d, function %s and fill %s", test.interval, test.function, test.fill)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time-series-engine/cli"
+	"time-series-engine/internal"
+)
+
+// writeTestConfig writes configuration keeping all data in a temporary directory
+func writeTestConfig(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := fmt.Sprintf(`engine:
+    retention_period: 1
+    period_type: day
+    precision: s
+memtable:
+    max_size: 2
+parquet:
+    row_group_size: 3
+time_window:
+    windows_dir_path: %s
+wal:
+    logs_dir_path: %s
+`, filepath.Join(dir, "data"), filepath.Join(dir, "logs"))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := cli.Run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestCLICommands(t *testing.T) {
+	conf := writeTestConfig(t)
+	now := internal.Seconds.Now()
+	start := now - now%60 - 600
+
+	lines := make([]string, 0)
+	for i, host := range []string{"a", "a", "b", "a", "b"} {
+		lines = append(lines, fmt.Sprintf("cpu,host=%s value=%d %d", host, i+1, start+uint64(i)*30))
+	}
+	out, stderr, code := runCLI(t, strings.Join(lines, "\n"), "-config", conf, "write", "-precision", "s")
+	if code != 0 || out != "Written 5 points\n" {
+		t.Fatalf("write: exit %d, %q, %s", code, out, stderr)
+	}
+
+	// flags are accepted after the command too
+	out, stderr, code = runCLI(t, "", "query", "-config", conf, "-format", "csv", "SELECT max(value) FROM cpu GROUP BY host")
+	if code != 0 {
+		t.Fatalf("query: exit %d, %s", code, stderr)
+	}
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][0] != "cpu,host=a" || records[1][2] != "4" || records[2][2] != "5" {
+		t.Errorf("Unexpected query output: %q", records)
+	}
+
+	_, stderr, code = runCLI(t, "", "-config", conf, "query", "SELECT max(value) FROM")
+	if code != 1 || !strings.Contains(stderr, "                      ^\n[ERROR]: position 23") {
+		t.Errorf("Expected syntax error at position 23, got exit %d: %s", code, stderr)
+	}
+
+	out, stderr, code = runCLI(t, "", "-config", conf, "-format", "json", "aggregate",
+		"-start", fmt.Sprint(start), "-end", fmt.Sprint(start+119), "-every", "1m", "sum", "cpu", "host=a")
+	if code != 0 {
+		t.Fatalf("aggregate: exit %d, %s", code, stderr)
+	}
+	var buckets []struct {
+		Series    string   `json:"series"`
+		Timestamp uint64   `json:"timestamp"`
+		Value     *float64 `json:"value"`
+	}
+	if err = json.Unmarshal([]byte(out), &buckets); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if len(buckets) != 2 || *buckets[0].Value != 3 || buckets[1].Timestamp != start+60 || *buckets[1].Value != 4 {
+		t.Errorf("Unexpected buckets: %s", out)
+	}
+
+	out, _, code = runCLI(t, "", "-config", conf, "export", "cpu", "host=b")
+	expected := fmt.Sprintf("cpu,host=b value=3 %d\ncpu,host=b value=5 %d\n", (start+60)*1e9, (start+120)*1e9)
+	if code != 0 || out != expected {
+		t.Errorf("Expected export %q, got %q", expected, out)
+	}
+
+	// deleting the whole range has to be asked for
+	if _, stderr, code = runCLI(t, "", "-config", conf, "delete", "cpu", "host=a"); code == 0 || !strings.Contains(stderr, "-all") {
+		t.Fatalf("Expected delete without a range to fail, got exit %d, %s", code, stderr)
+	}
+	if stats := inspectCLI(t, conf); stats["deleted_points"] != "0" {
+		t.Fatalf("Expected nothing to be deleted, got %v", stats)
+	}
+
+	out, stderr, code = runCLI(t, "", "-config", conf, "delete", "-start", fmt.Sprint(start), "-end", fmt.Sprint(start+30), "cpu", "host=a")
+	if code != 0 || out != "Deleted points of 1 series\n" {
+		t.Fatalf("delete: exit %d, %q, %s", code, out, stderr)
+	}
+	stats := inspectCLI(t, conf)
+	if stats["deleted_points"] != "2" || stats["uncompacted_parquets"] == "0" {
+		t.Errorf("Unexpected statistics before compaction: %v", stats)
+	}
+
+	out, stderr, code = runCLI(t, "", "-config", conf, "compact")
+	if code != 0 || out != fmt.Sprintf("Compacted %s parquets\n", stats["uncompacted_parquets"]) {
+		t.Fatalf("compact: exit %d, %q, %s", code, out, stderr)
+	}
+	stats = inspectCLI(t, conf)
+	if stats["deleted_points"] != "0" || stats["uncompacted_parquets"] != "0" || stats["points"] != "2" {
+		t.Errorf("Unexpected statistics after compaction: %v", stats)
+	}
+
+	// exported points are imported again into another engine
+	exported, _, _ := runCLI(t, "", "-config", conf, "export", "cpu")
+	other := writeTestConfig(t)
+	out, stderr, code = runCLI(t, exported, "-config", other, "import", "-")
+	if code != 0 || out != "Imported 3 points\n" {
+		t.Fatalf("import: exit %d, %q, %s", code, out, stderr)
+	}
+	reexported, _, _ := runCLI(t, "", "-config", other, "export", "cpu")
+	if reexported != exported {
+		t.Errorf("Expected imported points %q, got %q", exported, reexported)
+	}
+	out, stderr, code = runCLI(t, "", "-config", other, "delete", "-all", "cpu")
+	if code != 0 || out != "Deleted points of 2 series\n" {
+		t.Fatalf("delete -all: exit %d, %q, %s", code, out, stderr)
+	}
+	if reexported, _, _ = runCLI(t, "", "-config", other, "export", "cpu"); reexported != "" {
+		t.Errorf("Expected all points to be deleted, got %q", reexported)
+	}
+
+	if _, _, code = runCLI(t, "", "-config", conf, "-format", "xml", "inspect"); code != 2 {
+		t.Errorf("Expected exit 2 for unknown format, got %d", code)
+	}
+	if _, _, code = runCLI(t, "", "-config", conf, "drop"); code != 2 {
+		t.Errorf("Expected exit 2 for unknown command, got %d", code)
+	}
+}
+
+func inspectCLI(t *testing.T, conf string) map[string]string {
+	t.Helper()
+
+	out, stderr, code := runCLI(t, "", "-config", conf, "-format", "csv", "inspect")
+	if code != 0 {
+		t.Fatalf("inspect: exit %d, %s", code, stderr)
+	}
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := make(map[string]string)
+	for _, record := range records[1:] {
+		stats[record[0]] = record[1]
+	}
+	return stats
+}
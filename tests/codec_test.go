@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"testing"
+	"time-series-engine/internal/disk/entry"
+	"time-series-engine/internal/disk/page"
+)
+
+// testDeleteCodec is the bitmap codec under another ID
+type testDeleteCodec struct {
+	page.Codec
+}
+
+// registered once, even when tests run repeatedly
+var testDelete = &testDeleteCodec{Codec: page.DeleteBitmap}
+
+func (c *testDeleteCodec) ID() uint8 {
+	return 200
+}
+
+func (c *testDeleteCodec) Name() string {
+	return "test_bitmap"
+}
+
+func (c *testDeleteCodec) NewPage(pageSize uint64) page.Page {
+	p := c.Codec.NewPage(pageSize).(*page.DeletePage)
+	p.Metadata.Codec = c.ID()
+	p.Codec = c
+	return p
+}
+
+func (c *testDeleteCodec) Deserialize(bytes []byte, metadata *page.Metadata) (page.Page, error) {
+	p, err := c.Codec.Deserialize(bytes, metadata)
+	if err != nil {
+		return nil, err
+	}
+	p.(*page.DeletePage).Codec = c
+	return p, nil
+}
+
+func TestCodecRegistry(t *testing.T) {
+	const PageSize uint64 = 64
+
+	for _, column := range []page.Column{page.TimestampColumn, page.ValueColumn, page.DeleteColumn} {
+		for _, codec := range page.Codecs(column) {
+			found, err := page.CodecByName(column, codec.Name())
+			if err != nil || found != codec {
+				t.Errorf("Expected %s codec %s to be found by name", column, codec.Name())
+			}
+		}
+	}
+
+	codec := testDelete
+	if _, err := page.LookupCodec(page.DeleteColumn, codec.ID()); err != nil {
+		if err = page.RegisterCodec(codec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := page.RegisterCodec(codec); err == nil {
+		t.Error("Expected registering a codec ID twice to fail")
+	}
+
+	p := page.NewDeletePageWithCodec(PageSize, codec)
+	p.Add(entry.NewDeleteEntry(true))
+	p.Add(entry.NewDeleteEntry(false))
+	bytes := p.Serialize()
+
+	read, err := page.DeserializeDeletePage(bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp := read.(*page.DeletePage)
+	if dp.Codec != codec || dp.Metadata.Codec != codec.ID() || dp.EntryCount() != 2 || dp.Entries[0].GetValue() != 1 {
+		t.Errorf("Expected page of the registered codec, got %+v", dp.Metadata)
+	}
+
+	// pages of unknown codecs, or of newer versions of known ones, can't be read
+	unknown := page.NewDeletePage(PageSize)
+	unknown.Metadata.Codec = 201
+	if _, err = page.DeserializeDeletePage(unknown.Serialize()); err == nil {
+		t.Error("Expected page of an unknown codec to fail")
+	}
+	newer := page.NewDeletePage(PageSize)
+	newer.Metadata.Version = page.DeleteBitmap.Version() + 1
+	if _, err = page.DeserializeDeletePage(newer.Serialize()); err == nil {
+		t.Error("Expected page of a newer codec version to fail")
+	}
+}
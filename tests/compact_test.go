@@ -0,0 +1,340 @@
+package tests
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+)
+
+func TestCompact(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 4, func(conf *config.Config) {
+		conf.ParquetConfig.RowGroupSize = 3
+		c = conf
+	})
+	ts := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "a")})
+	start := windowStart(c, 100)
+
+	// two flushes leave a partial row group, the third overwrites a flushed point
+	for i := uint64(1); i <= 8; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), start+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, v := range []float64{20, 9, 10, 11} {
+		timestamp := start + 2
+		if i > 0 {
+			timestamp = start + uint64(v)
+		}
+		if err := e.Put(ts, internal.NewPointAt(v, timestamp)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = reopenEngine(t, e, c)
+	if err := e.DeleteRange(ts, start+5, start+5); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := e.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Uncompacted != 1 || stats.DeletedPoints != 1 {
+		t.Fatalf("Expected an uncompacted parquet with a deleted point, got %+v", stats)
+	}
+
+	compacted, err := e.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted != 1 {
+		t.Errorf("Expected 1 compacted parquet, got %d", compacted)
+	}
+
+	stats, err = e.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Uncompacted != 0 || stats.DeletedPoints != 0 || stats.Points != uint64(len(before)) || stats.RowGroups != 4 {
+		t.Errorf("Unexpected statistics after compaction: %+v", stats)
+	}
+	if compacted, err = e.Compact(); err != nil || compacted != 0 {
+		t.Errorf("Expected nothing to compact again, got %d (%v)", compacted, err)
+	}
+
+	e = reopenEngine(t, e, c)
+	after, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("Expected %d points after compaction, got %d", len(before), len(after))
+	}
+	for i := range before {
+		if *after[i] != *before[i] {
+			t.Errorf("Point %d: expected %v, got %v", i, before[i], after[i])
+		}
+	}
+	if after[1].Value != 20 {
+		t.Errorf("Expected the overwritten point to keep value 20, got %v", after[1])
+	}
+
+	sum, err := e.Aggregate(ts, 0, math.MaxUint64, engine.SUM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Value != 1+20+3+4+6+7+8+9+10+11 {
+		t.Errorf("Unexpected sum after compaction: %v", sum.Value)
+	}
+}
+
+func TestCompactKeepsStoredValues(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 3, func(conf *config.Config) {
+		conf.ParquetConfig.RowGroupSize = 2
+		conf.ParquetConfig.ValueEncoding = "scaled"
+		conf.ParquetConfig.MeasurementValueEncodings = nil
+		c = conf
+	})
+	scaled := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "a")})
+	lossless := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "b")})
+	start := windowStart(c, 100)
+
+	// flushes of three points leave partial row groups, so both parquets are rewritten
+	values := []float64{0.00013, 0.00014, 0.00112, 0.0012, 1.00001, 0.00007}
+	for i, v := range values {
+		if err := e.Put(scaled, internal.NewPointAt(v, start+uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// written with lossless values, but compacted once configuration changed
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c.ParquetConfig.ValueEncoding = "lossless"
+	e = reopenEngine(t, e, c)
+	exact := []float64{0.123456789, 1.0 / 3, 2.5e-7, 42, 7.777777, 0.1}
+	for i, v := range exact {
+		if err := e.Put(lossless, internal.NewPointAt(v, start+uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c.ParquetConfig.ValueEncoding = "scaled"
+	e = reopenEngine(t, e, c)
+
+	check := func(ts *internal.TimeSeries, expected []float64) {
+		t.Helper()
+		points, err := e.Query(ts, 0, math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != len(expected) {
+			t.Fatalf("%s: expected %d points, got %d", ts.Hash, len(expected), len(points))
+		}
+		for i, p := range points {
+			if p.Value != expected[i] {
+				t.Errorf("%s: expected %v at %d, got %v", ts.Hash, expected[i], p.Timestamp, p.Value)
+			}
+		}
+	}
+	check(scaled, values)
+	check(lossless, exact)
+
+	// every compaction re-encodes the points, which must not change them
+	for i := 0; i < 3; i++ {
+		// overwrites with the same values fill the memtable, their row groups overlap the older ones
+		overwrites := []*internal.Sample{
+			{TimeSeries: scaled, Point: internal.NewPointAt(values[0], start)},
+			{TimeSeries: scaled, Point: internal.NewPointAt(values[1], start+1)},
+			{TimeSeries: lossless, Point: internal.NewPointAt(exact[3], start+3)},
+		}
+		if err := e.PutBatch(overwrites); err != nil {
+			t.Fatal(err)
+		}
+		e = reopenEngine(t, e, c)
+
+		compacted, err := e.Compact()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compacted != 2 {
+			t.Errorf("Expected 2 compacted parquets, got %d", compacted)
+		}
+		check(scaled, values)
+		check(lossless, exact)
+	}
+}
+
+func TestCompactionRecovery(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 2, func(conf *config.Config) {
+		c = conf
+	})
+	ts := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "a")})
+	now := windowStart(c, 100) + 10
+	for i := uint64(0); i < 2; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), now-i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the original was moved aside, but its rewrite never took its place
+	originals, err := filepath.Glob(filepath.Join(c.WindowsDirPath, "*", "parquet0000"))
+	if err != nil || len(originals) != 1 {
+		t.Fatalf("Expected one parquet, got %d (%v)", len(originals), err)
+	}
+	original := originals[0]
+	window := filepath.Base(filepath.Dir(original))
+	backup := filepath.Join(filepath.Dir(c.WindowsDirPath), "compaction", window, "parquet0000.old")
+	if err = os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(original, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	e = reopenEngine(t, e, c)
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 {
+		t.Errorf("Expected 2 points restored from the backup, got %d", len(points))
+	}
+	if _, err = os.Stat(filepath.Dir(backup)); !os.IsNotExist(err) {
+		t.Errorf("Expected compaction directory to be removed, got %v", err)
+	}
+}
+
+func TestCompactRemovesEmptyParquet(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 4, func(conf *config.Config) {
+		c = conf
+	})
+	a := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "a")})
+	b := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "b")})
+	now := windowStart(c, 100) + 10
+	for i := uint64(0); i < 2; i++ {
+		for _, ts := range []*internal.TimeSeries{a, b} {
+			if err := e.Put(ts, internal.NewPointAt(float64(i), now-i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	e = reopenEngine(t, e, c)
+	if err := e.DeleteRange(a, 0, math.MaxUint64); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := e.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Parquets != 1 || stats.Uncompacted != 0 {
+		t.Errorf("Expected only the parquet of b to remain, got %+v", stats)
+	}
+
+	// the series written again gets a new parquet next to the moved one
+	for i := uint64(0); i < 4; i++ {
+		if err = e.Put(a, internal.NewPointAt(float64(10+i), now-i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = reopenEngine(t, e, c)
+	for ts, expected := range map[*internal.TimeSeries]int{a: 4, b: 2} {
+		points, err := e.Query(ts, 0, math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != expected {
+			t.Errorf("%s: expected %d points, got %d", ts.Hash, expected, len(points))
+		}
+	}
+}
+
+func TestCompactCompressesColdWindows(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 4, func(conf *config.Config) {
+		conf.ParquetConfig.RowGroupSize = 2
+		conf.ParquetConfig.Compression = config.CompressionFlate
+		conf.TimeWindowConfig.Duration = 10
+		c = conf
+	})
+	ts := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "a")})
+	start := windowStart(c, 1000)
+
+	for _, offset := range []uint64{1, 3, 5, 7} {
+		if err := e.Put(ts, internal.NewPointAt(float64(offset), start+offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = reopenEngine(t, e, c)
+
+	uncompressed, err := e.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := e.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CompressedRowGroups != stats.RowGroups || stats.RowGroups != 2 || stats.Bytes >= uncompressed.Bytes {
+		t.Fatalf("Expected all row groups compressed into fewer bytes than %d, got %+v", uncompressed.Bytes, stats)
+	}
+
+	// deletes and backfilled points keep working on compressed row groups
+	if err = e.DeleteRange(ts, start+3, start+3); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []uint64{2, 4, 6, 8} {
+		if err = e.Put(ts, internal.NewPointAt(float64(offset), start+offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = reopenEngine(t, e, c)
+	if _, err = e.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenEngine(t, e, c)
+
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint64{1, 2, 4, 5, 6, 7, 8}
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points, got %d", len(expected), len(points))
+	}
+	for i, p := range points {
+		if p.Timestamp != start+expected[i] || p.Value != float64(expected[i]) {
+			t.Errorf("Expected point %d at %d, got %v at %d", expected[i], start+expected[i], p.Value, p.Timestamp-start)
+		}
+	}
+	stats, err = e.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CompressedRowGroups != stats.RowGroups {
+		t.Errorf("Expected all row groups compressed again, got %+v", stats)
+	}
+}
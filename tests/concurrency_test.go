@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+)
+
+// run with -race to check the engine for data races
+func TestConcurrentWritersAndReaders(t *testing.T) {
+	const writers = 4
+	const pointsPerWriter = 300
+
+	var c *config.Config
+	e := openTestEngineWith(t, 50, func(conf *config.Config) {
+		conf.WALConfig.SegmentSizeInPages = 4
+		conf.WALConfig.SyncMode = "never"
+		conf.ParquetConfig.RowGroupSize = 50
+		c = conf
+	})
+
+	series := make([]*internal.TimeSeries, writers)
+	for i := range series {
+		series[i] = internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", fmt.Sprintf("host%d", i))})
+	}
+	now := internal.Seconds.Now()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	done := make(chan struct{})
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(ts *internal.TimeSeries) {
+			defer wg.Done()
+			for i := 0; i < pointsPerWriter; i += 10 {
+				batch := make([]*internal.Sample, 0, 10)
+				for j := i; j < i+10; j++ {
+					batch = append(batch, internal.NewSample(ts, internal.NewPointAt(float64(j), now-pointsPerWriter+uint64(j))))
+				}
+				if err := e.PutBatch(batch); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(series[w])
+	}
+
+	// points of this series are written and deleted while the others are ingested
+	deleted := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "deleted")})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := uint64(0); i < 50; i++ {
+			if err := e.Put(deleted, internal.NewPointAt(1, now-100+i)); err != nil {
+				errs <- err
+				return
+			}
+			if err := e.DeleteRange(deleted, 0, math.MaxUint64); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func(ts *internal.TimeSeries) {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				points, err := e.Query(ts, 0, math.MaxUint64)
+				if err != nil {
+					errs <- err
+					return
+				}
+				// points of a single writer arrive in order, so whatever is visible is a prefix
+				for i, p := range points {
+					if p.Value != float64(i) {
+						errs <- fmt.Errorf("%s: expected value %d at position %d, got %v", ts.Hash, i, i, p.Value)
+						return
+					}
+				}
+				if _, err = e.Aggregate(ts, 0, math.MaxUint64, engine.AVG); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(series[r])
+	}
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	check := func(e *engine.Engine) {
+		for _, ts := range series {
+			points, err := e.Query(ts, 0, math.MaxUint64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != pointsPerWriter {
+				t.Fatalf("%s: expected %d points, got %d", ts.Hash, pointsPerWriter, len(points))
+			}
+		}
+		points, err := e.Query(deleted, 0, math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 0 {
+			t.Fatalf("Expected deleted series to be empty, got %d points", len(points))
+		}
+	}
+
+	check(e)
+	check(reopenEngine(t, e, c))
+}
+
+func TestFlushQueueBackpressure(t *testing.T) {
+	const maxImmutable = 3
+
+	e := openTestEngineWith(t, 5, func(conf *config.Config) {
+		conf.MemTableConfig.MaxImmutable = maxImmutable
+		conf.WALConfig.SyncMode = "never"
+	})
+	ts := internal.NewTimeSeries("queue", internal.Tags{internal.NewTag("host", "a")})
+	now := internal.Seconds.Now()
+
+	done := make(chan struct{})
+	pending := make(chan int)
+	go func() {
+		most := 0
+		for {
+			select {
+			case <-done:
+				pending <- most
+				return
+			default:
+				most = max(most, e.PendingFlushes())
+			}
+		}
+	}()
+
+	for i := uint64(0); i < 200; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), now-200+i)); err != nil {
+			t.Fatal(err)
+		}
+		// frozen memtables are visible to queries before they are flushed
+		points, err := e.Query(ts, 0, math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(points)) != i+1 {
+			t.Fatalf("Expected %d points, got %d", i+1, len(points))
+		}
+	}
+	close(done)
+
+	if most := <-pending; most > maxImmutable {
+		t.Errorf("Expected at most %d pending flushes, got %d", maxImmutable, most)
+	}
+}
+
+func TestFlushStagingRecovery(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 2, func(conf *config.Config) {
+		c = conf
+	})
+	ts := internal.NewTimeSeries("staged", internal.Tags{internal.NewTag("host", "a")})
+	now := windowStart(c, 100) + 10
+	// the second flush appends to the parquet written by the first one
+	for i := uint64(0); i < 4; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), now+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	flushDir := filepath.Join(filepath.Dir(c.WindowsDirPath), "flush")
+	if _, err := os.Stat(flushDir); !os.IsNotExist(err) {
+		t.Fatalf("Expected flush directory to be removed after flushes, got %v", err)
+	}
+
+	// the original was moved aside, but its staged copy never took its place
+	originals, err := filepath.Glob(filepath.Join(c.WindowsDirPath, "*", "parquet0000"))
+	if err != nil || len(originals) != 1 {
+		t.Fatalf("Expected one parquet, got %d (%v)", len(originals), err)
+	}
+	window := filepath.Base(filepath.Dir(originals[0]))
+	backup := filepath.Join(flushDir, window, "parquet0000.old")
+	if err = os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(originals[0], backup); err != nil {
+		t.Fatal(err)
+	}
+
+	e = reopenEngine(t, e, c)
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 4 {
+		t.Errorf("Expected 4 points restored from the backup, got %d", len(points))
+	}
+	if _, err = os.Stat(flushDir); !os.IsNotExist(err) {
+		t.Errorf("Expected flush directory to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time-series-engine/config"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk"
+	"time-series-engine/internal/disk/chunk"
+	"time-series-engine/internal/disk/entry"
+	"time-series-engine/internal/disk/page"
+)
+
+func TestRunLengthDeletePage(t *testing.T) {
+	const PageSize uint64 = 64
+	const Rows = 300
+
+	check := func(deleted func(i int) bool, codec page.Codec) {
+		t.Helper()
+
+		p := page.NewDeletePageWithCodec(PageSize, page.DeleteRunLength)
+		for i := 0; i < Rows; i++ {
+			p.Add(entry.NewDeleteEntry(deleted(i)))
+		}
+
+		read, err := page.DeserializeDeletePage(p.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dp := read.(*page.DeletePage)
+		if dp.Codec != codec || dp.EntryCount() != Rows {
+			t.Fatalf("Expected %d rows of %s codec, got %d of %s", Rows, codec.Name(), dp.EntryCount(), dp.Codec.Name())
+		}
+		for i, e := range dp.Entries {
+			if e.(*entry.DeleteEntry).Deleted != deleted(i) {
+				t.Errorf("Row %d: expected deleted %v", i, deleted(i))
+			}
+		}
+	}
+
+	// a deleted range takes three runs
+	check(func(i int) bool { return i >= 100 && i < 200 }, page.DeleteRunLength)
+	check(func(i int) bool { return i < 10 }, page.DeleteRunLength)
+	// runs of single rows don't fit, so the page is written as bitmap
+	check(func(i int) bool { return i%2 == 0 }, page.DeleteBitmap)
+}
+
+func TestRunLengthDeleteChunkSize(t *testing.T) {
+	const Rows = 5000
+	pm := page.NewManager(config.PageConfig{PageSize: 256, BufferPoolCapacity: 10})
+
+	size := func(codec page.Codec, deleted func(i int) bool) int64 {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "delete.db")
+		if err := pm.CreateFile(path); err != nil {
+			t.Fatal(err)
+		}
+		dc := chunk.NewDeleteChunkWithCodec(pm.Config.PageSize, path, codec)
+		for i := 0; i < Rows; i++ {
+			if err := dc.Add(pm, deleted(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dc.Save(pm); err != nil {
+			t.Fatal(err)
+		}
+
+		// every row is read back, whichever way pages were filled
+		it, err := disk.NewIterator(pm, path, disk.Delete)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < Rows; i++ {
+			e, err := it.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.(*entry.DeleteEntry).Deleted != deleted(i) {
+				t.Fatalf("%s: row %d: expected deleted %v", codec.Name(), i, deleted(i))
+			}
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	// a bitmap page holds (256 - 24) * 8 rows, runs of active rows take a few bytes in total
+	none := func(i int) bool { return false }
+	if bitmap, rle := size(page.DeleteBitmap, none), size(page.DeleteRunLength, none); bitmap != 3*256 || rle != 256 {
+		t.Errorf("Expected 3 bitmap pages and a run length encoded page, got %d and %d bytes", bitmap, rle)
+	}
+	// rows changing too often for runs fill pages as bitmaps
+	alternating := func(i int) bool { return i%2 == 0 }
+	if bitmap, rle := size(page.DeleteBitmap, alternating), size(page.DeleteRunLength, alternating); rle != bitmap {
+		t.Errorf("Expected run length encoded pages to take as much as bitmaps, got %d and %d bytes", rle, bitmap)
+	}
+}
+
+func TestDeleteSplitsRunLengthEncodedPage(t *testing.T) {
+	const Points = 3000
+	var c *config.Config
+	e := openTestEngineWith(t, Points, func(conf *config.Config) {
+		conf.PageConfig.PageSize = 256
+		conf.ParquetConfig.RowGroupSize = Points
+		conf.ParquetConfig.DeleteEncoding = "rle"
+		conf.TimeWindowConfig.Duration = 4 * Points
+		c = conf
+	})
+	ts := internal.NewTimeSeries("cpu", internal.Tags{})
+	start := windowStart(c, 2*Points)
+	samples := make([]*internal.Sample, 0, Points)
+	for i := uint64(0); i < Points; i++ {
+		samples = append(samples, internal.NewSample(ts, internal.NewPointAt(float64(i), start+i)))
+	}
+	if err := e.PutBatch(samples); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenEngine(t, e, c)
+
+	deletePaths, err := filepath.Glob(filepath.Join(c.WindowsDirPath, "*", "*", "rowgroup0000", "delete.db"))
+	if err != nil || len(deletePaths) != 1 {
+		t.Fatalf("Expected a row group, got %v (%v)", deletePaths, err)
+	}
+	pages := func() int64 {
+		t.Helper()
+		info, err := os.Stat(deletePaths[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size() / int64(c.PageConfig.PageSize)
+	}
+	if n := pages(); n != 1 {
+		t.Fatalf("Expected rows without deletions in a page, got %d pages", n)
+	}
+
+	// runs of every fifth point don't fit a page, nor do the bits of all rows
+	deleted := 0
+	for i := uint64(0); i < Points; i += 5 {
+		if err = e.DeleteRange(ts, start+i, start+i); err != nil {
+			t.Fatal(err)
+		}
+		deleted++
+	}
+	if n := pages(); n < 2 {
+		t.Errorf("Expected delete column to be split, got %d pages", n)
+	}
+
+	e = reopenEngine(t, e, c)
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != Points-deleted {
+		t.Fatalf("Expected %d points, got %d", Points-deleted, len(points))
+	}
+	for _, p := range points {
+		if (p.Timestamp-start)%5 == 0 || p.Value != float64(p.Timestamp-start) {
+			t.Fatalf("Unexpected point %+v", p)
+		}
+	}
+}
+
+func TestRowGroupWithoutDeletionsSkipsDeleteColumn(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 4, func(conf *config.Config) {
+		c = conf
+	})
+	ts := internal.NewTimeSeries("cpu", internal.Tags{})
+	now := internal.Seconds.Now()
+	for i := uint64(0); i < 6; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), now-10+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = reopenEngine(t, e, c)
+
+	// delete columns of row groups without deletions are never read
+	removed := 0
+	err := filepath.WalkDir(c.WindowsDirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Name() != "delete.db" {
+			return err
+		}
+		removed++
+		return os.Remove(path)
+	})
+	if err != nil || removed == 0 {
+		t.Fatalf("Expected delete columns to be removed, got %d (%v)", removed, err)
+	}
+
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 6 {
+		t.Errorf("Expected 6 points, got %d", len(points))
+	}
+}
@@ -0,0 +1,369 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk/page"
+	"time-series-engine/internal/disk/parquet"
+)
+
+func openTestEngine(t *testing.T, memtableSize uint64) *engine.Engine {
+	t.Helper()
+	return openTestEngineWith(t, memtableSize, nil)
+}
+
+func openTestEngineWith(t *testing.T, memtableSize uint64, configure func(c *config.Config)) *engine.Engine {
+	t.Helper()
+
+	dir := t.TempDir()
+	c := config.Default()
+	c.MemTableConfig.MaxSize = memtableSize
+	c.EngineConfig.RetentionPeriod = 1
+	c.EngineConfig.PeriodType = "day"
+	c.TimeWindowConfig.WindowsDirPath = filepath.Join(dir, "data")
+	c.WALConfig.LogsDirPath = filepath.Join(dir, "logs")
+	if configure != nil {
+		configure(c)
+	}
+
+	e, err := engine.Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = e.Close()
+	})
+	return e
+}
+
+// windowStart returns start of the time window at least ago seconds before now,
+// so points written shortly after it share the window
+func windowStart(c *config.Config, ago uint64) uint64 {
+	start := internal.Seconds.Now() - ago
+	return start - start%c.TimeWindowConfig.Duration
+}
+
+// openEngineWithExpiredPoint returns engine with two points of each series on disk in windows of
+// a second, one of which is out of the retention period of a day once it is returned
+func openEngineWithExpiredPoint(t *testing.T, series ...*internal.TimeSeries) *engine.Engine {
+	t.Helper()
+
+	var c *config.Config
+	e := openTestEngineWith(t, 2, func(conf *config.Config) {
+		conf.TimeWindowConfig.Duration = 1
+		c = conf
+	})
+	retention := uint64(24 * 60 * 60)
+	now := internal.Seconds.Now()
+	for i, ts := range series {
+		for _, timestamp := range []uint64{now - retention + 1, now} {
+			if err := e.Put(ts, internal.NewPointAt(float64(i+1), timestamp)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	e = reopenEngine(t, e, c)
+
+	for internal.Seconds.Now()-retention <= now-retention+1 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return e
+}
+
+func TestAggregateSkipsExpiredPoints(t *testing.T) {
+	ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a")})
+	e := openEngineWithExpiredPoint(t, ts)
+
+	result, err := e.Aggregate(ts, 0, math.MaxUint64, engine.COUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != 1 {
+		t.Errorf("Expected only the point in retention to be counted, got %v", result.Value)
+	}
+
+	matching, err := e.AggregateMatching("cpu", nil, 0, math.MaxUint64, engine.COUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matching) != 1 || matching[0].Result.Value != 1 {
+		t.Errorf("Expected only the point in retention to be counted, got %v", matching)
+	}
+}
+
+func TestEngineQueryAndAggregate(t *testing.T) {
+	e := openTestEngine(t, 3)
+	ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a")})
+
+	// points written at the same timestamp replace each other, so each gets its own
+	now := internal.Seconds.Now()
+	values := []float64{4, 1, 7, 3, 5}
+	for i, v := range values {
+		if err := e.Put(ts, internal.NewPointAt(v, now-uint64(len(values)-i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != len(values) {
+		t.Fatalf("Expected %d points, got %d", len(values), len(points))
+	}
+
+	expected := map[string]float64{engine.MIN: 1, engine.MAX: 7, engine.AVG: 4}
+	for function, want := range expected {
+		result, err := e.Aggregate(ts, 0, math.MaxUint64, function)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Found || result.Value != want {
+			t.Errorf("%s: expected %v, got %v (found %v)", function, want, result.Value, result.Found)
+		}
+	}
+
+	err = e.DeleteRange(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := e.Aggregate(ts, 0, math.MaxUint64, engine.MAX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Found {
+		t.Errorf("Expected no points after delete, got %v", result.Value)
+	}
+}
+
+func TestEngineBackfill(t *testing.T) {
+	e := openTestEngine(t, 4)
+	ts := internal.NewTimeSeries("temperature", internal.Tags{internal.NewTag("room", "1")})
+
+	now := uint64(time.Now().Unix())
+	// spans several time windows, arriving out of order
+	offsets := []uint64{0, 300, 30, 1000, 10, 600, 301, 5000, 2, 700, 20}
+	for _, offset := range offsets {
+		if err := e.Put(ts, internal.NewPointAt(float64(offset), now-offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != len(offsets) {
+		t.Fatalf("Expected %d points, got %d", len(offsets), len(points))
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i-1].Timestamp >= points[i].Timestamp {
+			t.Fatalf("Points are not sorted: %v before %v", points[i-1], points[i])
+		}
+	}
+	for _, point := range points {
+		if now-point.Timestamp != uint64(point.Value) {
+			t.Errorf("Point %v has a wrong value", point)
+		}
+	}
+
+	points, err = e.Query(ts, now-700, now-300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 4 {
+		t.Errorf("Expected 4 points in range, got %d", len(points))
+	}
+
+	result, err := e.Aggregate(ts, 0, math.MaxUint64, engine.MAX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != 5000 {
+		t.Errorf("Expected max 5000, got %v", result.Value)
+	}
+
+	err = e.Put(ts, internal.NewPointAt(1, now-2*24*60*60))
+	if err == nil {
+		t.Errorf("Expected point older than retention to be rejected")
+	}
+}
+
+func TestEngineMillisecondPrecision(t *testing.T) {
+	e := openTestEngineWith(t, 3, func(c *config.Config) {
+		c.EngineConfig.Precision = "ms"
+	})
+	ts := internal.NewTimeSeries("requests", internal.Tags{internal.NewTag("path", "/")})
+
+	now := e.Precision().Now()
+	// distinct points within the same second
+	for i := uint64(0); i < 7; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), now+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := e.Query(ts, now, now+6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 7 {
+		t.Fatalf("Expected 7 points, got %d", len(points))
+	}
+	for i, point := range points {
+		if point.Timestamp != now+uint64(i) {
+			t.Errorf("Expected timestamp %d, got %d", now+uint64(i), point.Timestamp)
+		}
+	}
+}
+
+func TestEngineRefusesMixedPrecision(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 1, func(conf *config.Config) {
+		c = conf
+	})
+	ts := internal.NewTimeSeries("requests", internal.Tags{internal.NewTag("path", "/")})
+	for _, ago := range []uint64{200, 100} {
+		if err := e.Put(ts, internal.NewPointAt(1, windowStart(c, ago))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the parquet of the last window has a different precision
+	parquets, err := filepath.Glob(filepath.Join(c.WindowsDirPath, "*", "parquet0000", "metadata.db"))
+	if err != nil || len(parquets) != 2 {
+		t.Fatalf("Expected two parquets, got %d (%v)", len(parquets), err)
+	}
+	pm := page.NewManager(c.PageConfig)
+	data, err := pm.ReadStructure(parquets[1], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := parquet.DeserializeParquetMetadata(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.Precision = internal.Milliseconds
+	if err = pm.WriteStructure(meta.Serialize(), parquets[1], 0); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := engine.Open(c)
+	if err == nil {
+		_ = reopened.Close()
+		t.Fatal("Expected data with a different precision to be refused")
+	}
+}
+
+func TestEnginePutBatch(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 7, func(conf *config.Config) {
+		// small pages and segments, so one batch spans several of them
+		conf.WALConfig.SegmentSizeInPages = 3
+		c = conf
+	})
+
+	now := internal.Seconds.Now()
+	samples := make([]*internal.Sample, 0)
+	for i := uint64(0); i < 50; i++ {
+		host := fmt.Sprintf("host%d", i%3)
+		ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", host)})
+		samples = append(samples, internal.NewSample(ts, internal.NewPointAt(float64(i), now-50+i)))
+	}
+	for i := 0; i < len(samples); i += 20 {
+		if err := e.PutBatch(samples[i:min(i+20, len(samples))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	countPoints := func(e *engine.Engine) int {
+		total := 0
+		for i := 0; i < 3; i++ {
+			ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", fmt.Sprintf("host%d", i))})
+			points, err := e.Query(ts, 0, math.MaxUint64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total += len(points)
+		}
+		return total
+	}
+
+	if n := countPoints(e); n != 50 {
+		t.Fatalf("Expected 50 points, got %d", n)
+	}
+
+	// points still in the memtable must be recovered from the write ahead log
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := engine.Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	if n := countPoints(reopened); n != 50 {
+		t.Fatalf("Expected 50 points after reopening, got %d", n)
+	}
+
+	expired := internal.NewSample(samples[0].TimeSeries, internal.NewPointAt(1, now-2*24*60*60))
+	if err := reopened.PutBatch([]*internal.Sample{samples[0], expired}); err == nil {
+		t.Errorf("Expected batch with an expired point to be rejected")
+	}
+}
+
+func TestEngineLosslessValues(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 2, func(conf *config.Config) {
+		conf.ParquetConfig.ValueEncoding = config.ValueEncodingLossless
+		conf.ParquetConfig.MeasurementValueEncodings = map[string]string{"rounded": config.ValueEncodingScaled}
+		c = conf
+	})
+	exact := internal.NewTimeSeries("exact", internal.Tags{})
+	rounded := internal.NewTimeSeries("rounded", internal.Tags{})
+
+	now := internal.Seconds.Now()
+	values := []float64{0.1234567891, 1e20 + 12345}
+	for i, v := range values {
+		for _, ts := range []*internal.TimeSeries{exact, rounded} {
+			if err := e.Put(ts, internal.NewPointAt(v, now-uint64(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// flushed to disk on close
+	e = reopenEngine(t, e, c)
+
+	points, err := e.Query(exact, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].Value != values[1] || points[1].Value != values[0] {
+		t.Errorf("Expected exact values %v, got %v", values, points)
+	}
+	sum, err := e.Aggregate(exact, 0, math.MaxUint64, engine.SUM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Value != values[0]+values[1] {
+		t.Errorf("Expected sum %v, got %v", values[0]+values[1], sum.Value)
+	}
+
+	points, err = e.Query(rounded, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[1].Value != 0.12345 {
+		t.Errorf("Expected values rounded to 5 decimals, got %v", points)
+	}
+}
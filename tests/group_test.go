@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/index"
+)
+
+func TestAggregateGroupBy(t *testing.T) {
+	// small memtable, so groups are merged from disk and memory
+	e := openTestEngine(t, 3)
+	now := internal.Seconds.Now()
+
+	sensors := []struct {
+		location string
+		sensor   string
+		values   []float64
+	}{
+		{"kitchen", "1", []float64{20, 22, 21}},
+		{"kitchen", "2", []float64{25, 19}},
+		{"garage", "1", []float64{10, 12, 14, 16}},
+		{"", "3", []float64{30}},
+	}
+	for _, s := range sensors {
+		tags := internal.Tags{internal.NewTag("sensor", s.sensor)}
+		if s.location != "" {
+			tags = append(tags, internal.NewTag("location", s.location))
+		}
+		ts := internal.NewTimeSeries("temperature", tags)
+		for i, v := range s.values {
+			if err := e.Put(ts, internal.NewPointAt(v, now-100+uint64(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	groups, err := e.AggregateGroupBy("temperature", nil, []string{"location"}, 0, math.MaxUint64, engine.MAX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		location string
+		value    float64
+	}{{"", 30}, {"garage", 16}, {"kitchen", 25}}
+	if len(groups) != len(expected) {
+		t.Fatalf("Expected %d groups, got %d", len(expected), len(groups))
+	}
+	for i, group := range groups {
+		if group.Tags[0].Name != "location" || group.Tags[0].Value != expected[i].location {
+			t.Errorf("Expected group location=%s, got %s=%s", expected[i].location, group.Tags[0].Name, group.Tags[0].Value)
+		}
+		if !group.Result.Found || group.Result.Value != expected[i].value {
+			t.Errorf("location=%s: expected %v, got %v", expected[i].location, expected[i].value, group.Result.Value)
+		}
+	}
+
+	// average is weighted by number of points of each series, not average of averages
+	kitchen, err := index.NewMatcher("location", index.Equal, "kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err = e.AggregateGroupBy("temperature", []*index.Matcher{kitchen}, []string{"location"}, 0, math.MaxUint64, engine.AVG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Result.Value != 21.4 {
+		t.Errorf("Expected kitchen average 21.4, got %v", groups)
+	}
+
+	// without group by tags all series are one group
+	groups, err = e.AggregateGroupBy("temperature", nil, nil, 0, math.MaxUint64, engine.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Tags) != 0 || groups[0].Result.Value != 10 {
+		t.Errorf("Expected single group with minimum 10, got %v", groups)
+	}
+
+	groups, err = e.AggregateGroupBy("temperature", nil, []string{"location"}, 0, now-200, engine.MAX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("Expected no groups outside of the range, got %d", len(groups))
+	}
+}
+
+func TestAggregateGroupBySkipsExpiredPoints(t *testing.T) {
+	a := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a"), internal.NewTag("dc", "eu")})
+	b := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "b"), internal.NewTag("dc", "eu")})
+	e := openEngineWithExpiredPoint(t, a, b)
+
+	result, err := e.AggregateGroupBy("cpu", nil, []string{"dc"}, 0, math.MaxUint64, engine.COUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Result.Value != 2 {
+		t.Fatalf("Expected only the points in retention to be counted, got %v", result)
+	}
+}
@@ -0,0 +1,425 @@
+package tests
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk/page"
+	"time-series-engine/internal/disk/parquet"
+	"time-series-engine/internal/index"
+)
+
+func indexTestSeries() []*internal.TimeSeries {
+	return []*internal.TimeSeries{
+		internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "web1"), internal.NewTag("dc", "eu")}),
+		internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "web2"), internal.NewTag("dc", "us")}),
+		internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "db1"), internal.NewTag("dc", "eu")}),
+		internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("dc", "us")}),
+		internal.NewTimeSeries("mem", internal.Tags{internal.NewTag("host", "web1")}),
+	}
+}
+
+func mustMatcher(t *testing.T, name, operator, value string) *index.Matcher {
+	t.Helper()
+	m, err := index.NewMatcher(name, operator, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func selectedHashes(series []*internal.TimeSeries) []string {
+	hashes := make([]string, 0, len(series))
+	for _, ts := range series {
+		hashes = append(hashes, ts.Hash)
+	}
+	return hashes
+}
+
+func TestIndexSelect(t *testing.T) {
+	idx := index.New(filepath.Join(t.TempDir(), "series.index"))
+	for _, ts := range indexTestSeries() {
+		idx.Add(ts)
+	}
+	// adding a series again changes nothing
+	idx.Add(indexTestSeries()[0])
+	if idx.Len() != 5 {
+		t.Fatalf("Expected 5 series, got %d", idx.Len())
+	}
+
+	tests := []struct {
+		name     string
+		matchers []*index.Matcher
+		expected []string
+	}{
+		{"all", nil, []string{"cpu|dc=eu|host=db1", "cpu|dc=eu|host=web1", "cpu|dc=us", "cpu|dc=us|host=web2"}},
+		{"equal", []*index.Matcher{mustMatcher(t, "host", index.Equal, "web1")}, []string{"cpu|dc=eu|host=web1"}},
+		{"not equal includes missing tag", []*index.Matcher{mustMatcher(t, "host", index.NotEqual, "web1")},
+			[]string{"cpu|dc=eu|host=db1", "cpu|dc=us", "cpu|dc=us|host=web2"}},
+		{"regex", []*index.Matcher{mustMatcher(t, "host", index.Regex, "web.*")},
+			[]string{"cpu|dc=eu|host=web1", "cpu|dc=us|host=web2"}},
+		{"regex is anchored", []*index.Matcher{mustMatcher(t, "host", index.Regex, "eb")}, []string{}},
+		{"several matchers", []*index.Matcher{
+			mustMatcher(t, "host", index.Regex, "web.*"),
+			mustMatcher(t, "dc", index.NotEqual, "eu"),
+		}, []string{"cpu|dc=us|host=web2"}},
+		{"unknown tag", []*index.Matcher{mustMatcher(t, "rack", index.Equal, "1")}, []string{}},
+	}
+
+	for _, test := range tests {
+		got := selectedHashes(idx.Select("cpu", test.matchers...))
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+
+	if _, err := index.NewMatcher("host", index.Regex, "web("); err == nil {
+		t.Error("Expected error for invalid regular expression")
+	}
+	if _, err := index.NewMatcher("host", "<", "web"); err == nil {
+		t.Error("Expected error for unknown operator")
+	}
+}
+
+func TestIndexSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "series.index")
+	if _, err := index.Load(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected not exist error, got %v", err)
+	}
+
+	idx := index.New(path)
+	for _, ts := range indexTestSeries() {
+		idx.Add(ts)
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := index.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mustMatcher(t, "host", index.Equal, "web1")
+	if !reflect.DeepEqual(selectedHashes(loaded.Select("mem", m)), selectedHashes(idx.Select("mem", m))) {
+		t.Errorf("Loaded index selects different series")
+	}
+	if loaded.Len() != idx.Len() {
+		t.Errorf("Expected %d series, got %d", idx.Len(), loaded.Len())
+	}
+
+	// IDs survive reload and new series continue after the last one
+	for _, ts := range indexTestSeries() {
+		id, ok := idx.ID(ts.Hash)
+		loadedID, loadedOk := loaded.ID(ts.Hash)
+		if !ok || !loadedOk || id != loadedID {
+			t.Errorf("%s: expected ID %d, got %d", ts.Hash, id, loadedID)
+		}
+		if byID, ok := loaded.ByID(loadedID); !ok || byID.Hash != ts.Hash {
+			t.Errorf("Expected series %s with ID %d", ts.Hash, loadedID)
+		}
+	}
+	extra := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "web1")})
+	loaded.Add(extra)
+	if id, _ := loaded.ID(extra.Hash); id != uint64(len(indexTestSeries())+1) {
+		t.Errorf("Expected ID %d for a new series, got %d", len(indexTestSeries())+1, id)
+	}
+}
+
+func TestIndexKeepsCopyOfSeries(t *testing.T) {
+	idx := index.New(filepath.Join(t.TempDir(), "series.index"))
+	ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "web1")})
+	idx.Add(ts)
+
+	// callers may reuse their series and tags after adding them
+	ts.MeasurementName = "mem"
+	ts.Tags[0].Value = "web2"
+	ts.Tags = append(ts.Tags, internal.NewTag("dc", "eu"))
+
+	selected := idx.Select("cpu", mustMatcher(t, "host", index.Equal, "web1"))
+	if len(selected) != 1 || selected[0].MeasurementName != "cpu" || len(selected[0].Tags) != 1 || selected[0].Tags[0].Value != "web1" {
+		t.Errorf("Expected indexed series cpu with host=web1, got %v", selected)
+	}
+}
+
+func TestIndexCatalog(t *testing.T) {
+	idx := index.New(filepath.Join(t.TempDir(), "series.index"))
+	for _, ts := range indexTestSeries() {
+		idx.Add(ts)
+	}
+
+	if got := idx.Measurements(); !reflect.DeepEqual(got, []string{"cpu", "mem"}) {
+		t.Errorf("Unexpected measurements: %v", got)
+	}
+	if got := idx.TagKeys("cpu"); !reflect.DeepEqual(got, []string{"dc", "host"}) {
+		t.Errorf("Unexpected tag keys: %v", got)
+	}
+	if got := idx.TagValues("cpu", "host"); !reflect.DeepEqual(got, []string{"db1", "web1", "web2"}) {
+		t.Errorf("Unexpected tag values: %v", got)
+	}
+	if got := idx.TagValues("mem", "dc"); len(got) != 0 {
+		t.Errorf("Expected no values, got %v", got)
+	}
+}
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"host=web1", "host=web1"},
+		{"host!=web1", "host!=web1"},
+		{"host=~web.*", "host=~web.*"},
+		{"host=", "host="},
+	}
+	for _, test := range tests {
+		m, err := index.ParseMatcher(test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if m.String() != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, m)
+		}
+	}
+
+	for _, input := range []string{"host", "=web1", "!=web1", "host=~("} {
+		if _, err := index.ParseMatcher(input); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestEngineQueryMatching(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 3, func(conf *config.Config) {
+		c = conf
+	})
+
+	now := internal.Seconds.Now()
+	for i, ts := range indexTestSeries() {
+		for j := uint64(0); j < 4; j++ {
+			if err := e.Put(ts, internal.NewPointAt(float64(i), now-10+j)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	check := func(e *engine.Engine) {
+		t.Helper()
+
+		result, err := e.QueryMatching("cpu", []*index.Matcher{mustMatcher(t, "dc", index.Equal, "eu")}, 0, math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 2 {
+			t.Fatalf("Expected 2 series, got %d", len(result))
+		}
+		for _, series := range result {
+			if len(series.Points) != 4 {
+				t.Errorf("%s: expected 4 points, got %d", series.TimeSeries.Hash, len(series.Points))
+			}
+		}
+
+		aggregations, err := e.AggregateMatching("cpu", []*index.Matcher{mustMatcher(t, "host", index.Regex, "web.*")},
+			0, math.MaxUint64, engine.MAX)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(aggregations) != 2 || aggregations[0].Result.Value != 0 || aggregations[1].Result.Value != 1 {
+			t.Errorf("Unexpected aggregations: %v", aggregations)
+		}
+	}
+
+	check(e)
+	e = reopenEngine(t, e, c)
+	check(e)
+
+	// index is rebuilt from disk and the log when it is missing
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(filepath.Dir(c.WindowsDirPath), "series.index")); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenEngine(t, e, c)
+	check(e)
+	if got := len(e.Series("cpu")); got != 4 {
+		t.Errorf("Expected 4 cpu series after rebuild, got %d", got)
+	}
+	if got := e.Measurements(); !reflect.DeepEqual(got, []string{"cpu", "mem"}) {
+		t.Errorf("Unexpected measurements after rebuild: %v", got)
+	}
+	for _, ts := range indexTestSeries() {
+		id, ok := e.SeriesID(ts)
+		if !ok {
+			t.Errorf("%s: expected an ID after rebuild", ts.Hash)
+			continue
+		}
+		if byID, _ := e.SeriesByID(id); byID == nil || byID.Hash != ts.Hash {
+			t.Errorf("Expected series %s with ID %d", ts.Hash, id)
+		}
+	}
+}
+
+func TestIndexRebuildWithSeparatorsInTags(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 2, func(conf *config.Config) {
+		c = conf
+	})
+	// hashes of these series were the same before separators were escaped
+	joined := internal.NewTimeSeries("disk|io", internal.Tags{internal.NewTag("path", "a|b=c")})
+	split := internal.NewTimeSeries("disk|io", internal.Tags{internal.NewTag("path", "a"), internal.NewTag("b", "c")})
+	if joined.Hash == split.Hash {
+		t.Fatalf("Expected different hashes, got %s", joined.Hash)
+	}
+	now := windowStart(c, 100) + 10
+	for i, ts := range []*internal.TimeSeries{joined, split} {
+		for j := uint64(0); j < 2; j++ {
+			if err := e.Put(ts, internal.NewPointAt(float64(i), now+j)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(filepath.Dir(c.WindowsDirPath), "series.index")); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenEngine(t, e, c)
+
+	if got := e.Measurements(); !reflect.DeepEqual(got, []string{"disk|io"}) {
+		t.Errorf("Unexpected measurements after rebuild: %v", got)
+	}
+	if got := e.TagValues("disk|io", "path"); !reflect.DeepEqual(got, []string{"a", "a|b=c"}) {
+		t.Errorf("Unexpected tag values after rebuild: %v", got)
+	}
+	for i, ts := range []*internal.TimeSeries{joined, split} {
+		selected := e.Series("disk|io", mustMatcher(t, "path", index.Equal, ts.Tags[len(ts.Tags)-1].Value))
+		if len(selected) != 1 || selected[0].Hash != ts.Hash || !reflect.DeepEqual(selected[0].Tags, ts.Tags) {
+			t.Fatalf("Expected series %s, got %v", ts.Hash, selected)
+		}
+		points, err := e.Query(selected[0], 0, math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 2 || points[0].Value != float64(i) {
+			t.Errorf("%s: unexpected points %v", ts.Hash, points)
+		}
+	}
+}
+
+func TestLegacySeriesHashIsMigrated(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 2, func(conf *config.Config) {
+		c = conf
+	})
+	ts := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("used", "50%")})
+	now := windowStart(c, 100) + 10
+	for i := uint64(0); i < 2; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), now+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// metadata as written before separators in hashes were escaped, without the marker
+	metaPaths, err := filepath.Glob(filepath.Join(c.WindowsDirPath, "*", "parquet0000", "metadata.db"))
+	if err != nil || len(metaPaths) != 1 {
+		t.Fatalf("Expected one parquet, got %d (%v)", len(metaPaths), err)
+	}
+	pm := page.NewManager(c.PageConfig)
+	data, err := pm.ReadStructure(metaPaths[0], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := parquet.DeserializeParquetMetadata(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.TimeSeriesHash = "disk|used=50%"
+	legacy := meta.Serialize()
+	if err = pm.WriteStructure(legacy[:len(legacy)-1], metaPaths[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(filepath.Join(filepath.Dir(c.WindowsDirPath), "series.index")); err != nil {
+		t.Fatal(err)
+	}
+
+	e = reopenEngine(t, e, c)
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 {
+		t.Errorf("Expected 2 points of the migrated series, got %d", len(points))
+	}
+	selected := e.Series("disk", mustMatcher(t, "used", index.Equal, "50%"))
+	if len(selected) != 1 || selected[0].Hash != ts.Hash {
+		t.Errorf("Expected series %s after rebuild, got %v", ts.Hash, selected)
+	}
+
+	data, err = pm.ReadStructure(metaPaths[0], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta, err = parquet.DeserializeParquetMetadata(data); err != nil || !meta.EscapedHash || meta.TimeSeriesHash != ts.Hash {
+		t.Errorf("Expected metadata with hash %s, got %+v (%v)", ts.Hash, meta, err)
+	}
+}
+
+func TestIndexRecoversSeriesFromLog(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 1000, func(conf *config.Config) {
+		c = conf
+	})
+	indexPath := filepath.Join(filepath.Dir(c.WindowsDirPath), "series.index")
+	a := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a")})
+	b := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "b")})
+	now := internal.Seconds.Now()
+
+	if err := e.Put(a, internal.NewPointAt(1, now-10)); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenEngine(t, e, c)
+	saved, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b is written only to the log, and the engine crashes before the index is saved again
+	if err = e.Put(b, internal.NewPointAt(2, now-5)); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(indexPath, saved, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(e *engine.Engine) {
+		t.Helper()
+		result, err := e.QueryMatching("cpu", []*index.Matcher{mustMatcher(t, "host", index.Equal, "b")}, 0, math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != 1 || result[0].TimeSeries.Hash != b.Hash || len(result[0].Points) != 1 {
+			t.Fatalf("Expected a point of %s replayed from the log, got %v", b.Hash, result)
+		}
+		if got := len(e.Series("cpu")); got != 2 {
+			t.Errorf("Expected 2 series, got %d", got)
+		}
+	}
+	e = reopenEngine(t, e, c)
+	check(e)
+	e = reopenEngine(t, e, c)
+	check(e)
+}
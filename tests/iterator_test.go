@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"testing"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk"
+)
+
+func TestMergeIterator(t *testing.T) {
+	a := disk.NewSliceIterator([]*internal.Point{internal.NewPointAt(1, 1), internal.NewPointAt(3, 3), internal.NewPointAt(5, 5)})
+	b := disk.NewSliceIterator([]*internal.Point{internal.NewPointAt(2, 2), internal.NewPointAt(30, 3)})
+	empty := disk.NewSliceIterator(nil)
+
+	points, err := disk.Collect(disk.NewMergeIterator(a, empty, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// of equal timestamps the point of the later source wins
+	expected := []float64{1, 2, 30, 5}
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points, got %d", len(expected), len(points))
+	}
+	for i, p := range points {
+		if p.Value != expected[i] {
+			t.Errorf("Point %d: expected %v, got %v", i, expected[i], p.Value)
+		}
+	}
+}
+
+func TestEngineIterator(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 4, func(conf *config.Config) {
+		conf.ParquetConfig.RowGroupSize = 3
+		c = conf
+	})
+	ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a")})
+
+	now := internal.Seconds.Now()
+	start := now - 100
+	// later flushes backfill older timestamps, so row groups of the parquet overlap
+	offsets := []uint64{10, 12, 14, 16, 11, 13, 15, 17, 1, 20, 2, 21, 30}
+	for _, offset := range offsets {
+		if err := e.Put(ts, internal.NewPointAt(float64(offset), start+offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = reopenEngine(t, e, c)
+	// the last points stay in memory
+	for _, offset := range []uint64{3, 18} {
+		if err := e.Put(ts, internal.NewPointAt(float64(offset), start+offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it, err := e.Iterator(ts, start+2, start+21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{2, 3, 10, 11, 12, 13, 14, 15, 16, 17, 18, 20, 21}
+	i := 0
+	for it.Next() {
+		if i < len(expected) && it.At().Value != expected[i] {
+			t.Errorf("Point %d: expected %v, got %v", i, expected[i], it.At().Value)
+		}
+		i++
+	}
+	if err = it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(expected) {
+		t.Errorf("Expected %d points, got %d", len(expected), i)
+	}
+	if err = it.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing the iterator early releases the disk, so deletes don't wait for it
+	it, err = e.Iterator(ts, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() || it.At().Value != 1 {
+		t.Fatalf("Expected first point 1, got %v", it.At())
+	}
+	if err = it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.DeleteRange(ts, start+10, start+17); err != nil {
+		t.Fatal(err)
+	}
+	points, err := e.Query(ts, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != len(offsets)+2-8 {
+		t.Errorf("Expected %d points after delete, got %d", len(offsets)+2-8, len(points))
+	}
+}
+
+func TestQueryLastWriteWins(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 4, func(conf *config.Config) {
+		conf.ParquetConfig.RowGroupSize = 3
+		c = conf
+	})
+	ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a")})
+	start := windowStart(c, 100)
+
+	put := func(value float64, offset uint64) {
+		t.Helper()
+		if err := e.Put(ts, internal.NewPointAt(value, start+offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(expected map[uint64]float64) {
+		t.Helper()
+		points, err := e.Query(ts, start, start+100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != len(expected) {
+			t.Fatalf("Expected %d points, got %v", len(expected), points)
+		}
+		sum := 0.0
+		for _, p := range points {
+			if want := expected[p.Timestamp-start]; p.Value != want {
+				t.Errorf("Timestamp %d: expected %v, got %v", p.Timestamp-start, want, p.Value)
+			}
+			sum += p.Value
+		}
+
+		// aggregations see the same points as queries
+		for function, want := range map[string]float64{engine.COUNT: float64(len(expected)), engine.SUM: sum} {
+			result, err := e.Aggregate(ts, start, start+100, function)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Value != want {
+				t.Errorf("%s: expected %v, got %v", function, want, result.Value)
+			}
+		}
+	}
+	checkRowGroups := func(expected int) {
+		t.Helper()
+		stats, err := e.Inspect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Parquets != 1 || stats.RowGroups != expected {
+			t.Fatalf("Expected a parquet with %d row groups, got %+v", expected, stats)
+		}
+	}
+
+	// full memtable is flushed to row groups [1 2 3] and [4]
+	for offset := uint64(1); offset <= 4; offset++ {
+		put(float64(offset), offset)
+	}
+	e = reopenEngine(t, e, c)
+	checkRowGroups(2)
+
+	// rewrites are flushed to later row groups [2 3 5] and [6], which overlap the older ones
+	put(20, 2)
+	put(30, 3)
+	put(5, 5)
+	put(6, 6)
+	e = reopenEngine(t, e, c)
+	checkRowGroups(4)
+	check(map[uint64]float64{1: 1, 2: 20, 3: 30, 4: 4, 5: 5, 6: 6})
+
+	// point rewritten on disk and then twice in the memtable
+	put(31, 3)
+	put(32, 3)
+	check(map[uint64]float64{1: 1, 2: 20, 3: 32, 4: 4, 5: 5, 6: 6})
+	e = reopenEngine(t, e, c)
+	checkRowGroups(4)
+	check(map[uint64]float64{1: 1, 2: 20, 3: 32, 4: 4, 5: 5, 6: 6})
+
+	// the newest row groups [2 3 7] and [8] win once they are all on disk
+	put(21, 2)
+	put(7, 7)
+	put(8, 8)
+	e = reopenEngine(t, e, c)
+	checkRowGroups(6)
+	check(map[uint64]float64{1: 1, 2: 21, 3: 32, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8})
+}
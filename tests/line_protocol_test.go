@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time-series-engine/internal"
+	"time-series-engine/internal/line_protocol"
+)
+
+func TestParseLine(t *testing.T) {
+	line := `weather,location=us\,midwest,season=summer temperature=82,humidity=71i,ok=true,note="a b",value=1.5 1465839830100400200`
+
+	samples, err := line_protocol.ParseLine(line, internal.Nanoseconds, internal.Seconds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(samples))
+	}
+
+	expected := []struct {
+		hash  string
+		value float64
+	}{
+		{"weather|_field=temperature|location=us,midwest|season=summer", 82},
+		{"weather|_field=humidity|location=us,midwest|season=summer", 71},
+		{"weather|location=us,midwest|season=summer", 1.5},
+	}
+	for i, s := range samples {
+		if s.TimeSeries.Hash != expected[i].hash {
+			t.Errorf("Expected series %s, got %s", expected[i].hash, s.TimeSeries.Hash)
+		}
+		if s.Point.Value != expected[i].value {
+			t.Errorf("Expected value %v, got %v", expected[i].value, s.Point.Value)
+		}
+		if s.Point.Timestamp != 1465839830 {
+			t.Errorf("Expected timestamp 1465839830, got %d", s.Point.Timestamp)
+		}
+	}
+}
+
+func TestParseLineFieldSeriesNames(t *testing.T) {
+	names := make(map[string]string)
+	for _, line := range []string{
+		"cpu usage=1 1",
+		"cpu_usage value=1 1",
+		"cpu.usage value=1 1",
+		`cpu\.usage value=1 1`,
+		"cpu.usage idle=1 1",
+		"cpu usage.idle=1 1",
+	} {
+		samples, err := line_protocol.ParseLine(line, internal.Seconds, internal.Seconds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := samples[0].TimeSeries
+		if other, ok := names[ts.Hash]; ok {
+			t.Errorf("Lines %q and %q are written to the same series %s", other, line, ts.Hash)
+		}
+		names[ts.Hash] = line
+
+		// exported line is parsed back into the same series
+		formatted := line_protocol.FormatLine(ts, samples[0].Point)
+		parsed, err := line_protocol.ParseLine(formatted, internal.Seconds, internal.Seconds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed[0].TimeSeries.Hash != ts.Hash {
+			t.Errorf("Expected %q to be parsed into %s, got %s", formatted, ts.Hash, parsed[0].TimeSeries.Hash)
+		}
+	}
+}
+
+func TestParseLineQuotesInSeriesKey(t *testing.T) {
+	samples, err := line_protocol.ParseLine(`c"pu,host=a"b,dc=x"y note="a b",value=1 1`, internal.Seconds, internal.Seconds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("Expected 1 sample, got %d", len(samples))
+	}
+	if hash := samples[0].TimeSeries.Hash; hash != `c"pu|dc=x"y|host=a"b` {
+		t.Errorf("Expected series %s, got %s", `c"pu|dc=x"y|host=a"b`, hash)
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	lines := []string{
+		"cpu",
+		"cpu value=abc",
+		"cpu,host value=1",
+		"cpu,_field=usage value=1",
+		`cpu note="unterminated`,
+		"cpu value=1 notatimestamp",
+	}
+	for _, line := range lines {
+		_, err := line_protocol.ParseLine(line, internal.Seconds, internal.Seconds)
+		if err == nil {
+			t.Errorf("Expected error for line %q", line)
+		}
+	}
+}
+
+func TestParserBatches(t *testing.T) {
+	input := "# comment\n\ncpu,host=a value=1 10\ncpu,host=a value=2 20\ncpu,host=a value=3 30\nmem used=4 40\n"
+	parser := line_protocol.NewParser(strings.NewReader(input), internal.Seconds, internal.Seconds)
+
+	var sizes []int
+	for {
+		batch, err := parser.NextBatch(3)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(batch))
+	}
+	if len(sizes) != 2 || sizes[0] != 3 || sizes[1] != 1 {
+		t.Errorf("Expected batches of 3 and 1 points, got %v", sizes)
+	}
+
+	parser = line_protocol.NewParser(strings.NewReader("cpu value=1 1\ncpu value=x 2\n"), internal.Seconds, internal.Seconds)
+	_, err := parser.NextBatch(10)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("Expected error on line 2, got %v", err)
+	}
+}
+
+func TestEngineWriteLineProtocol(t *testing.T) {
+	e := openTestEngine(t, 2)
+	now := internal.Seconds.Now()
+
+	var b strings.Builder
+	for i := uint64(0); i < 5; i++ {
+		fmt.Fprintf(&b, "cpu,host=a usage=%d %d\n", i, (now-10+i)*1000)
+	}
+
+	written, err := e.WriteLineProtocol(strings.NewReader(b.String()), internal.Milliseconds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 5 {
+		t.Fatalf("Expected 5 written points, got %d", written)
+	}
+
+	ts := internal.NewTimeSeries("cpu", internal.Tags{
+		internal.NewTag("host", "a"),
+		internal.NewTag(line_protocol.FieldTag, "usage"),
+	})
+	points, err := e.Query(ts, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 5 {
+		t.Fatalf("Expected 5 points, got %d", len(points))
+	}
+	if points[0].Timestamp != now-10 || points[4].Value != 4 {
+		t.Errorf("Unexpected points %v %v", points[0], points[4])
+	}
+}
+
+func TestEngineWriteLineProtocolValueField(t *testing.T) {
+	e := openTestEngine(t, 2)
+	now := internal.Seconds.Now()
+
+	line := fmt.Sprintf("cpu.load value=1 %d\n", now)
+	if _, err := e.WriteLineProtocol(strings.NewReader(line), internal.Seconds); err != nil {
+		t.Fatal(err)
+	}
+
+	// value field is stored under the measurement name as written
+	points, err := e.Query(internal.NewTimeSeries("cpu.load", internal.NewTags()), 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Value != 1 {
+		t.Errorf("Expected point with value 1 in series cpu.load, got %v", points)
+	}
+}
@@ -2,52 +2,56 @@ package tests
 
 import (
 	"testing"
-	"time"
 	"time-series-engine/internal"
 	"time-series-engine/internal/memory"
 )
 
-func createTestPoint(ts string, value float64) *internal.Point {
+func createTestSeries(measurement string) *internal.TimeSeries {
 	tags := internal.Tags{
-		*internal.NewTag("host", "server1"),
+		internal.NewTag("host", "server1"),
+	}
+	return internal.NewTimeSeries(measurement, tags)
+}
+
+func createTestPoint(timestamp uint64, value float64) *internal.Point {
+	return &internal.Point{
+		Timestamp: timestamp,
+		Value:     value,
 	}
-	timeSeries := internal.NewTimeSeries(ts, tags)
-	point := internal.NewPoint(value, timeSeries)
-	return &point
 }
 
 func TestWritePointWithFlush(t *testing.T) {
 	mem := memory.NewMemTable(2)
+	ts := createTestSeries("cpu")
 
-	p1 := createTestPoint("cpu", 1.0)
-	p2 := createTestPoint("cpu", 2.0)
-	p3 := createTestPoint("cpu", 3.0)
+	p1 := createTestPoint(1, 1.0)
+	p2 := createTestPoint(2, 2.0)
+	p3 := createTestPoint(3, 3.0)
 
-	flush1 := mem.WritePointWithFlush(p1)
+	flush1 := mem.WritePointWithFlush(ts, p1)
 	if len(flush1) != 0 {
-		t.Errorf("Expected no flush on first insert, got %d points", len(flush1))
+		t.Errorf("Expected no flush on first insert, got %d series", len(flush1))
 	}
 
-	flush2 := mem.WritePointWithFlush(p2)
-	if len(flush2) != 0 {
-		t.Errorf("Expected no flush on second insert, got %d points", len(flush2))
+	flush2 := mem.WritePointWithFlush(ts, p2)
+	if len(flush2[ts.Hash]) != 2 {
+		t.Errorf("Expected flush of 2 points on second insert, got %d", len(flush2[ts.Hash]))
 	}
 
-	flush3 := mem.WritePointWithFlush(p3)
-	if len(flush3) != 2 {
-		t.Errorf("Expected flush of 2 points on third insert, got %d", len(flush3))
+	flush3 := mem.WritePointWithFlush(ts, p3)
+	if len(flush3) != 0 {
+		t.Errorf("Expected no flush on third insert, got %d series", len(flush3))
 	}
 }
 
 func TestGetSortedPoints(t *testing.T) {
 	mem := memory.NewMemTable(5)
+	ts := createTestSeries("cpu")
 
-	p1 := createTestPoint("cpu", 1.0)
-	p2 := createTestPoint("cpu", 2.0)
-	mem.WritePointWithFlush(p1)
-	mem.WritePointWithFlush(p2)
+	mem.WritePointWithFlush(ts, createTestPoint(1, 1.0))
+	mem.WritePointWithFlush(ts, createTestPoint(2, 2.0))
 
-	points, err := mem.GetSortedPoints(p1.TimeSeries)
+	points, err := mem.GetSortedPoints(ts)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -59,24 +63,43 @@ func TestGetSortedPoints(t *testing.T) {
 	}
 }
 
+func TestRewriteReplacesPoint(t *testing.T) {
+	mem := memory.NewMemTable(3)
+	ts := createTestSeries("cpu")
+
+	mem.WritePointWithFlush(ts, createTestPoint(1, 1.0))
+	mem.WritePointWithFlush(ts, createTestPoint(2, 2.0))
+	flushed := mem.WritePointWithFlush(ts, createTestPoint(1, 10.0))
+	if len(flushed) != 0 {
+		t.Fatalf("Expected no flush after rewriting a point, got %d series", len(flushed))
+	}
+
+	points, err := mem.GetSortedPoints(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].Value != 10.0 || points[1].Value != 2.0 {
+		t.Errorf("Expected the rewritten point to replace the old one, got %v", points)
+	}
+}
+
 func TestDeleteRange(t *testing.T) {
 	mem := memory.NewMemTable(5)
+	ts := createTestSeries("cpu")
 
-	p1 := createTestPoint("cpu", 1.0)
-	time.Sleep(1 * time.Second)
-	p2 := createTestPoint("cpu", 2.0)
-	time.Sleep(1 * time.Second)
-	p3 := createTestPoint("cpu", 3.0)
+	p1 := createTestPoint(1, 1.0)
+	p2 := createTestPoint(2, 2.0)
+	p3 := createTestPoint(3, 3.0)
 
-	mem.WritePointWithFlush(p1)
-	mem.WritePointWithFlush(p2)
-	mem.WritePointWithFlush(p3)
+	mem.WritePointWithFlush(ts, p1)
+	mem.WritePointWithFlush(ts, p2)
+	mem.WritePointWithFlush(ts, p3)
 
-	mem.DeleteRange(p1.TimeSeries, p2.Timestamp, p3.Timestamp)
+	mem.DeleteRange(ts, p2.Timestamp, p3.Timestamp)
 
-	points, _ := mem.GetSortedPoints(p1.TimeSeries)
+	points, _ := mem.GetSortedPoints(ts)
 	if len(points) != 1 {
-		t.Errorf("Expected 1 point after delete, got %d", len(points))
+		t.Fatalf("Expected 1 point after delete, got %d", len(points))
 	}
 	if points[0].Value != 1.0 {
 		t.Errorf("Expected remaining point to have value 1.0")
@@ -85,20 +108,20 @@ func TestDeleteRange(t *testing.T) {
 
 func TestMinAndMaxTimestamp(t *testing.T) {
 	mem := memory.NewMemTable(5)
+	ts := createTestSeries("cpu")
 
-	p1 := createTestPoint("cpu", 1.0)
-	time.Sleep(1 * time.Second)
-	p2 := createTestPoint("cpu", 2.0)
+	p1 := createTestPoint(1, 1.0)
+	p2 := createTestPoint(2, 2.0)
 
-	mem.WritePointWithFlush(p1)
-	mem.WritePointWithFlush(p2)
+	mem.WritePointWithFlush(ts, p1)
+	mem.WritePointWithFlush(ts, p2)
 
-	mint, err := mem.MinTimestamp(p1.TimeSeries)
+	mint, err := mem.MinTimestamp(ts)
 	if err != nil || mint != p1.Timestamp {
 		t.Errorf("Expected min timestamp %d, got %d", p1.Timestamp, mint)
 	}
 
-	maxt, err := mem.MaxTimestamp(p1.TimeSeries)
+	maxt, err := mem.MaxTimestamp(ts)
 	if err != nil || maxt != p2.Timestamp {
 		t.Errorf("Expected max timestamp %d, got %d", p2.Timestamp, maxt)
 	}
@@ -106,24 +129,52 @@ func TestMinAndMaxTimestamp(t *testing.T) {
 
 func TestListTimeSeries(t *testing.T) {
 	mem := memory.NewMemTable(5)
+	cpu := createTestSeries("cpu")
+	ram := createTestSeries("mem")
 
-	p1 := createTestPoint("cpu", 1.0)
-	p2 := createTestPoint("mem", 2.0)
+	p1 := createTestPoint(1, 1.0)
+	p2 := createTestPoint(2, 2.0)
 
-	mem.WritePointWithFlush(p1)
-	mem.WritePointWithFlush(p2)
+	mem.WritePointWithFlush(cpu, p1)
+	mem.WritePointWithFlush(ram, p2)
 
 	start := p1.Timestamp
 	end := p2.Timestamp
 
-	seriesMap := mem.List(start, end)
-	if len(seriesMap) != 2 {
-		t.Errorf("Expected 2 series in range, got %d", len(seriesMap))
-	}
-	if len(seriesMap[p1.TimeSeries.Key()]) != 1 {
+	if len(mem.List(cpu, start, end)) != 1 {
 		t.Errorf("Expected 1 point in cpu series")
 	}
-	if len(seriesMap[p2.TimeSeries.Key()]) != 1 {
+	if len(mem.List(ram, start, end)) != 1 {
 		t.Errorf("Expected 1 point in mem series")
 	}
 }
+
+func TestOutOfOrderInsert(t *testing.T) {
+	mem := memory.NewMemTable(10)
+	ts := createTestSeries("cpu")
+
+	for _, timestamp := range []uint64{5, 1, 4, 2, 6, 3} {
+		mem.WritePointWithFlush(ts, createTestPoint(timestamp, float64(timestamp)))
+	}
+
+	points, err := mem.GetSortedPoints(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, point := range points {
+		if point.Timestamp != uint64(i+1) {
+			t.Fatalf("Expected timestamp %d at position %d, got %d", i+1, i, point.Timestamp)
+		}
+	}
+
+	mem.DeleteRange(ts, 2, 4)
+	if len(mem.List(ts, 0, 10)) != 3 {
+		t.Errorf("Expected 3 points after delete, got %d", len(mem.List(ts, 0, 10)))
+	}
+
+	minValue, _, _ := mem.Aggregate(ts, 0, 10, "Min")
+	maxValue, _, _ := mem.Aggregate(ts, 0, 10, "Max")
+	if minValue != 1 || maxValue != 6 {
+		t.Errorf("Expected min 1 and max 6, got %v and %v", minValue, maxValue)
+	}
+}
@@ -6,19 +6,20 @@ import (
 )
 
 func TestNewPoint(t *testing.T) {
-	tags := internal.Tags{
-		{Name: "env", Value: "prod"},
-	}
-
-	ts := internal.NewTimeSeries("cpu", tags)
-
-	point := internal.NewPoint(42.0, ts)
+	point := internal.NewPoint(42.0, internal.Seconds)
 
 	if point.Value != 42.0 {
 		t.Errorf("expected value 42.0, got %f", point.Value)
 	}
 
-	if point.TimeSeries.MeasurementName != "cpu" {
-		t.Errorf("expected measurement name cpu, got %s", point.TimeSeries.MeasurementName)
+	if point.Timestamp == 0 {
+		t.Errorf("expected point to be timestamped")
+	}
+
+	// timestamps are in the precision of the engine
+	before := internal.Milliseconds.Now()
+	point = internal.NewPoint(42.0, internal.Milliseconds)
+	if point.Timestamp < before || point.Timestamp > internal.Milliseconds.Now() {
+		t.Errorf("expected timestamp in milliseconds, got %d", point.Timestamp)
 	}
 }
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk/row_group"
+)
+
+func TestRowGroupMetadataStatistics(t *testing.T) {
+	m := row_group.NewMetadata(0)
+	for _, v := range []float64{1.5, -2, 4} {
+		m.Update(internal.NewPointAt(v, 1))
+	}
+	m.DeletedPoints = 1
+
+	loaded, err := row_group.DeserializeMetadata(m.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.HasStatistics || loaded.SumValue != 3.5 || loaded.DeletedPoints != 1 || loaded.PointsNumber != 3 {
+		t.Errorf("Unexpected statistics: %+v", loaded)
+	}
+
+	// row groups written before sum and deleted points were recorded
+	m.HasStatistics = false
+	loaded, err = row_group.DeserializeMetadata(m.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.HasStatistics || loaded.SumValue != 0 || loaded.MaxValue != 4 {
+		t.Errorf("Unexpected statistics of an old row group: %+v", loaded)
+	}
+}
+
+func TestAggregationPushdown(t *testing.T) {
+	var c *config.Config
+	e := openTestEngineWith(t, 4, func(conf *config.Config) {
+		conf.ParquetConfig.RowGroupSize = 3
+		c = conf
+	})
+	ts := internal.NewTimeSeries("disk", internal.Tags{internal.NewTag("host", "a")})
+
+	start := windowStart(c, 100)
+	// 12 points flushed to 4 row groups, with values 1 to 12
+	for i := uint64(1); i <= 12; i++ {
+		if err := e.Put(ts, internal.NewPointAt(float64(i), start+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = reopenEngine(t, e, c)
+
+	check := func(minTimestamp, maxTimestamp uint64, expected map[string]float64) {
+		t.Helper()
+		for function, want := range expected {
+			result, err := e.Aggregate(ts, minTimestamp, maxTimestamp, function)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Found || math.Abs(result.Value-want) > 1e-9 {
+				t.Errorf("%s in [%d, %d]: expected %v, got %v", function, minTimestamp-start, maxTimestamp-start, want, result.Value)
+			}
+		}
+	}
+
+	check(0, math.MaxUint64, map[string]float64{engine.MIN: 1, engine.MAX: 12, engine.SUM: 78, engine.COUNT: 12, engine.AVG: 6.5})
+	// boundaries inside the first and the last row group
+	check(start+2, start+11, map[string]float64{engine.MIN: 2, engine.MAX: 11, engine.SUM: 65, engine.COUNT: 10, engine.FIRST: 2})
+
+	// row groups with deleted points are read
+	if err := e.DeleteRange(ts, start+5, start+5); err != nil {
+		t.Fatal(err)
+	}
+	check(0, math.MaxUint64, map[string]float64{engine.SUM: 73, engine.COUNT: 11, engine.SPREAD: 11})
+	if err := e.DeleteRange(ts, start+1, start+1); err != nil {
+		t.Fatal(err)
+	}
+	check(0, math.MaxUint64, map[string]float64{engine.MIN: 2, engine.SUM: 72, engine.COUNT: 10})
+
+	// statistics of row groups inside the range are used without reading their values
+	err := filepath.Walk(c.WindowsDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Name() != "value.db" {
+			return err
+		}
+		if filepath.Base(filepath.Dir(path)) == filepath.Base(firstRowGroup(t, filepath.Dir(filepath.Dir(path)))) {
+			// the one with deleted points is still read
+			return nil
+		}
+		return os.WriteFile(path, make([]byte, info.Size()), 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pages read so far are cached
+	e = reopenEngine(t, e, c)
+	check(start+7, start+12, map[string]float64{engine.MIN: 7, engine.MAX: 12, engine.SUM: 57, engine.COUNT: 6})
+}
+
+// firstRowGroup returns path of the first row group directory of the parquet
+func firstRowGroup(t *testing.T, parquetPath string) string {
+	t.Helper()
+	entries, err := os.ReadDir(parquetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return filepath.Join(parquetPath, entry.Name())
+		}
+	}
+	t.Fatalf("No row groups in %s", parquetPath)
+	return ""
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/query"
+	"time-series-engine/server"
+)
+
+func TestParseQuery(t *testing.T) {
+	q, err := query.Parse(`select MAX(value) from cpu where host = 'a' and region =~ 'eu-.*' and time >= now() - 1h and time < 1700000000 group by time(1m), "data center" fill(previous)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Function != engine.MAX || q.Measurement != "cpu" || q.Interval != time.Minute || q.Fill != engine.FillPrevious {
+		t.Errorf("Unexpected query: %+v", q)
+	}
+	if len(q.Matchers) != 2 || q.Matchers[0].String() != "host=a" || !q.Matchers[1].Matches("eu-west") {
+		t.Errorf("Unexpected matchers: %v", q.Matchers)
+	}
+	if len(q.GroupBy) != 1 || q.GroupBy[0] != "data center" {
+		t.Errorf("Unexpected group by tags: %v", q.GroupBy)
+	}
+	if len(q.TimeConditions) != 2 {
+		t.Fatalf("Expected 2 time conditions, got %d", len(q.TimeConditions))
+	}
+	since, until := q.TimeConditions[0], q.TimeConditions[1]
+	if since.Operator != ">=" || !since.Time.Now || since.Time.Offset != -time.Hour {
+		t.Errorf("Unexpected condition: %s %+v", since.Operator, since.Time)
+	}
+	if until.Operator != "<" || until.Time.Now || until.Time.Timestamp != 1700000000 {
+		t.Errorf("Unexpected condition: %s %+v", until.Operator, until.Time)
+	}
+
+	q, err = query.Parse("SELECT percentile(value, 99.9) FROM mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Function != engine.Percentile(99.9) {
+		t.Errorf("Expected %s, got %s", engine.Percentile(99.9), q.Function)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	cases := []struct {
+		statement string
+		position  int
+	}{
+		{"SELECT value cpu", 13},
+		{"SELECT max(value) FROM cpu WHERE host = a", 40},
+		{"SELECT max(value) FROM cpu WHERE host = 'a' OR host = 'b'", 44},
+		{"SELECT max(value) FROM cpu WHERE time > now() - 5min", 48},
+		{"SELECT mode(value) FROM cpu", 7},
+		{"SELECT value FROM cpu GROUP BY host", 22},
+		{"SELECT max(value) FROM cpu WHERE host = 'a", 40},
+		{"SELECT max(value) FROM cpu FILL(null)", 27},
+		{"SELECT max(value) FROM cpu GROUP BY time(1m) LIMIT 1", 45},
+	}
+	for _, c := range cases {
+		_, err := query.Parse(c.statement)
+		var syntaxErr *query.Error
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: expected syntax error, got %v", c.statement, err)
+			continue
+		}
+		if syntaxErr.Pos != c.position {
+			t.Errorf("%q: expected error at %d, got %d (%v)", c.statement, c.position, syntaxErr.Pos, err)
+		}
+	}
+}
+
+func TestExecuteQuery(t *testing.T) {
+	e := openTestEngine(t, 4)
+	now := internal.Seconds.Now()
+	// aligned to minutes, so buckets are easy to follow
+	start := now - now%60 - 600
+
+	for _, s := range []struct {
+		host, region string
+		offsets      []uint64
+		values       []float64
+	}{
+		{"a", "eu", []uint64{0, 10, 130}, []float64{1, 5, 3}},
+		{"b", "eu", []uint64{20, 200}, []float64{7, 2}},
+		{"c", "us", []uint64{30}, []float64{100}},
+	} {
+		ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", s.host), internal.NewTag("region", s.region)})
+		for i, offset := range s.offsets {
+			if err := e.Put(ts, internal.NewPointAt(s.values[i], start+offset)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	result, err := e.Execute("SELECT value FROM cpu WHERE host = 'a'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Series) != 1 || len(result.Series[0].Rows) != 3 || result.Series[0].Rows[2].Value != 3 {
+		t.Errorf("Unexpected raw result: %+v", result.Series)
+	}
+
+	result, err = e.Execute("SELECT max(value) FROM cpu WHERE time >= now() - 1h GROUP BY region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Series) != 2 || result.Series[0].Rows[0].Value != 7 || result.Series[1].Rows[0].Value != 100 {
+		t.Errorf("Unexpected grouped result: %+v", result.Series)
+	}
+
+	// buckets of the whole region, the empty one in between filled
+	result, err = e.Execute(fmt.Sprintf("SELECT sum(value) FROM cpu WHERE region = 'eu' AND time >= %d AND time < %d GROUP BY time(1m) FILL(previous)", start, start+240))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(result.Series))
+	}
+	expected := []float64{13, 13, 3, 2}
+	if len(result.Series[0].Rows) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %d", len(expected), len(result.Series[0].Rows))
+	}
+	for i, want := range expected {
+		row := result.Series[0].Rows[i]
+		if row.Timestamp != start+uint64(i)*60 || !row.Found || row.Value != want {
+			t.Errorf("Bucket %d: expected %v at %d, got %+v", i, want, start+uint64(i)*60, row)
+		}
+	}
+
+	result, err = e.Execute("SELECT count(value) FROM cpu WHERE time > now()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Series) != 0 {
+		t.Errorf("Expected no groups in the future, got %+v", result.Series)
+	}
+}
+
+func TestServerSelect(t *testing.T) {
+	e := openTestEngine(t, 3)
+	srv := httptest.NewServer(server.New(e).Handler())
+	defer srv.Close()
+
+	ts := internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a")})
+	now := e.Precision().Now()
+	for i, v := range []float64{1, 4, 2} {
+		if err := e.Put(ts, internal.NewPointAt(v, now-uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(statement string, status int, response any) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/select?q=" + url.QueryEscape(statement))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("%q: expected status %d, got %d", statement, status, resp.StatusCode)
+		}
+		if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var result struct {
+		Series []struct {
+			Tags map[string]string `json:"tags"`
+			Rows []struct {
+				Value *float64 `json:"value"`
+			} `json:"rows"`
+		} `json:"series"`
+	}
+	get("SELECT max(value) FROM cpu GROUP BY host", http.StatusOK, &result)
+	if len(result.Series) != 1 || result.Series[0].Tags["host"] != "a" || *result.Series[0].Rows[0].Value != 4 {
+		t.Errorf("Unexpected response: %+v", result)
+	}
+
+	var failure struct {
+		Error    string `json:"error"`
+		Position int    `json:"position"`
+	}
+	get("SELECT max(value) FROM", http.StatusBadRequest, &failure)
+	if failure.Position != 23 {
+		t.Errorf("Expected error at position 23, got %d (%s)", failure.Position, failure.Error)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time-series-engine/server"
+)
+
+func TestServerWriteQueryAggregateDelete(t *testing.T) {
+	e := openTestEngine(t, 3)
+	srv := httptest.NewServer(server.New(e).Handler())
+	defer srv.Close()
+
+	now := e.Precision().Now()
+	batch := fmt.Sprintf(`[
+		{"measurement": "cpu", "tags": {"host": "a"}, "timestamp": %d, "value": 1},
+		{"measurement": "cpu", "tags": {"host": "a"}, "timestamp": %d, "value": 3},
+		{"measurement": "cpu", "tags": {"host": "a"}, "timestamp": %d, "value": 2},
+		{"measurement": "cpu", "tags": {"host": "b"}, "timestamp": %d, "value": 10}
+	]`, now-3, now-2, now-1, now-1)
+	resp, err := http.Post(srv.URL+"/write", "application/json", strings.NewReader(batch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for batch write, got %d", resp.StatusCode)
+	}
+
+	single := fmt.Sprintf(`{"measurement": "cpu", "tags": {"host": "a"}, "timestamp": %d, "value": 4}`, now)
+	resp, err = http.Post(srv.URL+"/write", "application/json", strings.NewReader(single))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for single write, got %d", resp.StatusCode)
+	}
+
+	var points []struct {
+		Timestamp uint64  `json:"timestamp"`
+		Value     float64 `json:"value"`
+	}
+	getJSON(t, srv.URL+"/query?measurement=cpu&tag=host=a", &points)
+	if len(points) != 4 {
+		t.Fatalf("Expected 4 points, got %d", len(points))
+	}
+
+	var aggregate struct {
+		Function string   `json:"function"`
+		Value    *float64 `json:"value"`
+	}
+	getJSON(t, fmt.Sprintf("%s/aggregate?measurement=cpu&tag=host=a&start=%d&function=Max", srv.URL, now-2), &aggregate)
+	if aggregate.Value == nil || *aggregate.Value != 4 {
+		t.Fatalf("Expected max 4, got %v", aggregate.Value)
+	}
+
+	deleteBody := fmt.Sprintf(`{"measurement": "cpu", "tags": {"host": "a"}, "start": 0, "end": %d}`, now-2)
+	resp, err = http.Post(srv.URL+"/delete", "application/json", strings.NewReader(deleteBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for delete, got %d", resp.StatusCode)
+	}
+
+	getJSON(t, srv.URL+"/query?measurement=cpu&tag=host=a", &points)
+	if len(points) != 2 {
+		t.Fatalf("Expected 2 points after delete, got %d", len(points))
+	}
+
+	resp, err = http.Get(srv.URL + "/query?tag=host=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without measurement, got %d", resp.StatusCode)
+	}
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: unexpected status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
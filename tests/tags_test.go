@@ -18,19 +18,19 @@ func TestNewTag(t *testing.T) {
 
 func TestTagsSort(t *testing.T) {
 	tags := internal.Tags{
-		*internal.NewTag("z", "3"),
-		*internal.NewTag("a", "2"),
-		*internal.NewTag("a", "1"),
-		*internal.NewTag("b", "1"),
+		internal.NewTag("z", "3"),
+		internal.NewTag("a", "2"),
+		internal.NewTag("a", "1"),
+		internal.NewTag("b", "1"),
 	}
 
 	tags.Sort()
 
 	expected := internal.Tags{
-		*internal.NewTag("a", "1"),
-		*internal.NewTag("a", "2"),
-		*internal.NewTag("b", "1"),
-		*internal.NewTag("z", "3"),
+		internal.NewTag("a", "1"),
+		internal.NewTag("a", "2"),
+		internal.NewTag("b", "1"),
+		internal.NewTag("z", "3"),
 	}
 
 	if !reflect.DeepEqual(tags, expected) {
@@ -40,16 +40,16 @@ func TestTagsSort(t *testing.T) {
 
 func TestTimeSeriesKey(t *testing.T) {
 	tags := internal.Tags{
-		*internal.NewTag("region", "us-west"),
-		*internal.NewTag("env", "staging"),
+		internal.NewTag("region", "us-west"),
+		internal.NewTag("env", "staging"),
 	}
 	ts := internal.NewTimeSeries("cpu_usage", tags)
 
-	// Key() sorts tags internally
-	key := ts.Key()
+	// hash is built from sorted tags
+	key := ts.Hash
 	expectedKey := "cpu_usage|env=staging|region=us-west"
 
 	if key != expectedKey {
-		t.Errorf("TimeSeries.Key() expected %q, got %q", expectedKey, key)
+		t.Errorf("TimeSeries.Hash expected %q, got %q", expectedKey, key)
 	}
 }
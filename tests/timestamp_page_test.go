@@ -2,9 +2,11 @@ package tests
 
 import (
 	"fmt"
+	"math"
 	"testing"
 	"time"
 	"time-series-engine/config"
+	"time-series-engine/internal"
 	"time-series-engine/internal/disk/chunk"
 	"time-series-engine/internal/disk/entry"
 	"time-series-engine/internal/disk/page"
@@ -17,10 +19,9 @@ func TestTimestampPage(t *testing.T) {
 	pm := page.NewManager(config.PageConfig{PageSize: PageSize})
 
 	numEntries := 20
+	start := uint64(time.Now().Unix())
 	for i := 0; i < numEntries; i++ {
-		timeNow := uint64(time.Now().Unix())
-		c.Add(pm, timeNow)
-		time.Sleep(time.Second)
+		c.Add(pm, start+uint64(i))
 	}
 
 	if c.ActivePage.Metadata.Count != uint64(numEntries) {
@@ -56,3 +57,91 @@ func TestTimestampPage(t *testing.T) {
 		fmt.Println(time.Unix(int64(tse.Value), 0).Format("2006-01-02 15:04:05"))
 	}
 }
+
+func TestNanosecondTimestampPage(t *testing.T) {
+	const PageSize uint64 = 1024
+
+	c := chunk.NewTimestampChunk(PageSize, "tests/testTimestamp")
+	pm := page.NewManager(config.PageConfig{PageSize: PageSize})
+
+	start := internal.Nanoseconds.Now()
+	expected := make([]uint64, 0)
+	for i := uint64(0); i < 50; i++ {
+		// irregular sub-second spacing
+		timestamp := start + i*1_000_003 + i*i*17
+		expected = append(expected, timestamp)
+		if err := c.Add(pm, timestamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := page.DeserializeTimestampPage(c.ActivePage.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsp := p.(*page.TimestampPage)
+	if tsp.Metadata.MinValue != expected[0] || tsp.Metadata.MaxValue != expected[len(expected)-1] {
+		t.Errorf("Unexpected page bounds [%d, %d]", tsp.Metadata.MinValue, tsp.Metadata.MaxValue)
+	}
+	for i, e := range tsp.Entries {
+		if e.GetValue() != expected[i] {
+			t.Fatalf("Expected timestamp %d at %d, got %d", expected[i], i, e.GetValue())
+		}
+	}
+}
+
+func TestDeltaOfDeltaTimestampPage(t *testing.T) {
+	const PageSize uint64 = 256
+
+	c := chunk.NewTimestampChunkWithCodec(PageSize, "tests/testTimestamp", page.TimestampDeltaOfDelta)
+	pm := page.NewManager(config.PageConfig{PageSize: PageSize})
+
+	// regular intervals take a bit per timestamp after the first two
+	start := internal.Seconds.Now()
+	for i := uint64(0); i < 1000; i++ {
+		if err := c.Add(pm, start+i*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.CurrentOffset != 0 || c.ActivePage.Padding < 50 {
+		t.Fatalf("Expected 1000 regular timestamps to fit in a page, %d bytes left", c.ActivePage.Padding)
+	}
+
+	// jitter, gaps, out of order and extreme timestamps of every prefix size
+	c = chunk.NewTimestampChunkWithCodec(PageSize, "tests/testTimestamp", page.TimestampDeltaOfDelta)
+	expected := []uint64{start, start + 10, start + 21, start + 30, start + 500, start + 100, start + 2000, start + 1<<40, 0, math.MaxUint64, 7}
+	for _, timestamp := range expected {
+		if err := c.Add(pm, timestamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := page.DeserializeTimestampPage(c.ActivePage.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsp := p.(*page.TimestampPage)
+	if tsp.Metadata.Codec != page.TimestampCodecDeltaOfDelta {
+		t.Errorf("Expected delta-of-delta codec, got %d", tsp.Metadata.Codec)
+	}
+
+	// compression continues after the loaded timestamps
+	expected = append(expected, 17, 27)
+	for _, timestamp := range expected[len(expected)-2:] {
+		tse := entry.NewTimestampEntry(timestamp, tsp.TimestampCompressor.CompressNext(timestamp, tsp.Metadata.Count))
+		tsp.Add(tse)
+	}
+	p, err = page.DeserializeTimestampPage(tsp.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsp = p.(*page.TimestampPage)
+	if len(tsp.Entries) != len(expected) {
+		t.Fatalf("Expected %d timestamps, got %d", len(expected), len(tsp.Entries))
+	}
+	for i, e := range tsp.Entries {
+		if e.GetValue() != expected[i] {
+			t.Errorf("Expected timestamp %d at %d, got %d", expected[i], i, e.GetValue())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"testing"
 	"time-series-engine/config"
@@ -18,8 +19,10 @@ func TestValuePage(t *testing.T) {
 	pm := page.NewManager(config.PageConfig{PageSize: PageSize})
 
 	numEntries := 30
+	// fixed seed, random values may not fit into a single page otherwise
+	r := rand.New(rand.NewSource(1))
 	for i := 0; i < numEntries; i++ {
-		val := float64(1-2*rand.Intn(2)) * float64(i) * float64(PageSize) * rand.Float64()
+		val := float64(1-2*r.Intn(2)) * float64(i) * float64(PageSize) * r.Float64()
 
 		fmt.Println(i, val)
 		err := c.Add(pm, val)
@@ -55,3 +58,46 @@ func TestValuePage(t *testing.T) {
 	}
 
 }
+
+func TestLosslessValuePage(t *testing.T) {
+	const PageSize uint64 = 400
+
+	c := chunk.NewValueChunkWithCodec(PageSize, "tests/testValue", page.ValueLossless)
+	pm := page.NewManager(config.PageConfig{PageSize: PageSize})
+
+	values := []float64{0.1234567891, 0.1234567891, -3.5e-12, 1e300, math.MaxFloat64, -0.0, 42, 42.000001, math.Inf(-1)}
+	for _, v := range values {
+		if err := c.Add(pm, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := page.DeserializeValuePage(c.ActivePage.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp := p.(*page.ValuePage)
+	if vp.Codec != page.ValueLossless || vp.Metadata.Count != uint64(len(values)) {
+		t.Fatalf("Expected lossless page of %d values, got %+v", len(values), vp.Metadata)
+	}
+	for i, e := range vp.Entries {
+		got := e.(*entry.ValueEntry).Value
+		if math.Float64bits(got) != math.Float64bits(values[i]) {
+			t.Errorf("Value %d: expected %v, got %v", i, values[i], got)
+		}
+	}
+
+	// pages of the first codec are decoded as scaled ones
+	scaled := chunk.NewValueChunk(PageSize, "tests/testValue")
+	if err = scaled.Add(pm, 0.1234567891); err != nil {
+		t.Fatal(err)
+	}
+	p, err = page.DeserializeValuePage(scaled.ActivePage.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp = p.(*page.ValuePage)
+	if vp.Codec != page.ValueScaled || vp.Entries[0].(*entry.ValueEntry).Value != 0.12345 {
+		t.Errorf("Expected scaled value 0.12345, got %v", vp.Entries[0])
+	}
+}
@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time-series-engine/config"
+	"time-series-engine/engine"
+	"time-series-engine/internal"
+	"time-series-engine/internal/disk/entry"
+	"time-series-engine/internal/disk/page"
+	"time-series-engine/internal/disk/write_ahead_log"
+)
+
+// walEntrySize is the size of a put entry of walTestSeries in the write ahead log
+const walEntrySize = 69
+
+var walTestSeries = internal.NewTimeSeries("cpu", internal.Tags{internal.NewTag("host", "a")})
+
+// writeWalTestPoints writes points which all stay in the memtable, so they exist only in the log
+func writeWalTestPoints(t *testing.T, syncMode string, count int) (*engine.Engine, *config.Config) {
+	t.Helper()
+
+	var c *config.Config
+	e := openTestEngineWith(t, 1000, func(conf *config.Config) {
+		conf.WALConfig.SegmentSizeInPages = 8
+		conf.WALConfig.SyncMode = syncMode
+		conf.WALConfig.SyncInterval = 5
+		c = conf
+	})
+
+	now := internal.Seconds.Now()
+	samples := make([]*internal.Sample, 0, count)
+	for i := 0; i < count; i++ {
+		samples = append(samples, internal.NewSample(walTestSeries, internal.NewPointAt(float64(i), now-uint64(count-i))))
+	}
+	if err := e.PutBatch(samples); err != nil {
+		t.Fatal(err)
+	}
+	return e, c
+}
+
+func reopenEngine(t *testing.T, e *engine.Engine, c *config.Config) *engine.Engine {
+	t.Helper()
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := engine.Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = reopened.Close()
+	})
+	return reopened
+}
+
+func countWalTestPoints(t *testing.T, e *engine.Engine) int {
+	t.Helper()
+
+	points, err := e.Query(walTestSeries, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(points)
+}
+
+func activeSegmentPath(t *testing.T, c *config.Config) string {
+	t.Helper()
+
+	segments, err := filepath.Glob(filepath.Join(c.WALConfig.LogsDirPath, "wal_*.log"))
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("Expected a single segment, got %v (%v)", segments, err)
+	}
+	return segments[0]
+}
+
+func TestWALSyncModes(t *testing.T) {
+	for _, mode := range []string{write_ahead_log.SyncAlways, write_ahead_log.SyncInterval, write_ahead_log.SyncNever} {
+		t.Run(mode, func(t *testing.T) {
+			e, c := writeWalTestPoints(t, mode, 40)
+			e = reopenEngine(t, e, c)
+			if n := countWalTestPoints(t, e); n != 40 {
+				t.Errorf("Expected 40 recovered points, got %d", n)
+			}
+		})
+	}
+}
+
+func TestWALTruncatedLastPage(t *testing.T) {
+	// 14 entries fit in a page, so 40 points take two full pages and a part of the third
+	e, c := writeWalTestPoints(t, write_ahead_log.SyncAlways, 40)
+	pageSize := int64(c.PageConfig.PageSize)
+
+	err := os.Truncate(activeSegmentPath(t, c), write_ahead_log.INDEX+2*pageSize+5*walEntrySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e = reopenEngine(t, e, c)
+	if n := countWalTestPoints(t, e); n != 33 {
+		t.Fatalf("Expected 33 recovered points, got %d", n)
+	}
+
+	// new entries continue right after the last recovered one
+	now := internal.Seconds.Now()
+	if err = e.Put(walTestSeries, internal.NewPointAt(33, now)); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenEngine(t, e, c)
+	if n := countWalTestPoints(t, e); n != 34 {
+		t.Errorf("Expected 34 recovered points, got %d", n)
+	}
+}
+
+func TestWALTornPage(t *testing.T) {
+	e, c := writeWalTestPoints(t, write_ahead_log.SyncAlways, 40)
+	pageSize := int64(c.PageConfig.PageSize)
+
+	// last sectors of the second page never reached the disk
+	file, err := os.OpenFile(activeSegmentPath(t, c), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tornAt := write_ahead_log.INDEX + pageSize + 10*walEntrySize
+	_, err = file.WriteAt(make([]byte, write_ahead_log.INDEX+2*pageSize-tornAt), tornAt)
+	_ = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e = reopenEngine(t, e, c)
+	// the rest of the torn page is lost, the page after it is still replayed
+	if n := countWalTestPoints(t, e); n != 36 {
+		t.Errorf("Expected 36 recovered points, got %d", n)
+	}
+}
+
+// corruptWalTestEntry overwrites bytes at offset inside the n-th entry written by writeWalTestPoints
+func corruptWalTestEntry(t *testing.T, c *config.Config, n int, offset int64, data []byte) {
+	t.Helper()
+
+	pageSize := int64(c.PageConfig.PageSize)
+	entriesPerPage := pageSize / walEntrySize
+	position := write_ahead_log.INDEX + int64(n)/entriesPerPage*pageSize + int64(n)%entriesPerPage*walEntrySize
+
+	file, err := os.OpenFile(activeSegmentPath(t, c), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	_, err = file.WriteAt(data, position+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWALRecoveryTruncate(t *testing.T) {
+	e, c := writeWalTestPoints(t, write_ahead_log.SyncAlways, 40)
+	// flip a byte of the value of the 21st entry
+	corruptWalTestEntry(t, c, 20, walEntrySize-1, []byte{0xff})
+
+	e = reopenEngine(t, e, c)
+	if n := countWalTestPoints(t, e); n != 20 {
+		t.Fatalf("Expected 20 recovered points, got %d", n)
+	}
+	report := e.RecoveryReport()
+	if len(report.Corruptions) != 1 || !errors.Is(report.Corruptions[0].Err, entry.ErrChecksumMismatch) {
+		t.Fatalf("Expected a single checksum mismatch, got %v", report)
+	}
+
+	// log continues right after the last valid entry
+	if err := e.Put(walTestSeries, internal.NewPointAt(20, internal.Seconds.Now())); err != nil {
+		t.Fatal(err)
+	}
+	e = reopenEngine(t, e, c)
+	if n := countWalTestPoints(t, e); n != 21 {
+		t.Errorf("Expected 21 recovered points, got %d", n)
+	}
+	if !e.RecoveryReport().Clean() {
+		t.Errorf("Expected clean recovery after truncation, got %v", e.RecoveryReport())
+	}
+}
+
+func TestWALRecoverySkip(t *testing.T) {
+	e, c := writeWalTestPoints(t, write_ahead_log.SyncAlways, 40)
+	c.WALConfig.RecoveryMode = write_ahead_log.RecoverySkip
+	// length of the measurement name of the 21st entry points far outside the page
+	corruptWalTestEntry(t, c, 20, 5, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	for i := 0; i < 2; i++ {
+		e = reopenEngine(t, e, c)
+		// rest of the second page is skipped, the third page is replayed
+		if n := countWalTestPoints(t, e); n != 32 {
+			t.Fatalf("Expected 32 recovered points, got %d", n)
+		}
+		report := e.RecoveryReport()
+		if len(report.Corruptions) != 1 || !errors.Is(report.Corruptions[0].Err, entry.ErrTruncatedEntry) {
+			t.Fatalf("Expected a single truncated entry, got %v", report)
+		}
+	}
+}
+
+func TestWALRecoveryTruncatedEntry(t *testing.T) {
+	e, c := writeWalTestPoints(t, write_ahead_log.SyncAlways, 40)
+	pageSize := int64(c.PageConfig.PageSize)
+
+	// file ends in the middle of the 34th entry
+	err := os.Truncate(activeSegmentPath(t, c), write_ahead_log.INDEX+2*pageSize+5*walEntrySize+30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e = reopenEngine(t, e, c)
+	if n := countWalTestPoints(t, e); n != 33 {
+		t.Fatalf("Expected 33 recovered points, got %d", n)
+	}
+	if e.RecoveryReport().Clean() {
+		t.Errorf("Expected torn entry to be reported")
+	}
+}
+
+func TestWALSyncFailureIsSticky(t *testing.T) {
+	e, c := writeWalTestPoints(t, write_ahead_log.SyncAlways, 1)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	injected := errors.New("injected sync failure")
+	wal := write_ahead_log.NewWriteAheadLog(&c.WALConfig, page.NewManager(c.PageConfig))
+	wal.SyncFile = func(*os.File) error { return injected }
+	if err := wal.LoadWal(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := wal.Put(walTestSeries, internal.NewPointAt(1, 1)); !errors.Is(err, injected) {
+		t.Fatalf("Expected injected sync failure, got %v", err)
+	}
+
+	// entries before the failure may be lost, so the log keeps failing after syncs work again
+	wal.SyncFile = (*os.File).Sync
+	if _, err := wal.Put(walTestSeries, internal.NewPointAt(2, 2)); !errors.Is(err, injected) {
+		t.Errorf("Expected write after a failed sync to fail, got %v", err)
+	}
+	if err := wal.Delete(walTestSeries, 0, 2); !errors.Is(err, injected) {
+		t.Errorf("Expected delete after a failed sync to fail, got %v", err)
+	}
+	if err := wal.Sync(); !errors.Is(err, injected) {
+		t.Errorf("Expected sync after a failed sync to fail, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := wal.Close(); !errors.Is(err, injected) {
+			t.Errorf("Expected close after a failed sync to fail, got %v", err)
+		}
+	}
+
+	reopened := write_ahead_log.NewWriteAheadLog(&c.WALConfig, page.NewManager(c.PageConfig))
+	if err := reopened.LoadWal(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Put(walTestSeries, internal.NewPointAt(3, 3)); err != nil {
+		t.Errorf("Expected reopened log to accept writes, got %v", err)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+}